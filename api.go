@@ -8,6 +8,7 @@ import (
 	"path"
 	"reflect"
 	"sort"
+	"time"
 
 	"google.golang.org/protobuf/proto"
 )
@@ -21,6 +22,15 @@ type Route struct {
 	// HTTP path. The same path can be used multiple times with different methods.
 	Path string
 
+	// Version of the API the route belongs to, e.g. "v2". Empty for
+	// routes which are the same in all versions. The same method and path
+	// can be used by several versions: the server dispatches requests by
+	// VersionHeader. Requests without a version are served by unversioned
+	// routes and then by versions in the order of their first appearance
+	// in the table, so list older versions first. For path-based
+	// versioning use distinct paths, e.g. with Group.
+	Version string
+
 	// Handler is a function with the following signature:
 	// func(ctx, *Request) (*Response, error)
 	// Request and Response are custom structures, unique to this route.
@@ -30,6 +40,27 @@ type Route struct {
 	// is used.
 	Transport Transport
 
+	// Timeout is the maximum time the server spends handling a request.
+	// If the client sends a smaller timeout (see TimeoutHeader), it is
+	// used instead. When the timeout expires, ctx of the handler is
+	// canceled and, if the handler returns the error of ctx, the client
+	// gets 504 Gateway Timeout. Zero means no limit.
+	Timeout time.Duration
+
+	// RateLimit enables token bucket rate limiting of the route. Requests
+	// over the limit are rejected with 429 Too Many Requests
+	// (errors.ResourceExhausted) and Retry-After header.
+	RateLimit *RateLimit
+
+	// Concurrency limits the number of requests of the route handled at
+	// once. The same limiter can be shared by several routes.
+	Concurrency *ConcurrencyLimiter
+
+	// Interceptors are called by the server for requests of this route
+	// after the interceptors passed to BindRoutes (see Interceptors).
+	// The client ignores them.
+	Interceptors []Interceptor
+
 	// Meta is optional field to put arbitrary data about the route.
 	// E.g. the list of users who are allowed to use the route.
 	Meta map[string]interface{}
@@ -88,11 +119,13 @@ var (
 	cookieType     = reflect.TypeOf((*http.Cookie)(nil)).Elem()
 	intType        = reflect.TypeOf((*int)(nil)).Elem()
 	bytesType      = reflect.TypeOf((*[]byte)(nil)).Elem()
+	formFileType   = reflect.TypeOf((*FormFile)(nil))
 )
 
 func validateRequestResponse(structType reflect.Type, request bool, path string) {
-	var jsonFields, bodyFields, statusFields []string
+	var jsonFields, bodyFields, statusFields, formFields []string
 	urlKeys := []string{}
+	wsFields := map[string][]string{}
 	for i := 0; i < structType.NumField(); i++ {
 		field := structType.Field(i)
 		hasJson := field.Tag.Get("json") != ""
@@ -106,6 +139,10 @@ func validateRequestResponse(structType reflect.Type, request bool, path string)
 		hasCookie := field.Tag.Get("cookie") != ""
 		urlKey := field.Tag.Get("url")
 		hasUrl := urlKey != ""
+		hasForm := field.Tag.Get("form") != ""
+		hasFormFile := field.Tag.Get("form_file") != ""
+		wsKey := field.Tag.Get("ws")
+		hasWs := wsKey != ""
 
 		if hasUrl {
 			urlKeys = append(urlKeys, urlKey)
@@ -142,13 +179,13 @@ func validateRequestResponse(structType reflect.Type, request bool, path string)
 		}
 
 		sum = 0
-		for _, v := range []bool{hasJson, hasUseAsBody, hasUseAsStatus, hasQuery, hasHeader, hasCookie, hasUrl} {
+		for _, v := range []bool{hasJson, hasUseAsBody, hasUseAsStatus, hasQuery, hasHeader, hasCookie, hasUrl, hasForm, hasFormFile, hasWs} {
 			if v {
 				sum++
 			}
 		}
 		if sum > 1 {
-			panic(fmt.Sprintf("field %s of struct %s: hasJson=%v, hasUseAsBody=%v, hasUseAsStatus=%v, hasQuery=%v, hasHeader=%v, hasCookie=%v, hasUrl=%v want at most one to be true", field.Name, structType.Name(), hasJson, hasUseAsBody, hasUseAsStatus, hasQuery, hasHeader, hasCookie, hasUrl))
+			panic(fmt.Sprintf("field %s of struct %s: hasJson=%v, hasUseAsBody=%v, hasUseAsStatus=%v, hasQuery=%v, hasHeader=%v, hasCookie=%v, hasUrl=%v, hasForm=%v, hasFormFile=%v, hasWs=%v want at most one to be true", field.Name, structType.Name(), hasJson, hasUseAsBody, hasUseAsStatus, hasQuery, hasHeader, hasCookie, hasUrl, hasForm, hasFormFile, hasWs))
 		}
 		if hasUseAsStatus && request {
 			panic(fmt.Sprintf("field %s of struct %s: hasUseAsStatus=%v, but HTTP status can only be set in responses", field.Name, structType.Name(), hasUseAsStatus))
@@ -162,6 +199,33 @@ func validateRequestResponse(structType reflect.Type, request bool, path string)
 		if hasUrl && !request {
 			panic(fmt.Sprintf("field %s of struct %s: hasUrl=%v, but URL can only be used in requests", field.Name, structType.Name(), hasUrl))
 		}
+		if hasForm && !request {
+			panic(fmt.Sprintf("field %s of struct %s: hasForm=%v, but form can only be used in requests", field.Name, structType.Name(), hasForm))
+		}
+		if hasFormFile && !request {
+			panic(fmt.Sprintf("field %s of struct %s: hasFormFile=%v, but form_file can only be used in requests", field.Name, structType.Name(), hasFormFile))
+		}
+		if hasFormFile && field.Type != formFileType {
+			panic(fmt.Sprintf("field %s of struct %s: hasFormFile=%v, but type is %s, not *api2.FormFile", field.Name, structType.Name(), hasFormFile, field.Type))
+		}
+		if hasWs && !request {
+			panic(fmt.Sprintf("field %s of struct %s: hasWs=%v, but ws can only be used in requests", field.Name, structType.Name(), hasWs))
+		}
+		if hasWs && wsKey != "in" && wsKey != "out" {
+			panic(fmt.Sprintf("field %s of struct %s: ws tag is %q, want \"in\" or \"out\"", field.Name, structType.Name(), wsKey))
+		}
+		if hasWs && field.Type.Kind() != reflect.Chan {
+			panic(fmt.Sprintf("field %s of struct %s: hasWs=%v, but type is %s, not a channel", field.Name, structType.Name(), hasWs, field.Type))
+		}
+		if wsKey == "in" && field.Type.ChanDir()&reflect.RecvDir == 0 {
+			panic(fmt.Sprintf("field %s of struct %s: ws:\"in\" channel must be readable by the handler, but type is %s", field.Name, structType.Name(), field.Type))
+		}
+		if wsKey == "out" && field.Type.ChanDir()&reflect.SendDir == 0 {
+			panic(fmt.Sprintf("field %s of struct %s: ws:\"out\" channel must be writable by the handler, but type is %s", field.Name, structType.Name(), field.Type))
+		}
+		if hasWs {
+			wsFields[wsKey] = append(wsFields[wsKey], field.Name)
+		}
 		if hasCookie && !request && field.Type != cookieType {
 			panic(fmt.Sprintf("field %s of struct %s: hasCookie=%v, response: cookie type is not http.Cookie, but it is required", field.Name, structType.Name(), hasCookie))
 		}
@@ -174,6 +238,9 @@ func validateRequestResponse(structType reflect.Type, request bool, path string)
 		if hasUseAsBody {
 			bodyFields = append(bodyFields, field.Name)
 		}
+		if hasForm || hasFormFile {
+			formFields = append(formFields, field.Name)
+		}
 	}
 	if len(statusFields) > 1 {
 		panic(fmt.Sprintf("struct %s has more than 1 use_as_status field: %v", structType.Name(), statusFields))
@@ -181,9 +248,23 @@ func validateRequestResponse(structType reflect.Type, request bool, path string)
 	if len(bodyFields) > 1 {
 		panic(fmt.Sprintf("struct %s has more than 1 use_as_body field: %v", structType.Name(), bodyFields))
 	}
+	for key, fields := range wsFields {
+		if len(fields) > 1 {
+			panic(fmt.Sprintf("struct %s has more than 1 ws:%q field: %v", structType.Name(), key, fields))
+		}
+	}
+	if len(wsFields) > 0 && len(jsonFields)+len(bodyFields)+len(formFields) > 0 {
+		panic(fmt.Sprintf("struct %s has both ws (%v) and body (%v) fields", structType.Name(), append(wsFields["in"], wsFields["out"]...), append(append(jsonFields, bodyFields...), formFields...)))
+	}
 	if len(bodyFields) > 0 && len(jsonFields) > 0 {
 		panic(fmt.Sprintf("struct %s has both json (%v) and use_as_body (%v) fields", structType.Name(), jsonFields, bodyFields))
 	}
+	if len(formFields) > 0 && len(jsonFields)+len(bodyFields) > 0 {
+		panic(fmt.Sprintf("struct %s has both form (%v) and body (%v) fields", structType.Name(), formFields, append(jsonFields, bodyFields...)))
+	}
+	if _, err := parseMask(path); err != nil {
+		panic(fmt.Sprintf("bad path %q: %v", path, err))
+	}
 	keysInUrl := findUrlKeys(path)
 	sort.Strings(keysInUrl)
 	sort.Strings(urlKeys)
@@ -6,6 +6,7 @@ import (
 	"io"
 	"net/http"
 	"reflect"
+	"time"
 )
 
 // Client is used on client-side to call remote methods provided by the API.
@@ -13,10 +14,16 @@ type Client struct {
 	routeMap      map[signature]Route
 	client        HttpClient
 	baseURL       string
-	errorf        func(format string, args ...interface{})
+	logger        Logger
+	metrics       MetricsCollector
+	tracer        Tracer
 	authorization string
 	maxBody       int64
 	human         bool
+	validate      bool
+	interceptors  []ClientInterceptor
+	contentType   string
+	version       string
 }
 
 type signature struct {
@@ -30,7 +37,9 @@ type signature struct {
 // Paths from the table of routes are appended to baseURL to generate final
 // URL used by HTTP client.
 // All pairs of (request type, response type) must be unique in the table
-// of routes.
+// of routes within a version. If routes of several versions have the same
+// types, the route of the version pinned with PinVersion is used or, if the
+// version is not pinned, the first one.
 func NewClient(routes []Route, baseURL string, opts ...Option) *Client {
 	var client HttpClient
 	client = &http.Client{
@@ -39,8 +48,19 @@ func NewClient(routes []Route, baseURL string, opts ...Option) *Client {
 		},
 	}
 
+	config := NewDefaultConfig()
+	for _, opt := range opts {
+		opt(config)
+	}
+	if config.client != nil {
+		client = config.client
+	}
+
 	routeMap := make(map[signature]Route, len(routes))
 	for _, route := range routes {
+		if config.version != "" && route.Version != "" && route.Version != config.version {
+			continue
+		}
 		handler := route.Handler
 		if m, ok := handler.(*interfaceMethod); ok {
 			handler = m.Func()
@@ -51,28 +71,31 @@ func NewClient(routes []Route, baseURL string, opts ...Option) *Client {
 			request:  handlerType.In(1),
 			response: handlerType.Out(0),
 		}
-		if _, has := routeMap[key]; has {
-			panic(fmt.Sprintf("Already has a handler with signature %v.", key))
+		if other, has := routeMap[key]; has {
+			if other.Version == route.Version {
+				panic(fmt.Sprintf("Already has a handler with signature %v.", key))
+			}
+			if config.version == "" || other.Version == config.version {
+				continue
+			}
 		}
 		routeMap[key] = route
 	}
 
-	config := NewDefaultConfig()
-	for _, opt := range opts {
-		opt(config)
-	}
-	if config.client != nil {
-		client = config.client
-	}
-
 	return &Client{
 		routeMap:      routeMap,
 		client:        client,
 		baseURL:       baseURL,
-		errorf:        config.errorf,
+		logger:        config.getLogger(),
+		metrics:       config.metrics,
+		tracer:        config.tracer,
 		authorization: config.authorization,
 		maxBody:       config.maxBody,
 		human:         config.human,
+		validate:      config.clientValidation,
+		interceptors:  config.clientInterceptors,
+		contentType:   config.contentType,
+		version:       config.version,
 	}
 }
 
@@ -107,17 +130,83 @@ func (c *Client) Call(ctx context.Context, response, request interface{}) error
 		panic(fmt.Sprintf("No registered method with signature %v %v.", key.request, key.response))
 	}
 
+	call := func(ctx context.Context, response, request interface{}) error {
+		return c.call(ctx, &route, response, request)
+	}
+	call = chainClientInterceptors(c.interceptors, &route, call)
+
+	return call(ctx, response, request)
+}
+
+func (c *Client) call(ctx context.Context, route *Route, response, request interface{}) (err error) {
 	t := route.Transport
 	if t == nil {
 		t = DefaultTransport
 	}
 
+	name := handlerName(route.Handler)
+	start := time.Now()
+	status := 0
+	if c.metrics != nil {
+		c.metrics.RequestStarted(route)
+	}
+	var span Span
+	if c.tracer != nil {
+		ctx, span = c.tracer.StartSpan(ctx, name, SpanKindClient, route)
+	}
+	defer func() {
+		latency := time.Since(start)
+		if span != nil {
+			span.End(status, err)
+		}
+		if c.metrics != nil {
+			code := ""
+			if err != nil {
+				code = errorCode(t, err)
+			}
+			c.metrics.RequestFinished(route, status, code, err, latency)
+		}
+		keyvals := []interface{}{
+			"method", route.Method,
+			"route", route.Path,
+			"handler", name,
+			"latency", latency,
+		}
+		if status != 0 {
+			keyvals = append(keyvals, "status", status)
+		}
+		level, msg := LevelInfo, "call succeeded"
+		if err != nil {
+			// The error is returned to the caller, so it is not LevelError.
+			level, msg = LevelWarn, "call failed"
+			keyvals = append(keyvals, "error", err)
+			if code := errorCode(t, err); code != "" {
+				keyvals = append(keyvals, "error_code", code)
+			}
+		}
+		c.logger.Log(ctx, level, msg, keyvals...)
+	}()
+
 	url := c.baseURL + route.Path
 	if c.human {
 		url += "?human=on"
 		ctx = context.WithValue(ctx, humanType{}, true)
 	}
 
+	if c.validate {
+		if err := Validate(request); err != nil {
+			return err
+		}
+	}
+
+	// The limit of decompressed body (see Compression).
+	ctx = context.WithValue(ctx, maxBodyType{}, c.maxBody)
+	// Used by SseTransport to reconnect.
+	ctx = context.WithValue(ctx, httpClientType{}, c.client)
+	if c.contentType != "" {
+		ctx = context.WithValue(ctx, preferredContentType{}, c.contentType)
+	}
+
 	req, err := t.EncodeRequest(ctx, route.Method, url, request)
 	if err != nil {
 		return fmt.Errorf("failed to encode request: %w", err)
@@ -126,29 +215,50 @@ func (c *Client) Call(ctx context.Context, response, request interface{}) error
 	if c.authorization != "" {
 		req.Header.Set("Authorization", c.authorization)
 	}
+	if version := route.Version; version != "" {
+		req.Header.Set(VersionHeader, version)
+	} else if c.version != "" {
+		req.Header.Set(VersionHeader, c.version)
+	}
+	for k, v := range requestHeaderFromContext(ctx) {
+		req.Header[k] = v
+	}
+	injectSpanContext(ctx, req.Header)
+	injectTimeout(ctx, req.Header)
 
 	res, err := c.client.Do(req)
 	if err != nil {
 		return fmt.Errorf("request failed: %w", err)
 	}
-	res.Body = http.MaxBytesReader(nil, res.Body, c.maxBody)
+	status = res.StatusCode
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		// After 101 the body is the connection, e.g. WebSocket. The size
+		// of its messages is limited by the transport.
+		res.Body = http.MaxBytesReader(nil, res.Body, c.maxBody)
+	}
 	defer func() {
 		if !bodyCloseNeeded(ctx, response, request, t) {
 			return
 		}
 		if err := res.Body.Close(); err != nil {
-			c.errorf("failed to close resource: %v", err)
+			c.logger.Log(ctx, LevelError, "failed to close resource", "method", route.Method, "route", route.Path, "error", err)
 		}
 	}()
 
 	if d, ok := t.(responseAndErrorDecoder); ok {
-		return d.DecodeResponseAndError(req.Context(), res, response)
+		err = d.DecodeResponseAndError(req.Context(), res, response)
 	} else if 200 <= res.StatusCode && res.StatusCode < 300 {
 		// Handle all 2xx responses as success.
-		return t.DecodeResponse(req.Context(), res, response)
+		err = t.DecodeResponse(req.Context(), res, response)
 	} else {
-		return t.DecodeError(req.Context(), res)
+		err = t.DecodeError(req.Context(), res)
+	}
+	if err != nil && res.StatusCode >= 400 {
+		if delay, has := parseRetryAfter(res.Header, time.Now()); has {
+			err = &RetryAfterError{Err: err, RetryAfter: delay}
+		}
 	}
+	return err
 }
 
 func (c *Client) Close() error {
@@ -0,0 +1,141 @@
+package api2
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"reflect"
+)
+
+// The functions below implement methods of Transport for transports which
+// encode bodies with bodyCodec: MessagePackTransport and XmlTransport.
+
+// errorCodec encodes and decodes bodies of error responses. The body
+// carries the message of the error and, if the type of the error is
+// registered, the name of the type (code) and the error itself (detail).
+type errorCodec struct {
+	contentType string
+
+	marshalDetail   func(v interface{}) ([]byte, error)
+	unmarshalDetail func(data []byte, v interface{}) error
+
+	encode func(w io.Writer, message, code string, detail []byte) error
+	decode func(data []byte) (message, code string, detail []byte, err error)
+}
+
+func decodeCodecRequest(ctx context.Context, codec *bodyCodec, compression *Compression, r *http.Request, req interface{}) (context.Context, error) {
+	body, err := decodeContentEncoding(ctx, r.Header, r.Body)
+	if err != nil {
+		return ctx, err
+	}
+	r.Body = body
+	ctx = withResponseEncoding(ctx, r, compression)
+
+	if err := readQueryHeaderCookie(codec, req, r.Body, r.URL.Query(), r, r.Header, 0); err != nil {
+		return ctx, err
+	}
+
+	return ctx, nil
+}
+
+func encodeCodecResponse(ctx context.Context, codec *bodyCodec, compression *Compression, w http.ResponseWriter, res interface{}) error {
+	return compressResponse(ctx, w, compression, func(w http.ResponseWriter) error {
+		body, err := writeQueryHeaderCookie(codec, w, res, nil, nil, w.Header(), hasHuman(ctx))
+		if body != nil {
+			panic("unexpected body")
+		}
+		return err
+	})
+}
+
+func encodeCodecError(codec *errorCodec, errors map[string]error, w http.ResponseWriter, err error) error {
+	code := errorToCode(err)
+
+	var errType string
+	var detail []byte
+	if unwrapped, name := detectRegisteredError(err, errors); name != "" {
+		if data, err2 := codec.marshalDetail(unwrapped); err2 != nil {
+			log.Printf("Failed to serialize error of type %s: %v", name, err2)
+		} else {
+			errType, detail = name, data
+		}
+	}
+
+	w.Header().Set("Content-Type", codec.contentType)
+	w.WriteHeader(code)
+	return codec.encode(w, fmt.Sprintf("%v", err), errType, detail)
+}
+
+func decodeCodecResponse(ctx context.Context, codec *bodyCodec, res *http.Response, response interface{}) error {
+	body, err := decodeContentEncoding(ctx, res.Header, res.Body)
+	if err != nil {
+		return err
+	}
+	res.Body = body
+
+	return readQueryHeaderCookie(codec, response, res.Body, nil, nil, res.Header, res.StatusCode)
+}
+
+func decodeCodecError(ctx context.Context, codec *errorCodec, errors map[string]error, res *http.Response) error {
+	body, err := decodeContentEncoding(ctx, res.Header, res.Body)
+	if err != nil {
+		return err
+	}
+	res.Body = body
+
+	buf, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	message, errType, detail, err := codec.decode(buf)
+	if err != nil {
+		return fmt.Errorf("failed to decode error message %q, HTTP status %s: %v", buf, res.Status, err)
+	}
+
+	if errSample, has := registeredError(errors, errType); has {
+		errPtrValue := reflect.New(reflect.TypeOf(errSample))
+		if err := codec.unmarshalDetail(detail, errPtrValue.Interface()); err != nil {
+			return fmt.Errorf("failed to decode error message %q of type %s: %v", detail, errType, err)
+		}
+		return errPtrValue.Elem().Interface().(error)
+	} else if errType != "" {
+		log.Printf("Unknown error type: %s", errType)
+	}
+
+	return fmt.Errorf("API returned error with HTTP status %s: %v", res.Status, message)
+}
+
+// decodeResponseOrError decodes the response or the error depending on
+// HTTP status like JsonTransport.DecodeResponseAndError.
+func decodeResponseOrError(ctx context.Context, t Transport, httpRes *http.Response, res interface{}) error {
+	objType := reflect.TypeOf(res).Elem()
+	p0, has := prepared.Load(objType)
+	if !has {
+		p0 = prepare(objType)
+		prepared.Store(objType, p0)
+	}
+	p := p0.(*preparedType)
+
+	if p.StatusField != noField || 200 <= httpRes.StatusCode && httpRes.StatusCode < 300 {
+		// If Response has status field, no HTTP statuses are considered errors.
+		return t.DecodeResponse(ctx, httpRes, res)
+	}
+	return t.DecodeError(ctx, httpRes)
+}
+
+// streamBodyCloseNeeded returns false if the response has a streaming
+// body (is_stream), which is closed by the caller.
+func streamBodyCloseNeeded(response interface{}) bool {
+	objType := reflect.TypeOf(response).Elem()
+	p0, has := prepared.Load(objType)
+	if !has {
+		p0 = prepare(objType)
+		prepared.Store(objType, p0)
+	}
+	p := p0.(*preparedType)
+
+	return !p.Stream
+}
@@ -0,0 +1,365 @@
+package api2
+
+import (
+	"bytes"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Compression configures gzip/deflate compression in JsonTransport.
+//
+// On server side the response is compressed if the client accepts it
+// (header Accept-Encoding). On client side request bodies are compressed
+// with gzip. Streaming bodies (is_stream, CsvTransport) are compressed
+// incrementally: every flush of the response is passed to the client.
+//
+// Compressed request and response bodies are decompressed regardless of
+// this setting.
+type Compression struct {
+	// Level is the compression level from compress/flate.
+	// Zero means flate.DefaultCompression.
+	Level int
+
+	// MinSize is the minimum size of a body to compress. Smaller bodies
+	// are sent as is. Streaming request bodies and responses flushed before
+	// reaching MinSize (e.g. CsvTransport) are always compressed.
+	MinSize int
+}
+
+func (c *Compression) level() int {
+	if c.Level == 0 {
+		return gzip.DefaultCompression
+	}
+	return c.Level
+}
+
+const (
+	encodingGzip    = "gzip"
+	encodingDeflate = "deflate"
+)
+
+func newCompressor(w io.Writer, encoding string, level int) (io.WriteCloser, error) {
+	switch encoding {
+	case encodingGzip:
+		return gzip.NewWriterLevel(w, level)
+	case encodingDeflate:
+		// "deflate" in HTTP means zlib format (RFC 1950).
+		return zlib.NewWriterLevel(w, level)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+}
+
+// negotiateEncoding selects the encoding of the response from header
+// Accept-Encoding. It prefers gzip. Empty string means no compression.
+func negotiateEncoding(acceptEncoding string) string {
+	qualities := make(map[string]float64)
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		fields := strings.Split(part, ";")
+		name := strings.ToLower(strings.TrimSpace(fields[0]))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range fields[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if value, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = value
+				}
+			}
+		}
+		qualities[name] = q
+	}
+	best, bestQ := "", 0.0
+	for _, encoding := range []string{encodingGzip, encodingDeflate} {
+		q, has := qualities[encoding]
+		if !has {
+			q, has = qualities["*"]
+		}
+		if has && q > bestQ {
+			best, bestQ = encoding, q
+		}
+	}
+	return best
+}
+
+type maxBodyType struct{}
+
+type lazyDecompressor struct {
+	body     io.ReadCloser
+	encoding string
+	r        io.Reader
+	err      error
+}
+
+func (d *lazyDecompressor) Read(p []byte) (int, error) {
+	if d.r == nil && d.err == nil {
+		// Create the reader on first Read, because it reads the header of
+		// the stream and blocks until it arrives.
+		switch d.encoding {
+		case encodingGzip:
+			d.r, d.err = gzip.NewReader(d.body)
+		case encodingDeflate:
+			d.r, d.err = zlib.NewReader(d.body)
+		}
+		if d.err == io.EOF {
+			d.err = io.ErrUnexpectedEOF
+		}
+	}
+	if d.err != nil {
+		return 0, d.err
+	}
+	return d.r.Read(p)
+}
+
+func (d *lazyDecompressor) Close() error {
+	return d.body.Close()
+}
+
+// decodeContentEncoding returns reader of decompressed body according to
+// header Content-Encoding and removes the header. The size of decompressed
+// body is limited by MaxBody passed in ctx.
+func decodeContentEncoding(ctx context.Context, header http.Header, body io.ReadCloser) (io.ReadCloser, error) {
+	encoding := strings.ToLower(strings.TrimSpace(header.Get("Content-Encoding")))
+	switch encoding {
+	case "", "identity":
+		return body, nil
+	case encodingGzip, "x-gzip":
+		encoding = encodingGzip
+	case encodingDeflate:
+	default:
+		return nil, fmt.Errorf("unsupported Content-Encoding %q", encoding)
+	}
+	header.Del("Content-Encoding")
+	header.Del("Content-Length")
+	var decompressed io.ReadCloser = &lazyDecompressor{body: body, encoding: encoding}
+	if maxBody, ok := ctx.Value(maxBodyType{}).(int64); ok {
+		decompressed = http.MaxBytesReader(nil, decompressed, maxBody)
+	}
+	return decompressed, nil
+}
+
+type responseEncodingType struct{}
+
+// withResponseEncoding stores in ctx the encoding of the response
+// negotiated from header Accept-Encoding if compression is enabled.
+func withResponseEncoding(ctx context.Context, r *http.Request, config *Compression) context.Context {
+	if config == nil {
+		return ctx
+	}
+	if encoding := negotiateEncoding(r.Header.Get("Accept-Encoding")); encoding != "" {
+		ctx = context.WithValue(ctx, responseEncodingType{}, encoding)
+	}
+	return ctx
+}
+
+// compressResponse calls encode passing w wrapped to compress the response
+// if the encoding was negotiated by withResponseEncoding.
+func compressResponse(ctx context.Context, w http.ResponseWriter, config *Compression, encode func(http.ResponseWriter) error) error {
+	encoding, ok := ctx.Value(responseEncodingType{}).(string)
+	if !ok || config == nil {
+		return encode(w)
+	}
+	cw := &compressWriter{ResponseWriter: w, encoding: encoding, config: config}
+	err := encode(cw)
+	if err2 := cw.Close(); err == nil {
+		err = err2
+	}
+	return err
+}
+
+// compressWriter compresses the response written through it. It buffers
+// the beginning of the response until MinSize bytes are written or the
+// response is flushed to decide if it is worth compressing.
+type compressWriter struct {
+	http.ResponseWriter
+	encoding string
+	config   *Compression
+
+	status  int
+	buf     []byte
+	decided bool
+	cw      io.WriteCloser
+	err     error
+}
+
+func (w *compressWriter) WriteHeader(statusCode int) {
+	if w.decided {
+		w.ResponseWriter.WriteHeader(statusCode)
+		return
+	}
+	if w.status == 0 {
+		w.status = statusCode
+	}
+}
+
+func (w *compressWriter) Write(p []byte) (int, error) {
+	if w.decided {
+		if w.err != nil {
+			return 0, w.err
+		}
+		if w.cw != nil {
+			return w.cw.Write(p)
+		}
+		return w.ResponseWriter.Write(p)
+	}
+	w.buf = append(w.buf, p...)
+	if len(w.buf) >= w.config.MinSize {
+		if err := w.start(true); err != nil {
+			return 0, err
+		}
+	}
+	return len(p), nil
+}
+
+// start writes HTTP headers and the buffered data.
+func (w *compressWriter) start(compress bool) error {
+	w.decided = true
+	header := w.Header()
+	header.Add("Vary", "Accept-Encoding")
+	if header.Get("Content-Encoding") != "" || w.status == http.StatusNoContent || w.status == http.StatusNotModified {
+		compress = false
+	}
+	if compress {
+		header.Set("Content-Encoding", w.encoding)
+		header.Del("Content-Length")
+	}
+	if w.status != 0 {
+		w.ResponseWriter.WriteHeader(w.status)
+	}
+	if compress {
+		w.cw, w.err = newCompressor(w.ResponseWriter, w.encoding, w.config.level())
+		if w.err != nil {
+			return w.err
+		}
+	}
+	buf := w.buf
+	w.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	_, err := w.Write(buf)
+	return err
+}
+
+type flusher interface {
+	Flush() error
+}
+
+func (w *compressWriter) Flush() {
+	if !w.decided {
+		// The response is streamed, compress it.
+		if err := w.start(true); err != nil {
+			return
+		}
+	}
+	if f, ok := w.cw.(flusher); ok {
+		if err := f.Flush(); err != nil {
+			return
+		}
+	}
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Close sends the rest of the response.
+func (w *compressWriter) Close() error {
+	if !w.decided {
+		// The response is complete and smaller than MinSize.
+		if err := w.start(false); err != nil {
+			return err
+		}
+	}
+	if w.cw != nil && w.err == nil {
+		return w.cw.Close()
+	}
+	return w.err
+}
+
+// Unwrap is used by http.ResponseController.
+func (w *compressWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+// compressRequestBody sets the body of the request compressed with gzip.
+// Buffered bodies smaller than MinSize are left as is, in this case it
+// returns false.
+func compressRequestBody(request *http.Request, config *Compression, buffered []byte, stream io.ReadCloser) (bool, error) {
+	if stream == nil {
+		if len(buffered) == 0 || len(buffered) < config.MinSize {
+			return false, nil
+		}
+		var compressed bytes.Buffer
+		cw, err := newCompressor(&compressed, encodingGzip, config.level())
+		if err != nil {
+			return false, err
+		}
+		if _, err := cw.Write(buffered); err != nil {
+			return false, err
+		}
+		if err := cw.Close(); err != nil {
+			return false, err
+		}
+		data := compressed.Bytes()
+		request.ContentLength = int64(len(data))
+		request.Body = io.NopCloser(bytes.NewReader(data))
+		request.GetBody = func() (io.ReadCloser, error) {
+			return io.NopCloser(bytes.NewReader(data)), nil
+		}
+		request.Header.Set("Content-Encoding", encodingGzip)
+		return true, nil
+	}
+
+	// Compress the stream in a goroutine while it is being sent.
+	pr, pw := io.Pipe()
+	cw, err := gzip.NewWriterLevel(pw, config.level())
+	if err != nil {
+		return false, err
+	}
+	go func() {
+		err := copyFlushing(cw, stream)
+		if err == nil {
+			err = cw.Close()
+		}
+		if err2 := stream.Close(); err == nil {
+			err = err2
+		}
+		pw.CloseWithError(err)
+	}()
+	request.ContentLength = -1
+	request.Body = pr
+	request.GetBody = nil
+	request.Header.Set("Content-Encoding", encodingGzip)
+	return true, nil
+}
+
+// copyFlushing copies src to the compressor flushing it after every read,
+// so the data is passed as soon as it is available.
+func copyFlushing(cw *gzip.Writer, src io.Reader) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := src.Read(buf)
+		if n > 0 {
+			if _, err := cw.Write(buf[:n]); err != nil {
+				return err
+			}
+			if err := cw.Flush(); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
@@ -0,0 +1,131 @@
+package api2
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/starius/api2/errors"
+)
+
+// ConcurrencyLimiter limits the number of requests handled at once.
+// It can be set per route (field Concurrency of Route), shared by several
+// routes or applied to all routes passed to BindRoutes (option
+// GlobalConcurrency). Requests over the limit wait in a bounded FIFO
+// queue; if the queue is full or the wait takes too long, the request is
+// rejected with 503 Service Unavailable (errors.Unavailable).
+type ConcurrencyLimiter struct {
+	// MaxInFlight is the maximum number of requests handled at once.
+	// Must be positive.
+	MaxInFlight int
+
+	// MaxQueue is the maximum number of requests waiting for a slot.
+	// Zero means that requests over MaxInFlight are rejected at once.
+	MaxQueue int
+
+	// QueueTimeout is the maximum time a request waits in the queue.
+	// Zero means that the wait is limited only by the deadline of
+	// the request (see Route.Timeout).
+	QueueTimeout time.Duration
+
+	mu       sync.Mutex
+	inFlight int
+	queue    []chan struct{}
+}
+
+// InFlight returns the number of requests being handled.
+func (l *ConcurrencyLimiter) InFlight() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.inFlight
+}
+
+// QueueDepth returns the number of requests waiting in the queue.
+func (l *ConcurrencyLimiter) QueueDepth() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.queue)
+}
+
+func (l *ConcurrencyLimiter) check(path string) {
+	if l.MaxInFlight <= 0 {
+		panic(fmt.Sprintf("route %s: MaxInFlight of ConcurrencyLimiter must be positive, got %d", path, l.MaxInFlight))
+	}
+	if l.MaxQueue < 0 {
+		panic(fmt.Sprintf("route %s: MaxQueue of ConcurrencyLimiter must not be negative, got %d", path, l.MaxQueue))
+	}
+}
+
+// acquire waits for a slot. If it succeeds, release must be called when
+// the request is handled.
+func (l *ConcurrencyLimiter) acquire(ctx context.Context) error {
+	l.mu.Lock()
+	if l.inFlight < l.MaxInFlight && len(l.queue) == 0 {
+		l.inFlight++
+		l.mu.Unlock()
+		return nil
+	}
+	if len(l.queue) >= l.MaxQueue {
+		l.mu.Unlock()
+		return errors.Unavailable("too many requests in flight")
+	}
+	ready := make(chan struct{})
+	l.queue = append(l.queue, ready)
+	l.mu.Unlock()
+
+	var timeout <-chan time.Time
+	if l.QueueTimeout > 0 {
+		timer := time.NewTimer(l.QueueTimeout)
+		defer timer.Stop()
+		timeout = timer.C
+	}
+
+	var err error
+	select {
+	case <-ready:
+		return nil
+	case <-timeout:
+		err = errors.Unavailable("too many requests in flight, waited in queue for %s", l.QueueTimeout)
+	case <-ctx.Done():
+		err = errors.Unavailable("too many requests in flight, gave up waiting in queue: %w", ctx.Err())
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for i, ch := range l.queue {
+		if ch == ready {
+			l.queue = append(l.queue[:i], l.queue[i+1:]...)
+			return err
+		}
+	}
+	// The slot was handed over to us concurrently. Pass it on.
+	l.releaseLocked()
+	return err
+}
+
+func (l *ConcurrencyLimiter) release() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.releaseLocked()
+}
+
+func (l *ConcurrencyLimiter) releaseLocked() {
+	if len(l.queue) != 0 {
+		// Hand the slot over to the first waiting request.
+		close(l.queue[0])
+		l.queue = l.queue[1:]
+		return
+	}
+	l.inFlight--
+}
+
+// GlobalConcurrency sets ConcurrencyLimiter applied to all routes passed
+// to BindRoutes in addition to limiters of routes. A request waits for
+// the slot of its route first, so queued requests of expensive routes do
+// not occupy global slots.
+func GlobalConcurrency(limiter *ConcurrencyLimiter) Option {
+	return func(config *Config) {
+		config.concurrency = limiter
+	}
+}
@@ -0,0 +1,212 @@
+package api2
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// CORS describes Cross-Origin Resource Sharing policy of the server.
+// Pass it to BindRoutes with option Cors. The policy of a route can be
+// replaced by setting Meta[CORSMetaKey] to *CORS; nil *CORS disables CORS
+// for the route.
+type CORS struct {
+	// AllowedOrigins lists origins allowed to make requests, e.g.
+	// "https://app.example.com". "*" allows any origin; it can not be
+	// combined with AllowCredentials.
+	AllowedOrigins []string
+
+	// AllowedHeaders lists request headers allowed in addition to
+	// DefaultCORSHeaders.
+	AllowedHeaders []string
+
+	// ExposedHeaders lists response headers available to the browser
+	// in addition to the safelisted ones, e.g. headers of response fields.
+	ExposedHeaders []string
+
+	// AllowCredentials allows cookies and Authorization header. Origins
+	// must be listed explicitly: BindRoutes panics if AllowedOrigins
+	// contains "*", since any site could make authenticated requests.
+	AllowCredentials bool
+
+	// MaxAge is how long the browser can cache the result of a preflight
+	// request. Zero means the default of the browser.
+	MaxAge time.Duration
+}
+
+// CORSMetaKey is the key in Route.Meta to override CORS policy of the
+// route. The value must be of type *CORS.
+const CORSMetaKey = "api2.cors"
+
+// DefaultCORSHeaders are request headers always allowed by CORS: headers
+// used by api2 clients.
+var DefaultCORSHeaders = []string{
+	"Content-Type",
+	"Authorization",
+	TimeoutHeader,
+	VersionHeader,
+	traceparentHeader,
+	tracestateHeader,
+}
+
+// Cors enables CORS on the server using the policy. Preflight requests are
+// answered automatically using the methods registered for the path.
+// Affects only servers.
+func Cors(cors *CORS) Option {
+	return func(config *Config) {
+		config.cors = cors
+	}
+}
+
+// routeCORS returns CORS policy of the route or nil if CORS is disabled.
+func routeCORS(route *Route, cors *CORS) *CORS {
+	if value, has := route.Meta[CORSMetaKey]; has {
+		cors, _ = value.(*CORS)
+	}
+	return cors
+}
+
+// check returns an error if the policy is not safe.
+func (c *CORS) check() error {
+	if c == nil || !c.AllowCredentials {
+		return nil
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return fmt.Errorf("CORS policy allows any origin (\"*\") with credentials, list the origins explicitly")
+		}
+	}
+	return nil
+}
+
+// checkCORS checks the policy of the server and the policies of routes.
+func checkCORS(routes []Route, cors *CORS) error {
+	if err := cors.check(); err != nil {
+		return err
+	}
+	for _, route := range routes {
+		if err := routeCORS(&route, nil).check(); err != nil {
+			return fmt.Errorf("route %s %s: %w", route.Method, route.Path, err)
+		}
+	}
+	return nil
+}
+
+// allowOrigin returns the value of Access-Control-Allow-Origin header for
+// the origin or "" if the origin is not allowed.
+func (c *CORS) allowOrigin(origin string) string {
+	if c == nil || origin == "" {
+		return ""
+	}
+	for _, allowed := range c.AllowedOrigins {
+		if allowed == "*" {
+			return "*"
+		}
+		if strings.EqualFold(allowed, origin) {
+			return origin
+		}
+	}
+	return ""
+}
+
+// setHeaders sets CORS headers of the response to a request which is not
+// a preflight request.
+func (c *CORS) setHeaders(header http.Header, origin string) {
+	header.Add("Vary", "Origin")
+	allowOrigin := c.allowOrigin(origin)
+	if allowOrigin == "" {
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", allowOrigin)
+	if c.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	if len(c.ExposedHeaders) != 0 {
+		header.Set("Access-Control-Expose-Headers", strings.Join(c.ExposedHeaders, ", "))
+	}
+}
+
+// setPreflightHeaders sets CORS headers of the response to a preflight
+// request. allow is the list of methods registered for the path.
+func (c *CORS) setPreflightHeaders(header http.Header, origin string, allow []string) {
+	header.Add("Vary", "Origin")
+	header.Add("Vary", "Access-Control-Request-Method")
+	header.Add("Vary", "Access-Control-Request-Headers")
+	allowOrigin := c.allowOrigin(origin)
+	if allowOrigin == "" {
+		return
+	}
+	header.Set("Access-Control-Allow-Origin", allowOrigin)
+	if c.AllowCredentials {
+		header.Set("Access-Control-Allow-Credentials", "true")
+	}
+	header.Set("Access-Control-Allow-Methods", strings.Join(allow, ", "))
+	headers := append(append([]string{}, DefaultCORSHeaders...), c.AllowedHeaders...)
+	header.Set("Access-Control-Allow-Headers", strings.Join(headers, ", "))
+	if c.MaxAge > 0 {
+		header.Set("Access-Control-Max-Age", strconv.Itoa(int(c.MaxAge/time.Second)))
+	}
+}
+
+// allowedMethods returns the methods of routes matching the path, in any
+// version, including the methods handled automatically: HEAD if GET is
+// registered and OPTIONS. It returns nil if no route matches the path.
+func (m methodRouters) allowedMethods(path string) []string {
+	var methods []string
+	for method := range m {
+		if m.hasPath(method, path) {
+			methods = append(methods, method)
+		}
+	}
+	if len(methods) == 0 {
+		return nil
+	}
+	has := func(method string) bool {
+		for _, m := range methods {
+			if m == method {
+				return true
+			}
+		}
+		return false
+	}
+	if has(http.MethodGet) && !has(http.MethodHead) {
+		methods = append(methods, http.MethodHead)
+	}
+	if !has(http.MethodOptions) {
+		methods = append(methods, http.MethodOptions)
+	}
+	sort.Strings(methods)
+	return methods
+}
+
+// routeMethod returns the method of routes serving requests with the method:
+// GET routes serve HEAD requests unless HEAD routes are registered for the
+// path. The body of responses to HEAD requests is discarded by net/http.
+func (m methodRouters) routeMethod(method, path string) string {
+	if method == http.MethodHead && !m.hasPath(http.MethodHead, path) {
+		return http.MethodGet
+	}
+	return method
+}
+
+// answerOptions answers OPTIONS request to a path without OPTIONS routes.
+// If it is a CORS preflight request, the policy of the route requested
+// is applied.
+func (m methodRouters) answerOptions(w http.ResponseWriter, r *http.Request, cors *CORS, allow []string) {
+	origin := r.Header.Get("Origin")
+	requestMethod := r.Header.Get("Access-Control-Request-Method")
+	if origin != "" && requestMethod != "" {
+		// Browsers do not send values of custom headers in preflight
+		// requests, so the version is not known.
+		method := m.routeMethod(requestMethod, r.URL.Path)
+		if router, index, _ := m.find(method, "", r.URL.Path); router != nil {
+			if cors := routeCORS(&router.routes[index], cors); cors != nil {
+				cors.setPreflightHeaders(w.Header(), origin, allow)
+			}
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -144,4 +144,5 @@ var CsvTransport = &JsonTransport{
 	ResponseDecoder: csvDecodeResponse,
 	ErrorEncoder:    csvEncodeError,
 	ErrorDecoder:    csvDecodeError,
+	ContentType:     "text/csv",
 }
@@ -0,0 +1,59 @@
+package api2
+
+import (
+	"context"
+	stderrors "errors"
+	"net/http"
+	"time"
+
+	"github.com/starius/api2/errors"
+)
+
+// TimeoutHeader is the HTTP header in which the client sends the time
+// remaining until the deadline of ctx passed to Client.Call, e.g. "1.5s"
+// (the format of time.Duration). The server applies it to ctx of the
+// handler.
+const TimeoutHeader = "X-Api2-Timeout"
+
+// injectTimeout sets TimeoutHeader from the deadline of ctx.
+func injectTimeout(ctx context.Context, header http.Header) {
+	deadline, has := ctx.Deadline()
+	if !has {
+		return
+	}
+	remaining := time.Until(deadline)
+	if remaining <= 0 {
+		// The call will fail anyway.
+		return
+	}
+	// Round up, so the server doesn't get zero timeout.
+	remaining = remaining.Truncate(time.Millisecond) + time.Millisecond
+	header.Set(TimeoutHeader, remaining.String())
+}
+
+// requestTimeout returns the timeout of the request: the smallest of
+// TimeoutHeader and route.Timeout. Zero means no timeout. Invalid values
+// of the header are ignored.
+func requestTimeout(r *http.Request, route *Route) time.Duration {
+	timeout := route.Timeout
+	if value := r.Header.Get(TimeoutHeader); value != "" {
+		clientTimeout, err := time.ParseDuration(value)
+		if err == nil && clientTimeout > 0 && (timeout == 0 || clientTimeout < timeout) {
+			timeout = clientTimeout
+		}
+	}
+	return timeout
+}
+
+// deadlineError converts the error of the handler caused by the expired
+// deadline of the request to a 504 error. Other errors are passed as is;
+// if the handler succeeded after the deadline, its response is sent.
+func deadlineError(ctx context.Context, timeout time.Duration, err error) error {
+	if err == nil || ctx.Err() != context.DeadlineExceeded {
+		return err
+	}
+	if stderrors.Is(err, context.DeadlineExceeded) {
+		return errors.DeadlineExceeded("handler did not finish in %s: %w", timeout, err)
+	}
+	return err
+}
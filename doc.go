@@ -93,6 +93,21 @@ On the client side your code must read from that reader the entire response
 and then close it. If a streaming field is left `nil`, it is interpreted
 as empty body.
 
+**Forms**. Fields of Request with tag form:"name" are sent in HTML form
+body: application/x-www-form-urlencoded or multipart/form-data. They are
+encoded like query fields and can be mixed with url, query, header and
+cookie fields, but not with JSON or use_as_body fields. The server accepts
+both form encodings from browsers and webhooks and rejects other bodies
+with 415 Unsupported Media Type; the client sends URL encoded forms.
+
+**File uploads**. Fields of type *api2.FormFile with tag form_file:"name"
+are files of a multipart/form-data request; a request may have several
+of them mixed with form fields. On the server the files are streamed from
+the request body while the handler reads them, so they are not buffered in
+memory, but they must be read in the order they are sent. The client builds
+the multipart body from the same struct and streams files created with
+api2.NewFormFile after form fields in the order of struct fields.
+
 Now let's write the function that generates the table of routes:
 
 	func GetRoutes(s *Foo) []api2.Route {
@@ -109,9 +124,78 @@ Now let's write the function that generates the table of routes:
 You can add multiple routes with the same path, but in this case their
 HTTP methods must be different so that they can be distinguished.
 
+**Paths**. Besides static segments, a path can contain parameters
+:name (one segment), constrained parameters :name{regexp} matching
+only if the whole segment matches the regexp (e.g. :id{[0-9]+}; shortcuts
+{int}, {uint} and {uuid} are available) and a catch-all *name as the
+last segment matching the rest of the path (e.g. /files/*path). Values
+are passed to fields with tag url:"name". Routes are matched by a trie:
+static segments win over constrained parameters, which win over plain
+parameters, which win over catch-all, regardless of the order of routes.
+The client checks values against constraints before sending the request.
+Routes with the same method and paths differing only in names of
+parameters or trailing slashes (e.g. /users/:id and /users/:name/)
+are duplicates. Routes matching some requests in common (e.g. /users/:id
+and /users/me) are ambiguous. BindRoutes panics listing all the
+conflicts with names of handlers. Ambiguous routes are accepted with option
+api2.AllowAmbiguousRoutes(true); the rules above choose the route. Use
+api2.CheckRoutes(routes) to check a table in tests. Parameters with
+constraints which can't match the same segment (e.g. :id{uint} and
+:slug{[a-z]+}) don't conflict.
+
+Upgrading: tables with ambiguous routes were accepted by earlier versions,
+now BindRoutes panics on them unless AllowAmbiguousRoutes(true) is passed.
+
 If Transport is not set, DefaultTransport is used which is defined as
 &api2.JsonTransport{}.
 
+**Route groups**. api2.Group applies a path prefix, a default Transport,
+default Meta and interceptors to a set of routes. The result is a plain
+[]api2.Route, so groups can be nested and the generators work as usual:
+
+	func GetRoutes(s IBillingService) []api2.Route {
+		return api2.Group{Prefix: "/v1/billing", Meta: map[string]interface{}{"scope": "billing"}}.Routes(
+			[]api2.Route{
+				{Method: http.MethodGet, Path: "/invoices/:id", Handler: s.GetInvoice},
+			},
+		)
+	}
+
+Interceptors of the group are stored in Route.Interceptors and are called
+inside the interceptors passed to BindRoutes.
+
+**Versioning**. Several versions of an endpoint can be served side by side:
+set Route.Version (e.g. "v2") and use the same method and path in
+routes of different versions. The server dispatches requests by header
+X-Api2-Version (api2.VersionHeader) or by parameter version of the media
+type in Accept header (application/json; version=v2). Routes without
+Version are served in all versions. Requests without a version get
+unversioned routes and then the versions in the order of the table, so
+list older versions first to keep old clients working. An unknown version
+results in 400 Bad Request. For path-based versioning use distinct
+prefixes, e.g. api2.Group{Prefix: "/v2", Version: "v2"}. A client pinned
+with option api2.PinVersion("v2") uses the routes of the version and sends
+the header. GenerateOpenApiSpec and GenerateTSClient write a separate
+output for each version to subdirectories of OutDir named after versions.
+
+**OPTIONS, HEAD and CORS**. BindRoutes answers OPTIONS requests to known
+paths with 204 and header Allow listing the methods registered for the
+path. GET routes also serve HEAD requests (the body is discarded).
+405 Method Not Allowed responses include header Allow as well. Option
+api2.Cors enables CORS: preflight requests are answered using the same
+list of methods, headers used by api2 clients (X-Api2-Timeout,
+X-Api2-Version, Traceparent, Tracestate, etc) are always allowed:
+
+	api2.BindRoutes(mux, routes, api2.Cors(&api2.CORS{
+		AllowedOrigins: []string{"https://app.example.com"},
+		ExposedHeaders: []string{"X-Total"},
+	}))
+
+The policy of a route can be replaced with *api2.CORS in
+Meta[api2.CORSMetaKey]; nil value disables CORS for the route.
+BindRoutes panics if a policy combines origin "*" with AllowCredentials:
+origins sending credentials must be listed explicitly.
+
 **Error handling**. A handler can return any Go error. `JsonTransport`
 by default returns JSON. `Error()` value is put into "error" field of
 that JSON. If the error has `HttpCode() int` method, it is called and
@@ -123,6 +207,182 @@ object of the registered type - into "detail" field. The error can be
 wrapped using `fmt.Errorf("%w" ...)`. See
 test/custom_error_test.go for an example.
 
+If a handler (or the Transport decoding the request or encoding the
+response) panics, the server recovers, logs the panic with the stack trace
+and responds with HTTP status 500. Use option OnPanic to report panics
+and RethrowPanics(true) to panic again after that (e.g. in tests).
+
+**Validation**. Fields of Request can have tag `validate:"..."` with
+comma separated rules: required, min=N, max=N, len=N, oneof=a b c and
+regexp=RE (must be the last rule). The server checks the rules after
+decoding the request and responds with HTTP status 400 if they are
+violated. The error is of type *ValidationError and contains the list of
+violated rules per field; api2 Client decodes it back:
+
+	type CreateRequest struct {
+		Name string `json:"name" validate:"required,max=100"`
+		Age  int    `json:"age" validate:"min=18"`
+	}
+
+The rules are also reflected in OpenAPI schema and in TypeScript types.
+Option ClientValidation(true) makes the client check the rules before
+sending the request. Function Validate checks a struct explicitly.
+
+**Interceptors**. Cross-cutting concerns (authorization, logging, metrics)
+can be implemented as interceptors passed to BindRoutes with option
+Interceptors. An interceptor receives the matched route (including Meta),
+the decoded request and the next element of the chain. It can replace
+the response and the error before they are encoded by the Transport:
+
+	logger := func(ctx context.Context, route *api2.Route, req interface{}, next api2.CallHandler) (interface{}, error) {
+		res, err := next(ctx, req)
+		log.Printf("%s %s: %v", route.Method, route.Path, err)
+		return res, err
+	}
+	api2.BindRoutes(mux, routes, api2.Interceptors(logger))
+
+The matched route is also available in the handler via RouteFromContext.
+
+Client side has the same extension point: option ClientInterceptors passed to
+NewClient (or to NewClient of a generated static client). A client
+interceptor sees the route, typed request and response and the error.
+Use WithRequestHeader to add HTTP headers from a client interceptor.
+
+**Logging**. By default errors are logged with log.Printf; use option
+ErrorLogger to replace the function. For structured logs pass option
+StructuredLogger to BindRoutes and NewClient. The logger gets one
+record per request with keys method, path, route (path template), handler
+(Service.Method), status, latency, error and error_code. Use
+SlogLogger to convert *slog.Logger (Go 1.21+).
+
+**Metrics**. Option Metrics makes server or client report request
+counts, errors, in-flight requests and latencies per route (labelled by
+path template, not by actual URL) to a MetricsCollector. Package
+github.com/starius/api2/metrics implements it without external
+dependencies and serves the metrics in Prometheus text format:
+
+	serverMetrics := metrics.New("api2_server")
+	api2.BindRoutes(mux, routes, api2.Metrics(serverMetrics))
+	mux.Handle("/metrics", serverMetrics)
+
+**Tracing**. The client sends W3C trace context (headers traceparent and
+tracestate) of the span attached to ctx (see ContextWithSpanContext) and
+the server attaches the received span context to ctx of the handler (see
+SpanContextFromContext), so passing ctx of the handler to a client call
+continues the trace. Option Tracing sets a Tracer which starts a span
+per request on server and per call on client; spans are named after the
+handler (Service.Method).
+
+**MessagePack**. MessagePackTransport encodes bodies in MessagePack instead
+of JSON, which is more compact and faster to parse. Struct tags have the
+same meaning as in JsonTransport (query, header, cookie, url, use_as_body,
+use_as_status) and field names are taken from tag msgpack or, if it is
+missing, from tag json, so the same types serve both transports. Register
+error types in field Errors to get them back in the client. The encoder
+is in package github.com/starius/api2/msgpack.
+
+**XML**. XmlTransport encodes bodies in XML according to xml tags of
+the fields; tags query, header, cookie, url, use_as_body and use_as_status
+work as in JsonTransport. The root element is named after the type
+unless it has field XMLName. Errors are sent as <error> element with the
+message, the code and the detail of errors registered in field Errors,
+which the client decodes back.
+
+**Server-Sent Events**. SseTransport streams events to browsers
+(text/event-stream). The Response has a channel field with tag
+use_as_body:"true"; the handler returns it and sends events from a
+goroutine, closing the channel in the end, and the server flushes each event.
+Fields of the event with tags sse:"id", sse:"event" and sse:"retry" are
+sent as SSE fields, the rest as JSON data. The client passes a channel in
+the Response and gets events in it; if the connection breaks, it reconnects
+with header Last-Event-ID. The TypeScript client gets an EventSource-based
+helper for such routes.
+
+**WebSocket**. WebSocketTransport serves full-duplex routes (method GET)
+over WebSocket, upgrading the connection from the same mux. The Request has
+channel fields with tags ws:"in" (messages from the client) and
+ws:"out" (messages to the client) next to url, query, header and cookie
+fields. The handler is called after the upgrade: it reads In until it is
+closed by the client and writes to Out; when it returns, the connection is
+closed, and its error is sent in the close frame with code 4000 plus the
+HTTP status. The client passes its own channels in the Request, closes In to
+finish and gets the error of the handler from Call.
+
+**NDJSON streams**. NdjsonTransport streams typed records as
+newline-delimited JSON (application/x-ndjson). The stream is a channel
+field with tag use_as_body:"true" in the Response (the server writes one
+JSON object per line and flushes it) or in the Request (uploads: the client
+sends records from its channel until it is closed and the handler reads
+them). Both sides respect context cancellation; requests and responses
+without channel fields are plain JSON.
+
+**Content negotiation**. NegotiatingTransport serves a route in several
+wire formats listed in field Formats: the request is decoded according to
+its Content-Type (unknown types are rejected with 415) and the response is
+encoded in the format selected by the Accept header, the first format is
+the default. Clients send requests in the format set by option
+PreferredContentType and decode responses by their Content-Type. The
+OpenAPI spec lists all the formats of the route.
+
+**Compression**. Set field Compression of JsonTransport to compress
+responses with gzip or deflate (negotiated from Accept-Encoding) and
+request bodies sent by Client. Streams (is_stream and CsvTransport) are
+compressed on the fly. Compressed request and response bodies are
+decompressed regardless of the setting. Shared transports (CsvTransport,
+SseTransport, NdjsonTransport) are package variables: don't change their
+fields, enable compression on a copy made by WithCompression:
+
+	compressedCsv := api2.CsvTransport.WithCompression(&api2.Compression{})
+	routes := []api2.Route{
+		{Method: http.MethodGet, Path: "/export", Handler: s.Export, Transport: compressedCsv},
+	}
+
+**Deadlines**. If ctx passed to Client.Call has a deadline, the client
+sends the remaining time in header X-Api2-Timeout and the server applies
+it to ctx of the handler. Field Timeout of Route limits the time the
+server spends on the route regardless of the client. When the deadline
+expires, the client gets 504 Gateway Timeout (errors.DeadlineExceeded)
+if the handler fails with the error of ctx; a successful result is sent
+even if it comes late.
+
+**Rate limiting**. Field RateLimit of Route enables token bucket rate
+limiting, optionally per caller (see CallerKeyHeader, CallerKeyRemoteIP).
+Requests over the limit get 429 Too Many Requests
+(errors.ResourceExhausted) with Retry-After header; Client.Call returns
+RetryAfterError, the delay can be obtained with api2.RetryAfter(err):
+
+	{
+		Method: http.MethodPost, Path: "/v1/foo/bar", Handler: s.Bar,
+		RateLimit: &api2.RateLimit{
+			Rate:  10, // Requests per second.
+			Burst: 20,
+			Key:   api2.CallerKeyHeader("Authorization"),
+		},
+	},
+
+**Concurrency limits**. Field Concurrency of Route sets ConcurrencyLimiter
+limiting the number of requests of the route handled at once; option
+GlobalConcurrency limits all routes passed to BindRoutes. Requests over
+the limit wait in a bounded queue (MaxQueue, QueueTimeout) and are shed
+with 503 Service Unavailable (errors.Unavailable). Methods InFlight and
+QueueDepth of the limiter report its state; ObserveConcurrency of package metrics
+exports them.
+
+**Graceful shutdown**. NewServer binds routes like BindRoutes and returns
+api2.Server which tracks in-flight requests, including streaming
+responses. Shutdown stops accepting new requests (they get 503),
+closes the channel returned by Draining(ctx) in handlers and waits for
+in-flight handlers; if its ctx expires, contexts of handlers are canceled:
+
+	server := api2.NewServer(routes)
+	go server.ListenAndServe(":8080")
+	...
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	err := server.Shutdown(ctx)
+
+Other handlers (metrics, health checks) can be added to server.Mux().
+
 In the server you need a real instance of service Foo to pass to GetRoutes.
 Then just bind the routes to http.ServeMux and run the server:
 
@@ -1,4 +1,4 @@
-package errors
+package errors_test
 
 import (
 	"context"
@@ -11,6 +11,7 @@ import (
 	"testing"
 
 	"github.com/starius/api2"
+	api2errors "github.com/starius/api2/errors"
 )
 
 func TestErrToHttp(t *testing.T) {
@@ -19,15 +20,15 @@ func TestErrToHttp(t *testing.T) {
 		want int
 	}{
 		{
-			err:  NotFound("document is not found"),
+			err:  api2errors.NotFound("document is not found"),
 			want: http.StatusNotFound,
 		},
 		{
-			err:  Internal("all shards failed"),
+			err:  api2errors.Internal("all shards failed"),
 			want: http.StatusInternalServerError,
 		},
 		{
-			err:  fmt.Errorf("can not find the document with ID 123: %w", NotFound("document is not found")),
+			err:  fmt.Errorf("can not find the document with ID 123: %w", api2errors.NotFound("document is not found")),
 			want: http.StatusNotFound,
 		},
 
@@ -67,12 +68,12 @@ func TestUnwrap(t *testing.T) {
 		want bool
 	}{
 		{
-			err:  AlreadyExists("document already exists: %w", os.ErrExist),
+			err:  api2errors.AlreadyExists("document already exists: %w", os.ErrExist),
 			is:   os.ErrExist,
 			want: true,
 		},
 		{
-			err:  AlreadyExists("document already exists"),
+			err:  api2errors.AlreadyExists("document already exists"),
 			is:   os.ErrExist,
 			want: false,
 		},
@@ -2,7 +2,7 @@
 // prettier-disable
 // prettier-ignore
 // Code generated by api2. DO NOT EDIT.
-import {route} from "./utils"
+import {route, sse} from "./utils"
 
 export const api = {
 example: {
@@ -13,7 +13,7 @@ example: {
 				{"header":["session"]}),
 			Echo: route<example.EchoRequest, example.EchoResponse>(
 				"POST", "/echo/:user",
-				{"header":["session"],"json":["text","bar","code","dir","items","maps"]},
+				{"header":["session"],"url":["user"],"json":["text","bar","code","dir","items","maps"]},
 				{"json":["text","old","old2","color"]}),
 			Since: route<example.SinceRequest, example.SinceResponse>(
 				"POST", "/since",
@@ -61,6 +61,7 @@ export type HelloResponse = {
 
 
 export type EchoRequest = {
+	user?: string
 	session?: string
 	text: string
 	bar: number
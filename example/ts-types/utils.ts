@@ -13,16 +13,47 @@ export function cancelable<T>(p: T, source): T & { cancel: () => void } {
 type RequestMapping = Record<string, string[]>
 type ResponseMapping = Record<string, string[]>
 
-export function route<Req, Res>(method:string, url:string, requestMapping:RequestMapping, responseMapping:ResponseMapping) {
+// fillUrl substitutes parameters ":name" and "*name" of url with fields of
+// data and removes the fields from data.
+function fillUrl(url:string, data:any, urlReqSet:Set<string>) {
+	if (!data || !urlReqSet.size) {
+		return url
+	}
+	return url.split("/").map(part => {
+		let match = /^([:*])([^{]+)/.exec(part)
+		if (!match || !urlReqSet.has(match[2])) {
+			return part
+		}
+		let value = String(data[match[2]])
+		delete data[match[2]]
+		if (match[1] === "*") {
+			return value.split("/").map(encodeURIComponent).join("/")
+		}
+		return encodeURIComponent(value)
+	}).join("/")
+}
+
+export function route<Req, Res>(method:string, url:string, requestMapping:RequestMapping, responseMapping:ResponseMapping, version?:string) {
 	let headersReqSet = new Set(requestMapping.headers)
 	let queryReqSet = new Set(requestMapping.query)
-	let shouldProcess = headersReqSet.size || queryReqSet.size;
+	let formReqSet = new Set(requestMapping.form)
+	let fileReqSet = new Set(requestMapping.file)
+	let urlReqSet = new Set(requestMapping.url)
+	let shouldProcess = headersReqSet.size || queryReqSet.size || formReqSet.size || fileReqSet.size;
 	return Object.assign((data: Req)=>{
 		const c = axios.CancelToken.source()
 		data = {...data};
+		let path = fillUrl(url, data, urlReqSet)
 		let headers = {} as any
+		if (version) {
+			headers["X-Api2-Version"] = version
+		}
 		let query = {} as any
+		let form = null as URLSearchParams | FormData | null
 		if (data && shouldProcess) {
+			if (fileReqSet.size) {
+				form = new FormData()
+			}
 			for(let k in data) {
 					if(headersReqSet.has(k)) {
 						headers[k] = data[k]
@@ -30,11 +61,20 @@ export function route<Req, Res>(method:string, url:string, requestMapping:Reques
 					} else if(queryReqSet.has(k)) {
 						query[k] = data[k]
 						delete data[k];
+					} else if(formReqSet.has(k)) {
+						form = form || new URLSearchParams()
+						form.append(k, String(data[k]))
+						delete data[k];
+					} else if(fileReqSet.has(k)) {
+						if (data[k]) {
+							(form as FormData).append(k, data[k] as any)
+						}
+						delete data[k];
 					}
 				}
 		}
 		let queryAsString = new URLSearchParams(Object.values(query)).toString()
-		return cancelable(axios.request<Res>({ method, url: url + (queryAsString? '?' + queryAsString : '') , data, cancelToken: c.token, headers  }).then(el=>{
+		return cancelable(axios.request<Res>({ method, url: path + (queryAsString? '?' + queryAsString : '') , data: form || data, cancelToken: c.token, headers  }).then(el=>{
 			let res = el.data;
 			for(let k of responseMapping.header) {
 				if(el.headers[k]) {
@@ -43,5 +83,27 @@ export function route<Req, Res>(method:string, url:string, requestMapping:Reques
 			}
 			return res;
 		}), c)
-	}, {method, url})
+	}, {method, url, version})
+}
+
+export function sse<Req, Ev>(url:string, requestMapping:RequestMapping) {
+	let queryReqSet = new Set(requestMapping.query)
+	let urlReqSet = new Set(requestMapping.url)
+	return Object.assign((data: Req, onEvent: (event: Ev, message: MessageEvent) => void, eventNames: string[] = [])=>{
+		data = {...data};
+		let path = fillUrl(url, data, urlReqSet)
+		let query = new URLSearchParams()
+		for(let k in data) {
+			if(queryReqSet.has(k) && data[k] !== undefined) {
+				query.append(k, String(data[k]))
+			}
+		}
+		let queryAsString = query.toString()
+		let source = new EventSource(path + (queryAsString? '?' + queryAsString : ''))
+		let listener = (message: MessageEvent) => onEvent(JSON.parse(message.data), message)
+		for(let name of ["message", ...eventNames]) {
+			source.addEventListener(name, listener as EventListener)
+		}
+		return source
+	}, {url})
 }
@@ -0,0 +1,139 @@
+package api2
+
+import (
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"reflect"
+)
+
+const (
+	formContentType      = "application/x-www-form-urlencoded"
+	multipartContentType = "multipart/form-data"
+)
+
+// isFormContentType returns true if header Content-Type is one of form
+// encodings, which can be decoded by any transport.
+func isFormContentType(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	return err == nil && (mediaType == formContentType || mediaType == multipartContentType)
+}
+
+// parseForm parses the body of a form request: URL encoded or multipart.
+// Parsing of multipart body stops at the first part which is a file from
+// fileKeys; the rest of the body is returned as a stream.
+func parseForm(body io.Reader, header http.Header, fileKeys map[string]bool) (url.Values, *formStream, error) {
+	contentType := header.Get("Content-Type")
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || (mediaType != formContentType && mediaType != multipartContentType) {
+		return nil, nil, httpError{
+			Code:    http.StatusUnsupportedMediaType,
+			Message: fmt.Sprintf("unsupported Content-Type %q, want %s or %s", contentType, formContentType, multipartContentType),
+		}
+	}
+
+	if mediaType == formContentType {
+		data, err := io.ReadAll(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		values, err := url.ParseQuery(string(data))
+		return values, nil, err
+	}
+
+	boundary := params["boundary"]
+	if boundary == "" {
+		return nil, nil, fmt.Errorf("no boundary in Content-Type %q", contentType)
+	}
+	values := make(url.Values)
+	reader := multipart.NewReader(body, boundary)
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return values, nil, nil
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read multipart body: %w", err)
+		}
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+		if fileKeys[name] {
+			return values, &formStream{reader: reader, pending: part}, nil
+		}
+		data, err := io.ReadAll(part)
+		if err != nil {
+			return nil, nil, fmt.Errorf("failed to read form field %s: %w", name, err)
+		}
+		values.Add(name, string(data))
+	}
+}
+
+// readForm fills form fields of the request from its body. Files are
+// not read: they are streamed from the body when the handler reads them.
+func readForm(p *preparedType, objValue reflect.Value, body io.Reader, header http.Header) error {
+	fileKeys := make(map[string]bool, len(p.FileMapping))
+	for _, m := range p.FileMapping {
+		fileKeys[m.Key] = true
+	}
+	values, stream, err := parseForm(body, header, fileKeys)
+	if err != nil {
+		return err
+	}
+	for _, m := range p.FormMapping {
+		fieldPtr := objValue.Field(m.Field).Addr().Interface()
+		value := values.Get(m.Key)
+		if err := fromString(fieldPtr, value); err != nil {
+			field := objValue.Type().Field(m.Field)
+			return fmt.Errorf("failed to parse value %q from form key %s for field %s: %w", value, m.Key, field.Name, err)
+		}
+	}
+	if len(p.FileMapping) == 0 {
+		return nil
+	}
+	if stream == nil {
+		// No files in the body.
+		stream = &formStream{err: io.EOF}
+	}
+	stream.files = make(map[string]*FormFile, len(p.FileMapping))
+	stream.fields = make(map[string]bool, len(p.FormMapping))
+	for _, m := range p.FormMapping {
+		stream.fields[m.Key] = true
+	}
+	for _, m := range p.FileMapping {
+		file := &FormFile{key: m.Key, stream: stream}
+		stream.files[m.Key] = file
+		objValue.Field(m.Field).Set(reflect.ValueOf(file))
+	}
+	return nil
+}
+
+// writeForm writes form fields of the request URL encoded. If the request
+// has files, it returns multipart body streaming them instead.
+func writeForm(p *preparedType, objValue reflect.Value, w io.Writer, header http.Header) (io.ReadCloser, error) {
+	values := make(url.Values, len(p.FormMapping))
+	for _, m := range p.FormMapping {
+		value, err := toString(objValue.Field(m.Field).Interface())
+		if err != nil {
+			field := objValue.Type().Field(m.Field)
+			return nil, fmt.Errorf("failed to marshal value for field %s: %w", field.Name, err)
+		}
+		values.Set(m.Key, value)
+	}
+	if len(p.FileMapping) != 0 {
+		pr, pw := io.Pipe()
+		mw := multipart.NewWriter(pw)
+		header.Set("Content-Type", mw.FormDataContentType())
+		go func() {
+			pw.CloseWithError(writeMultipart(mw, p, objValue, values))
+		}()
+		return pr, nil
+	}
+	header.Set("Content-Type", formContentType)
+	_, err := io.WriteString(w, values.Encode())
+	return nil, err
+}
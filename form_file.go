@@ -0,0 +1,233 @@
+package api2
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/textproto"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+)
+
+const defaultFileContentType = "application/octet-stream"
+
+// FormFile is a file uploaded in a multipart/form-data request. It is used
+// as the type of request fields with tag form_file:
+//
+//	type UploadRequest struct {
+//		Title  string         `form:"title"`
+//		Image  *api2.FormFile `form_file:"image"`
+//		Thumb  *api2.FormFile `form_file:"thumb"`
+//	}
+//
+// On the client side create it with NewFormFile. The Client streams the
+// files in the order of fields in the struct after all form fields.
+//
+// On the server side the files are not buffered: they are read directly
+// from the request body while the handler reads them. Fields with tag
+// form_file are always set to non-nil values; a file missing in the
+// request has empty name and content. The Client sends nil files as empty
+// parts. Since the body is read sequentially, calling any method of a file
+// skips the files before it, so read the files in the order they are sent.
+// Reading a skipped file returns an error.
+type FormFile struct {
+	filename    string
+	contentType string
+	content     io.Reader
+
+	// Server side.
+	key    string
+	stream *formStream
+	part   *multipart.Part
+	passed bool
+	eof    bool
+}
+
+// NewFormFile creates a file to be sent by the Client. If contentType is
+// empty, application/octet-stream is used. If content implements io.Closer,
+// it is closed after sending.
+func NewFormFile(filename, contentType string, content io.Reader) *FormFile {
+	if contentType == "" {
+		contentType = defaultFileContentType
+	}
+	return &FormFile{
+		filename:    filename,
+		contentType: contentType,
+		content:     content,
+	}
+}
+
+// Filename returns the name of the file as sent by the client.
+func (f *FormFile) Filename() string {
+	if f.stream == nil {
+		return f.filename
+	}
+	f.stream.mu.Lock()
+	defer f.stream.mu.Unlock()
+	if f.part == nil {
+		_ = f.stream.open(f)
+	}
+	if f.part == nil {
+		return ""
+	}
+	return f.part.FileName()
+}
+
+// ContentType returns the content type of the file.
+func (f *FormFile) ContentType() string {
+	if f.stream == nil {
+		return f.contentType
+	}
+	f.stream.mu.Lock()
+	defer f.stream.mu.Unlock()
+	if f.part == nil {
+		_ = f.stream.open(f)
+	}
+	if f.part == nil {
+		return ""
+	}
+	if contentType := f.part.Header.Get("Content-Type"); contentType != "" {
+		return contentType
+	}
+	return defaultFileContentType
+}
+
+// Read reads the content of the file.
+func (f *FormFile) Read(p []byte) (int, error) {
+	if f.stream == nil {
+		if f.content == nil {
+			return 0, io.EOF
+		}
+		return f.content.Read(p)
+	}
+	f.stream.mu.Lock()
+	defer f.stream.mu.Unlock()
+	if err := f.stream.open(f); err != nil {
+		return 0, err
+	}
+	n, err := f.part.Read(p)
+	if err == io.EOF {
+		f.eof = true
+	}
+	return n, err
+}
+
+// formStream is the part of multipart body following form fields. It is
+// shared by files of the request.
+type formStream struct {
+	mu      sync.Mutex
+	reader  *multipart.Reader
+	pending *multipart.Part
+	current *FormFile
+	files   map[string]*FormFile
+	fields  map[string]bool
+	err     error
+}
+
+// next returns the next part of the body.
+func (s *formStream) next() (*multipart.Part, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+	if s.pending != nil {
+		part := s.pending
+		s.pending = nil
+		return part, nil
+	}
+	part, err := s.reader.NextPart()
+	if err != nil {
+		if err != io.EOF {
+			err = fmt.Errorf("failed to read multipart body: %w", err)
+		}
+		s.err = err
+		return nil, err
+	}
+	return part, nil
+}
+
+// open advances the stream to the part of file f.
+func (s *formStream) open(f *FormFile) error {
+	for {
+		if f.passed {
+			if f.part == nil || f.eof {
+				return io.EOF
+			}
+			return fmt.Errorf("form file %s was skipped: files must be read in the order they are sent", f.key)
+		}
+		if f == s.current {
+			return nil
+		}
+		part, err := s.next()
+		if s.current != nil {
+			s.current.passed = true
+			s.current = nil
+		}
+		if err == io.EOF {
+			// The rest of files are missing.
+			for _, file := range s.files {
+				file.passed = true
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		name := part.FormName()
+		if s.fields[name] {
+			s.err = fmt.Errorf("form field %s follows files", name)
+			return s.err
+		}
+		file, has := s.files[name]
+		if !has || file.part != nil {
+			// Unknown part or duplicate file, skip it.
+			continue
+		}
+		file.part = part
+		s.current = file
+	}
+}
+
+// writeMultipart writes form fields and files of the request as multipart
+// body. Files are written after form fields in the order of fields.
+func writeMultipart(mw *multipart.Writer, p *preparedType, objValue reflect.Value, values url.Values) error {
+	for _, m := range p.FormMapping {
+		if err := mw.WriteField(m.Key, values.Get(m.Key)); err != nil {
+			return err
+		}
+	}
+	for _, m := range p.FileMapping {
+		file := objValue.Field(m.Field).Interface().(*FormFile)
+		if file == nil {
+			// Send an empty file like browsers do for empty file inputs,
+			// so the server does not skip the files after it looking for it.
+			file = NewFormFile("", "", nil)
+		}
+		header := make(textproto.MIMEHeader)
+		header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="%s"; filename="%s"`, escapeQuotes(m.Key), escapeQuotes(file.filename)))
+		header.Set("Content-Type", file.contentType)
+		w, err := mw.CreatePart(header)
+		if err != nil {
+			return err
+		}
+		if file.content != nil {
+			_, err = io.Copy(w, file.content)
+			if closer, ok := file.content.(io.Closer); ok {
+				if err2 := closer.Close(); err == nil {
+					err = err2
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("failed to send form file %s: %w", m.Key, err)
+			}
+		}
+	}
+	return mw.Close()
+}
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+func escapeQuotes(s string) string {
+	return quoteEscaper.Replace(s)
+}
@@ -0,0 +1,181 @@
+package api2
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// shutdownGracePeriod is how long Shutdown waits for handlers to return
+// after their contexts are canceled.
+const shutdownGracePeriod = time.Second
+
+// Server serves routes and shuts down gracefully: Shutdown stops
+// accepting new requests and waits for in-flight handlers (including
+// streaming responses) to finish before returning.
+type Server struct {
+	mux        *http.ServeMux
+	httpServer *http.Server
+	logger     Logger
+	human      bool
+
+	mu       sync.Mutex
+	draining bool
+	drain    chan struct{}
+	cancels  map[uint64]func()
+	lastKey  uint64
+
+	wg sync.WaitGroup
+}
+
+// NewServer creates Server serving the routes. Options are passed to
+// BindRoutes.
+func NewServer(routes []Route, opts ...Option) *Server {
+	config := NewDefaultConfig()
+	for _, opt := range opts {
+		opt(config)
+	}
+	mux := http.NewServeMux()
+	BindRoutes(mux, routes, opts...)
+	s := &Server{
+		mux:     mux,
+		logger:  config.getLogger(),
+		human:   config.human,
+		drain:   make(chan struct{}),
+		cancels: make(map[uint64]func()),
+	}
+	s.httpServer = &http.Server{Handler: s}
+	return s
+}
+
+// Mux returns http.ServeMux with the routes. Other handlers (e.g. metrics
+// or health checks) can be added to it; their requests are tracked and
+// drained like requests of the routes.
+func (s *Server) Mux() *http.ServeMux {
+	return s.mux
+}
+
+// HTTPServer returns underlying http.Server used by Serve and
+// ListenAndServe. It can be used to set timeouts, TLS config, etc.
+// Do not change its Handler.
+func (s *Server) HTTPServer() *http.Server {
+	return s.httpServer
+}
+
+type drainType struct{}
+
+// Draining returns a channel which is closed when Server starts shutting
+// down. Long-running handlers (e.g. streaming ones) can use it to finish
+// early. If ctx does not come from Server, it returns nil channel, which
+// is never closed.
+func Draining(ctx context.Context) <-chan struct{} {
+	drain, _ := ctx.Value(drainType{}).(chan struct{})
+	return drain
+}
+
+// ServeHTTP implements http.Handler. After Shutdown is called, new
+// requests are rejected with 503 Service Unavailable.
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithCancel(r.Context())
+	defer cancel()
+
+	s.mu.Lock()
+	if s.draining {
+		s.mu.Unlock()
+		w.Header().Set("Connection", "close")
+		if err := jsonError(w, s.human, http.StatusServiceUnavailable, "server is shutting down"); err != nil {
+			s.logger.Log(r.Context(), LevelError, "handler failed to send ServiceUnavailable error to client", "method", r.Method, "path", r.URL.Path, "error", err)
+		}
+		return
+	}
+
+	// Add(1) and Wait() must not be called in parallel.
+	// Call Add(1) under mutex protecting s.draining.
+	s.wg.Add(1)
+	defer s.wg.Done()
+
+	key := s.lastKey
+	s.lastKey++
+	s.cancels[key] = cancel
+	s.mu.Unlock()
+
+	defer func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.cancels, key)
+	}()
+
+	ctx = context.WithValue(ctx, drainType{}, s.drain)
+	s.mux.ServeHTTP(w, r.WithContext(ctx))
+}
+
+// ActiveRequests returns the number of requests being handled.
+func (s *Server) ActiveRequests() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.cancels)
+}
+
+// Serve accepts connections on the listener. After Shutdown it returns
+// http.ErrServerClosed.
+func (s *Server) Serve(l net.Listener) error {
+	return s.httpServer.Serve(l)
+}
+
+// ListenAndServe listens on TCP address addr and serves requests.
+// After Shutdown it returns http.ErrServerClosed.
+func (s *Server) ListenAndServe(addr string) error {
+	s.httpServer.Addr = addr
+	return s.httpServer.ListenAndServe()
+}
+
+// Shutdown stops accepting new requests, closes the channels returned by
+// Draining and waits for in-flight handlers to finish. If ctx expires
+// first, contexts of the remaining handlers are canceled, connections are
+// closed and Shutdown waits for the handlers to return for at most
+// shutdownGracePeriod (1 second); then it returns ctx.Err(). Handlers
+// ignoring their contexts may still be running. Server can not be reused
+// after Shutdown.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.draining {
+		s.draining = true
+		close(s.drain)
+	}
+	s.mu.Unlock()
+
+	// Add(1) and Wait() must not be called in parallel.
+	// By this point, s.draining=true, so no new Add(1) happens.
+	done := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(done)
+	}()
+
+	// Closes listeners and idle connections. It waits for active
+	// connections, but they are tracked more precisely below.
+	err := s.httpServer.Shutdown(ctx)
+
+	select {
+	case <-done:
+		return err
+	case <-ctx.Done():
+	}
+
+	// Deadline exceeded: force remaining handlers to stop.
+	s.mu.Lock()
+	for _, cancel := range s.cancels {
+		cancel()
+	}
+	s.mu.Unlock()
+	_ = s.httpServer.Close()
+	select {
+	case <-done:
+	case <-time.After(shutdownGracePeriod):
+		// Don't hang on handlers ignoring their contexts.
+	}
+
+	return ctx.Err()
+}
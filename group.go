@@ -0,0 +1,82 @@
+package api2
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Group describes properties shared by a set of routes. Method Routes
+// applies them to the routes, so the result is a plain slice of routes,
+// understood by BindRoutes, NewClient and all the generators. Groups can
+// be nested:
+//
+//	routes := api2.Group{Prefix: "/v1"}.Routes(
+//		api2.Group{Prefix: "/billing", Transport: billingTransport}.Routes(billingRoutes),
+//		usersRoutes,
+//	)
+type Group struct {
+	// Prefix is prepended to paths of the routes, e.g. "/v1/billing".
+	// It can contain URL parameters.
+	Prefix string
+
+	// Version is set in routes without Version.
+	Version string
+
+	// Transport is used in routes without Transport.
+	Transport Transport
+
+	// Meta is merged into Meta of each route. Keys set in the route win.
+	Meta map[string]interface{}
+
+	// Interceptors are called before interceptors of each route
+	// (see Route.Interceptors).
+	Interceptors []Interceptor
+}
+
+func joinPath(prefix, path string) string {
+	if path == "" {
+		return prefix
+	}
+	return strings.TrimSuffix(prefix, "/") + path
+}
+
+// Routes returns copies of the routes (concatenated) with the properties
+// of the group applied. The original routes are not modified.
+func (g Group) Routes(routess ...[]Route) []Route {
+	if g.Prefix != "" && !strings.HasPrefix(g.Prefix, "/") {
+		panic(fmt.Sprintf("prefix of group %q must start with '/'", g.Prefix))
+	}
+	var result []Route
+	for _, routes := range routess {
+		for _, route := range routes {
+			if route.Path != "" && !strings.HasPrefix(route.Path, "/") {
+				panic(fmt.Sprintf("path %q in group %q must start with '/'", route.Path, g.Prefix))
+			}
+			route.Path = joinPath(g.Prefix, route.Path)
+			if route.Version == "" {
+				route.Version = g.Version
+			}
+			if route.Transport == nil {
+				route.Transport = g.Transport
+			}
+			if len(g.Meta) != 0 {
+				meta := make(map[string]interface{}, len(g.Meta)+len(route.Meta))
+				for k, v := range g.Meta {
+					meta[k] = v
+				}
+				for k, v := range route.Meta {
+					meta[k] = v
+				}
+				route.Meta = meta
+			}
+			if len(g.Interceptors) != 0 {
+				interceptors := make([]Interceptor, 0, len(g.Interceptors)+len(route.Interceptors))
+				interceptors = append(interceptors, g.Interceptors...)
+				interceptors = append(interceptors, route.Interceptors...)
+				route.Interceptors = interceptors
+			}
+			result = append(result, route)
+		}
+	}
+	return result
+}
@@ -0,0 +1,103 @@
+package api2
+
+import (
+	"context"
+	"net/http"
+)
+
+// CallHandler calls the handler of a route with decoded request.
+// The request is a pointer to Request struct of the route. The response
+// returned is passed to Transport.EncodeResponse and the error - to
+// Transport.EncodeError.
+type CallHandler func(ctx context.Context, req interface{}) (res interface{}, err error)
+
+// Interceptor is called by the server for each request after the request
+// was decoded and before the response is encoded. It receives the matched
+// route, the decoded request and the next element of the chain. It can
+// inspect or modify the request, call next (or not call it at all) and
+// replace the response and the error returned by next.
+type Interceptor func(ctx context.Context, route *Route, req interface{}, next CallHandler) (res interface{}, err error)
+
+// Interceptors adds interceptors to the server. They are called in the
+// order they are passed: the first interceptor is the outermost one.
+// The option can be passed multiple times, interceptors are accumulated.
+func Interceptors(interceptors ...Interceptor) Option {
+	return func(config *Config) {
+		config.interceptors = append(config.interceptors, interceptors...)
+	}
+}
+
+func chainInterceptors(interceptors []Interceptor, route *Route, handler CallHandler) CallHandler {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor := interceptors[i]
+		next := handler
+		handler = func(ctx context.Context, req interface{}) (interface{}, error) {
+			return interceptor(ctx, route, req, next)
+		}
+	}
+	return handler
+}
+
+type routeType struct{}
+
+// RouteFromContext returns the route matched by the server. The route is
+// attached to the context passed to Transport.DecodeRequest, interceptors
+// and the handler.
+func RouteFromContext(ctx context.Context) (*Route, bool) {
+	route, ok := ctx.Value(routeType{}).(*Route)
+	return route, ok
+}
+
+// ClientCall sends the request to the server and decodes the response.
+// Both response and request are pointers to Response and Request structs
+// of the route, as passed to Client.Call.
+type ClientCall func(ctx context.Context, response, request interface{}) error
+
+// ClientInterceptor is called by Client.Call for each call. It receives
+// the route found by the types of request and response, typed request and
+// response and the next element of the chain. It can modify the request,
+// add headers with WithRequestHeader, inspect the response after calling
+// next and replace the error returned by next.
+type ClientInterceptor func(ctx context.Context, route *Route, response, request interface{}, next ClientCall) error
+
+// ClientInterceptors adds interceptors to the client. They are called in
+// the order they are passed: the first interceptor is the outermost one.
+// The option can be passed multiple times, interceptors are accumulated.
+// Static clients pass options to api2.NewClient, so the option can be
+// used with them as well.
+func ClientInterceptors(interceptors ...ClientInterceptor) Option {
+	return func(config *Config) {
+		config.clientInterceptors = append(config.clientInterceptors, interceptors...)
+	}
+}
+
+func chainClientInterceptors(interceptors []ClientInterceptor, route *Route, call ClientCall) ClientCall {
+	for i := len(interceptors) - 1; i >= 0; i-- {
+		interceptor := interceptors[i]
+		next := call
+		call = func(ctx context.Context, response, request interface{}) error {
+			return interceptor(ctx, route, response, request, next)
+		}
+	}
+	return call
+}
+
+type requestHeaderType struct{}
+
+// WithRequestHeader returns a copy of ctx with HTTP header key set to value.
+// Client.Call adds headers from the context to HTTP request after encoding
+// it with the Transport. The function is intended to be used in client
+// interceptors.
+func WithRequestHeader(ctx context.Context, key, value string) context.Context {
+	header := requestHeaderFromContext(ctx).Clone()
+	if header == nil {
+		header = make(http.Header)
+	}
+	header.Set(key, value)
+	return context.WithValue(ctx, requestHeaderType{}, header)
+}
+
+func requestHeaderFromContext(ctx context.Context) http.Header {
+	header, _ := ctx.Value(requestHeaderType{}).(http.Header)
+	return header
+}
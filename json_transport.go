@@ -39,6 +39,24 @@ type JsonTransport struct {
 	// separate JSON field ("detail") as well as its type (in JSON field
 	// "code"). Other errors are reduced to their messages.
 	Errors map[string]error
+
+	// Compression enables compression of responses (if the client accepts
+	// it) and of request bodies sent by Client. See Compression.
+	// Don't set it in shared transports (CsvTransport, SseTransport,
+	// NdjsonTransport): it would affect all their routes. Use a copy made
+	// by WithCompression instead.
+	Compression *Compression
+
+	// ContentType is the media type of responses, used by the OpenAPI
+	// generator. Defaults to "application/json". Requests are documented
+	// as JSON regardless of it.
+	ContentType string
+}
+
+// builtinErrors are errors produced by api2 itself. They are handled as
+// if they were registered in JsonTransport.Errors.
+var builtinErrors = map[string]error{
+	"api2.ValidationError": &ValidationError{},
 }
 
 type humanType struct{}
@@ -51,6 +69,35 @@ func newEncoder(w io.Writer, human bool) *json.Encoder {
 	return encoder
 }
 
+// bodyCodec encodes and decodes the part of requests and responses sent
+// in the body: fields without query, header, cookie, url and use_as_status
+// tags or the field marked with use_as_body.
+type bodyCodec struct {
+	// mediaType is sent in header Accept by clients.
+	mediaType string
+
+	// contentType is set in header Content-Type.
+	contentType string
+
+	encode func(w io.Writer, v interface{}, human bool) error
+	decode func(r io.Reader, v interface{}) error
+
+	// named (optional) wraps the body copied to an anonymous struct before
+	// encoding. name is the name of the original type.
+	named func(v interface{}, name string) interface{}
+}
+
+var jsonCodec = &bodyCodec{
+	mediaType:   "application/json",
+	contentType: "application/json; charset=UTF-8",
+	encode: func(w io.Writer, v interface{}, human bool) error {
+		return newEncoder(w, human).Encode(v)
+	},
+	decode: func(r io.Reader, v interface{}) error {
+		return json.NewDecoder(r).Decode(v)
+	},
+}
+
 func hasHuman(ctx context.Context) bool {
 	if humanValue := ctx.Value(humanType{}); humanValue != nil {
 		return humanValue.(bool)
@@ -58,7 +105,31 @@ func hasHuman(ctx context.Context) bool {
 	return false
 }
 
+// WithCompression returns a copy of the transport with field Compression
+// set, e.g. for a route using CsvTransport:
+//
+//	Transport: api2.CsvTransport.WithCompression(&api2.Compression{})
+func (h *JsonTransport) WithCompression(compression *Compression) *JsonTransport {
+	copied := *h
+	copied.Compression = compression
+	return &copied
+}
+
+func (h *JsonTransport) ContentTypes() []string {
+	if h.ContentType != "" {
+		return []string{h.ContentType}
+	}
+	return []string{jsonCodec.mediaType}
+}
+
 func (h *JsonTransport) DecodeRequest(ctx context.Context, r *http.Request, req interface{}) (context.Context, error) {
+	body, err := decodeContentEncoding(ctx, r.Header, r.Body)
+	if err != nil {
+		return ctx, err
+	}
+	r.Body = body
+	ctx = withResponseEncoding(ctx, r, h.Compression)
+
 	if h.RequestDecoder != nil {
 		return h.RequestDecoder(ctx, r, req)
 	}
@@ -67,7 +138,7 @@ func (h *JsonTransport) DecodeRequest(ctx context.Context, r *http.Request, req
 }
 
 func (h *JsonTransport) RawDecodeRequest(ctx context.Context, r *http.Request, req interface{}) (context.Context, error) {
-	if err := readQueryHeaderCookie(req, r.Body, r.URL.Query(), r, r.Header, 0); err != nil {
+	if err := readQueryHeaderCookie(jsonCodec, req, r.Body, r.URL.Query(), r, r.Header, 0); err != nil {
 		return ctx, err
 	}
 
@@ -75,15 +146,17 @@ func (h *JsonTransport) RawDecodeRequest(ctx context.Context, r *http.Request, r
 }
 
 func (h *JsonTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, res interface{}) error {
-	if h.ResponseEncoder != nil {
-		return h.ResponseEncoder(ctx, w, res)
-	}
+	return compressResponse(ctx, w, h.Compression, func(w http.ResponseWriter) error {
+		if h.ResponseEncoder != nil {
+			return h.ResponseEncoder(ctx, w, res)
+		}
 
-	return h.RawEncodeResponse(ctx, w, res)
+		return h.RawEncodeResponse(ctx, w, res)
+	})
 }
 
 func (h *JsonTransport) RawEncodeResponse(ctx context.Context, w http.ResponseWriter, res interface{}) error {
-	body, err := writeQueryHeaderCookie(w, res, nil, nil, w.Header(), hasHuman(ctx))
+	body, err := writeQueryHeaderCookie(jsonCodec, w, res, nil, nil, w.Header(), hasHuman(ctx))
 	if body != nil {
 		panic("unexpected body")
 	}
@@ -116,6 +189,11 @@ func (h *JsonTransport) EncodeError(ctx context.Context, w http.ResponseWriter,
 	return h.RawEncodeError(ctx, w, err)
 }
 
+func (h *JsonTransport) errorCode(err error) string {
+	_, code := detectErrorType(err, h.Errors)
+	return code
+}
+
 func (h *JsonTransport) RawEncodeError(ctx context.Context, w http.ResponseWriter, err error) error {
 	code := errorToCode(err)
 
@@ -131,6 +209,12 @@ func (h *JsonTransport) EncodeRequest(ctx context.Context, method, urlStr string
 }
 
 func (h *JsonTransport) RawEncodeRequest(ctx context.Context, method, urlStr string, req interface{}) (*http.Request, error) {
+	return encodeRequest(ctx, jsonCodec, h.Compression, method, urlStr, req)
+}
+
+// encodeRequest builds HTTP request from req. The body is encoded with
+// codec and compressed if compression is not nil.
+func encodeRequest(ctx context.Context, codec *bodyCodec, compression *Compression, method, urlStr string, req interface{}) (*http.Request, error) {
 	request, err := http.NewRequestWithContext(ctx, method, urlStr, nil)
 	if err != nil {
 		return nil, err
@@ -144,12 +228,22 @@ func (h *JsonTransport) RawEncodeRequest(ctx context.Context, method, urlStr str
 		human = humanValue.(bool)
 	}
 	var requestBodyBuffer bytes.Buffer
-	body, err := writeQueryHeaderCookie(&requestBodyBuffer, req, query, request, request.Header, human)
+	body, err := writeQueryHeaderCookie(codec, &requestBodyBuffer, req, query, request, request.Header, human)
 	if err != nil {
 		return nil, err
 	}
 	request.URL.RawQuery = query.Encode()
 
+	if compression != nil {
+		compressed, err := compressRequestBody(request, compression, requestBodyBuffer.Bytes(), body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compress request body: %w", err)
+		}
+		if compressed {
+			return request, nil
+		}
+	}
+
 	if body != nil {
 		request.Body = body
 	} else {
@@ -168,6 +262,12 @@ func (h *JsonTransport) RawEncodeRequest(ctx context.Context, method, urlStr str
 }
 
 func (h *JsonTransport) DecodeResponse(ctx context.Context, res *http.Response, response interface{}) error {
+	body, err := decodeContentEncoding(ctx, res.Header, res.Body)
+	if err != nil {
+		return err
+	}
+	res.Body = body
+
 	if h.ResponseDecoder != nil {
 		return h.ResponseDecoder(ctx, res, response)
 	}
@@ -176,7 +276,7 @@ func (h *JsonTransport) DecodeResponse(ctx context.Context, res *http.Response,
 }
 
 func (h *JsonTransport) RawDecodeResponse(ctx context.Context, res *http.Response, response interface{}) error {
-	if err := readQueryHeaderCookie(response, res.Body, nil, nil, res.Header, res.StatusCode); err != nil {
+	if err := readQueryHeaderCookie(jsonCodec, response, res.Body, nil, nil, res.Header, res.StatusCode); err != nil {
 		return err
 	}
 
@@ -184,6 +284,12 @@ func (h *JsonTransport) RawDecodeResponse(ctx context.Context, res *http.Respons
 }
 
 func (h *JsonTransport) DecodeError(ctx context.Context, res *http.Response) error {
+	body, err := decodeContentEncoding(ctx, res.Header, res.Body)
+	if err != nil {
+		return err
+	}
+	res.Body = body
+
 	if h.ErrorDecoder != nil {
 		return h.ErrorDecoder(ctx, res)
 	}
@@ -203,8 +309,7 @@ func (h *JsonTransport) RawDecodeError(ctx context.Context, res *http.Response)
 	}
 
 	errType := msg.Code
-	errSample, has := h.Errors[errType]
-	if has {
+	if errSample, has := registeredError(h.Errors, errType); has {
 		errPtrValue := reflect.New(reflect.TypeOf(errSample))
 		if err := json.Unmarshal(msg.Detail, errPtrValue.Interface()); err != nil {
 			return fmt.Errorf("failed to decode error message %s of type %s: %v", string(msg.Detail), errType, err)
@@ -217,6 +322,16 @@ func (h *JsonTransport) RawDecodeError(ctx context.Context, res *http.Response)
 	return fmt.Errorf("API returned error with HTTP status %s: %v", res.Status, msg.Error)
 }
 
+// registeredError returns the sample of the error type registered under
+// the name in errors (see JsonTransport.Errors) or in builtinErrors.
+func registeredError(errors map[string]error, name string) (error, bool) {
+	if errSample, has := errors[name]; has {
+		return errSample, true
+	}
+	errSample, has := builtinErrors[name]
+	return errSample, has
+}
+
 func detectErrorType(err error, registeredErrors map[string]error) (error, string) {
 	for k, v := range registeredErrors {
 		if reflect.TypeOf(v) == reflect.TypeOf(err) {
@@ -230,8 +345,18 @@ func detectErrorType(err error, registeredErrors map[string]error) (error, strin
 	return detectErrorType(err, registeredErrors)
 }
 
+// detectRegisteredError finds the error of a type registered in errors
+// or in builtinErrors in the chain of err.
+func detectRegisteredError(err error, errors map[string]error) (error, string) {
+	unwrapped, errType := detectErrorType(err, errors)
+	if errType == "" {
+		unwrapped, errType = detectErrorType(err, builtinErrors)
+	}
+	return unwrapped, errType
+}
+
 func (h *JsonTransport) jsonError(w http.ResponseWriter, human bool, code int, err error) error {
-	unwrapped, errType := detectErrorType(err, h.Errors)
+	unwrapped, errType := detectRegisteredError(err, h.Errors)
 
 	msg := errorMessage{Error: fmt.Sprintf("%v", err)}
 	if errType != "" {
@@ -298,6 +423,8 @@ type preparedType struct {
 	HeaderMapping []strMapping
 	CookieMapping []strMapping
 	UrlMapping    []strMapping
+	FormMapping   []strMapping
+	FileMapping   []strMapping
 	JsonMapping   []intMapping
 	TypeForJson   reflect.Type
 	BodyField     int
@@ -305,8 +432,11 @@ type preparedType struct {
 	Protobuf      bool
 	Stream        bool
 	Raw           bool
+	Chan          bool
+	WsInField     int
+	WsOutField    int
 
-	// Special fields are query, header, cookie and status.
+	// Special fields are query, header, cookie, url, form, form_file, ws and status.
 	NoJsonFields    bool
 	NoSpecialFields bool
 }
@@ -314,7 +444,7 @@ type preparedType struct {
 const noField = -1
 
 func prepare(objType reflect.Type) *preparedType {
-	p := &preparedType{BodyField: noField, StatusField: noField}
+	p := &preparedType{BodyField: noField, StatusField: noField, WsInField: noField, WsOutField: noField}
 	jsonFields := make([]reflect.StructField, 0, objType.NumField())
 	for i := 0; i < objType.NumField(); i++ {
 		field := objType.Field(i)
@@ -326,6 +456,9 @@ func prepare(objType reflect.Type) *preparedType {
 		headerKey := field.Tag.Get("header")
 		cookieKey := field.Tag.Get("cookie")
 		urlKey := field.Tag.Get("url")
+		formKey := field.Tag.Get("form")
+		fileKey := field.Tag.Get("form_file")
+		wsKey := field.Tag.Get("ws")
 		isBodyField := field.Tag.Get("use_as_body") == "true"
 		isStatusField := field.Tag.Get("use_as_status") == "true"
 		if isBodyField {
@@ -353,8 +486,23 @@ func prepare(objType reflect.Type) *preparedType {
 				Field: i,
 				Key:   urlKey,
 			})
+		} else if formKey != "" {
+			p.FormMapping = append(p.FormMapping, strMapping{
+				Field: i,
+				Key:   formKey,
+			})
+		} else if fileKey != "" {
+			p.FileMapping = append(p.FileMapping, strMapping{
+				Field: i,
+				Key:   fileKey,
+			})
+		} else if wsKey == "in" {
+			p.WsInField = i
+		} else if wsKey == "out" {
+			p.WsOutField = i
 		} else if isBodyField {
 			p.BodyField = i
+			p.Chan = field.Type.Kind() == reflect.Chan
 		} else if isStatusField {
 			p.StatusField = i
 		} else {
@@ -370,14 +518,16 @@ func prepare(objType reflect.Type) *preparedType {
 		p.TypeForJson = reflect.StructOf(jsonFields)
 	}
 
-	statusFields := 0
-	if p.StatusField != noField {
-		statusFields = 1
+	otherFields := 0
+	for _, field := range []int{p.StatusField, p.WsInField, p.WsOutField} {
+		if field != noField {
+			otherFields++
+		}
 	}
-	if len(p.QueryMapping)+len(p.HeaderMapping)+len(p.CookieMapping)+len(p.UrlMapping)+statusFields == objType.NumField() {
+	if len(p.QueryMapping)+len(p.HeaderMapping)+len(p.CookieMapping)+len(p.UrlMapping)+len(p.FormMapping)+len(p.FileMapping)+otherFields == objType.NumField() {
 		p.NoJsonFields = true
 	}
-	if len(p.QueryMapping) == 0 && len(p.HeaderMapping) == 0 && len(p.CookieMapping) == 0 && len(p.UrlMapping) == 0 && p.StatusField == noField {
+	if len(p.QueryMapping) == 0 && len(p.HeaderMapping) == 0 && len(p.CookieMapping) == 0 && len(p.UrlMapping) == 0 && len(p.FormMapping) == 0 && len(p.FileMapping) == 0 && otherFields == 0 {
 		p.NoSpecialFields = true
 	}
 	return p
@@ -415,10 +565,10 @@ type headerWriter interface {
 	WriteHeader(statusCode int)
 }
 
-func writeQueryHeaderCookie(w io.Writer, objPtr interface{}, query url.Values, request *http.Request, header http.Header, human bool) (io.ReadCloser, error) {
-	header.Set("Content-Type", "application/json; charset=UTF-8")
+func writeQueryHeaderCookie(codec *bodyCodec, w io.Writer, objPtr interface{}, query url.Values, request *http.Request, header http.Header, human bool) (io.ReadCloser, error) {
+	header.Set("Content-Type", codec.contentType)
 	if request != nil {
-		request.Header.Set("Accept", "application/json")
+		request.Header.Set("Accept", codec.mediaType)
 	}
 
 	objType := reflect.TypeOf(objPtr).Elem()
@@ -452,6 +602,9 @@ func writeQueryHeaderCookie(w io.Writer, objPtr interface{}, query url.Values, r
 			forJson.Field(m.JsonField).Set(objValue.Field(m.OrigField))
 		}
 		bodyPtr = forJson.Addr().Interface()
+		if codec.named != nil && objType.Name() != "" {
+			bodyPtr = codec.named(bodyPtr, objType.Name())
+		}
 	}
 
 	for _, m := range p.QueryMapping {
@@ -526,7 +679,15 @@ func writeQueryHeaderCookie(w io.Writer, objPtr interface{}, query url.Values, r
 		w.(headerWriter).WriteHeader(status)
 	}
 
-	if p.Protobuf {
+	if len(p.FormMapping) != 0 || len(p.FileMapping) != 0 {
+		if request == nil {
+			return nil, fmt.Errorf("form fields can only be used in requests")
+		}
+		return writeForm(p, objValue, w, header)
+	} else if p.Chan {
+		// Records are streamed by the transport, see NdjsonTransport.
+		return nil, nil
+	} else if p.Protobuf {
 		bodyPtrMessage, ok := bodyPtr.(proto.Message)
 		if !ok {
 			panic("protobuf field is not of type proto.Message")
@@ -564,11 +725,11 @@ func writeQueryHeaderCookie(w io.Writer, objPtr interface{}, query url.Values, r
 		_, err := w.Write(*bodyPtr.(*[]byte))
 		return nil, err
 	} else {
-		return nil, newEncoder(w, human).Encode(bodyPtr)
+		return nil, codec.encode(w, bodyPtr, human)
 	}
 }
 
-func readQueryHeaderCookie(objPtr interface{}, bodyReadCloser io.ReadCloser, query url.Values, request *http.Request, header http.Header, status int) error {
+func readQueryHeaderCookie(codec *bodyCodec, objPtr interface{}, bodyReadCloser io.ReadCloser, query url.Values, request *http.Request, header http.Header, status int) error {
 	objType := reflect.TypeOf(objPtr).Elem()
 	p0, has := prepared.Load(objType)
 	if !has {
@@ -583,7 +744,16 @@ func readQueryHeaderCookie(objPtr interface{}, bodyReadCloser io.ReadCloser, que
 		fieldValue := objValue.Field(p.StatusField)
 		fieldValue.SetInt(int64(status))
 	}
-	if p.BodyField != noField {
+	if len(p.FormMapping) != 0 || len(p.FileMapping) != 0 {
+		if request == nil {
+			return fmt.Errorf("form fields can only be used in requests")
+		}
+		if err := readForm(p, objValue, bodyReadCloser, header); err != nil {
+			return err
+		}
+	} else if p.Chan {
+		// Records are streamed by the transport, see NdjsonTransport.
+	} else if p.BodyField != noField {
 		// 'use_as_body' case.
 		fieldValue := objValue.Field(p.BodyField)
 		if !p.Stream && !p.Raw {
@@ -619,7 +789,7 @@ func readQueryHeaderCookie(objPtr interface{}, bodyReadCloser io.ReadCloser, que
 			}
 			fieldValue.Set(reflect.ValueOf(buf))
 		} else {
-			if err := json.NewDecoder(bodyReadCloser).Decode(bodyPtr); err != nil {
+			if err := codec.decode(bodyReadCloser, bodyPtr); err != nil {
 				return err
 			}
 		}
@@ -627,14 +797,14 @@ func readQueryHeaderCookie(objPtr interface{}, bodyReadCloser io.ReadCloser, que
 		// In this case JSON parsing is skipped.
 	} else if p.NoSpecialFields {
 		// Parse JSON into the original structure.
-		if err := json.NewDecoder(bodyReadCloser).Decode(objPtr); err != nil {
+		if err := codec.decode(bodyReadCloser, objPtr); err != nil {
 			return err
 		}
 	} else {
 		// JSON fields mixed with header and/or query fields.
 		// Parse JSON into a temporary struct and copy fields into the original struct.
 		jsonPtrValue := reflect.New(p.TypeForJson)
-		if err := json.NewDecoder(bodyReadCloser).Decode(jsonPtrValue.Interface()); err != nil {
+		if err := codec.decode(bodyReadCloser, jsonPtrValue.Interface()); err != nil {
 			return err
 		}
 		jsonValue := jsonPtrValue.Elem()
@@ -643,8 +813,9 @@ func readQueryHeaderCookie(objPtr interface{}, bodyReadCloser io.ReadCloser, que
 		}
 	}
 
-	if !p.Stream {
+	if !p.Stream && !p.Chan && len(p.FileMapping) == 0 {
 		// Drain the reader in case we skipped parsing or something is left.
+		// Files and records are read from the body later.
 		if _, err := io.Copy(io.Discard, bodyReadCloser); err != nil {
 			return err
 		}
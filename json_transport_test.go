@@ -674,7 +674,7 @@ func TestQueryAndHeader(t *testing.T) {
 		var gotStatus int
 		getBody := func(objPtr interface{}) ([]byte, error) {
 			bodyBuffer := httptest.NewRecorder()
-			bodyReadCloser, err := writeQueryHeaderCookie(bodyBuffer, objPtr, query, request, header, false)
+			bodyReadCloser, err := writeQueryHeaderCookie(jsonCodec, bodyBuffer, objPtr, query, request, header, false)
 			if err != nil {
 				return nil, fmt.Errorf("writeQueryHeaderCookie failed: %w", err)
 			}
@@ -729,7 +729,7 @@ func TestQueryAndHeader(t *testing.T) {
 
 		objPtr2 := reflect.New(reflect.TypeOf(tc.objPtr).Elem()).Interface()
 		bodyReadCloser2 := io.NopCloser(bytes.NewReader(bodyBytes))
-		if err := readQueryHeaderCookie(objPtr2, bodyReadCloser2, query, request, header, gotStatus); err != nil {
+		if err := readQueryHeaderCookie(jsonCodec, objPtr2, bodyReadCloser2, query, request, header, gotStatus); err != nil {
 			t.Errorf("case %d: readQueryHeaderCookie failed: %v", i, err)
 		}
 
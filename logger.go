@@ -0,0 +1,196 @@
+package api2
+
+import (
+	"bufio"
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"path"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+// LogLevel is the severity of a log record. The values are the same as
+// of slog.Level, so they can be converted directly.
+type LogLevel int
+
+const (
+	LevelDebug LogLevel = -4
+	LevelInfo  LogLevel = 0
+	LevelWarn  LogLevel = 4
+	LevelError LogLevel = 8
+)
+
+func (l LogLevel) String() string {
+	switch l {
+	case LevelDebug:
+		return "DEBUG"
+	case LevelInfo:
+		return "INFO"
+	case LevelWarn:
+		return "WARN"
+	case LevelError:
+		return "ERROR"
+	default:
+		return fmt.Sprintf("LEVEL(%d)", int(l))
+	}
+}
+
+// Logger receives structured log records from server and client.
+// keyvals are alternating keys (strings) and values, like in
+// slog.Logger.Log. The following keys are used:
+//   - "method": HTTP method;
+//   - "path": path of HTTP request;
+//   - "route": path template of the route, e.g. "/users/:id";
+//   - "handler": name of handler as Service.Method (see GetFnInfo);
+//   - "status": HTTP status of the response;
+//   - "latency": time.Duration spent serving the request;
+//   - "error": the error, if any;
+//   - "error_code": the key of the error in JsonTransport.Errors;
+//   - "stack": stack trace of a panic.
+//
+// The server emits one record per request: LevelInfo if it succeeded and
+// LevelError otherwise. The client emits one record per call: LevelInfo
+// if it succeeded and LevelWarn otherwise.
+type Logger interface {
+	Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{})
+}
+
+// StructuredLogger sets the logger of server and client. If it is not
+// set, log records of level LevelError and above are passed to the
+// function set by ErrorLogger (log.Printf by default).
+func StructuredLogger(logger Logger) Option {
+	return func(config *Config) {
+		config.logger = logger
+	}
+}
+
+type printfLogger struct {
+	printf func(format string, args ...interface{})
+}
+
+// PrintfLogger converts a printf-like function to Logger. Records with
+// level below LevelError are dropped (the printf logger historically
+// received only errors). A record is formatted as "<method> <path> <msg>:
+// <error>" followed by the stack trace, if any. Other keys are dropped.
+func PrintfLogger(printf func(format string, args ...interface{})) Logger {
+	return printfLogger{printf: printf}
+}
+
+func (l printfLogger) Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	if level < LevelError {
+		return
+	}
+	var method, urlPath, err, stack interface{}
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		switch keyvals[i] {
+		case "method":
+			method = keyvals[i+1]
+		case "path":
+			urlPath = keyvals[i+1]
+		case "error":
+			err = keyvals[i+1]
+		case "stack":
+			stack = keyvals[i+1]
+		}
+	}
+	line := msg
+	if urlPath != nil {
+		line = fmt.Sprintf("%v %s", urlPath, line)
+	}
+	if method != nil {
+		line = fmt.Sprintf("%v %s", method, line)
+	}
+	if err != nil {
+		line = fmt.Sprintf("%s: %v", line, err)
+	}
+	if stack != nil {
+		line = fmt.Sprintf("%s\n%s", line, stack)
+	}
+	l.printf("%s", line)
+}
+
+func (c *Config) getLogger() Logger {
+	if c.logger != nil {
+		return c.logger
+	}
+	return PrintfLogger(c.errorf)
+}
+
+// handlerName returns Service.Method name of a handler using GetFnInfo.
+// For functions which are not methods, it returns the name of the function.
+func handlerName(handler interface{}) string {
+	if _, ok := handler.(FuncInfoer); !ok {
+		funcName := runtime.FuncForPC(reflect.ValueOf(handler).Pointer()).Name()
+		if !strings.HasSuffix(funcName, "-fm") {
+			// Not a method value, GetFnInfo can not parse it.
+			return path.Base(funcName)
+		}
+	}
+	info := GetFnInfo(handler)
+	return info.StructName + "." + info.Method
+}
+
+// errorCoder is implemented by transports with registered errors.
+type errorCoder interface {
+	// errorCode returns the key of the error in the registry of errors
+	// of the transport or "" if the error is not registered.
+	errorCode(err error) string
+}
+
+// errorCode returns the key of the error in JsonTransport.Errors.
+func errorCode(t Transport, err error) string {
+	if coder, ok := t.(errorCoder); ok {
+		if code := coder.errorCode(err); code != "" {
+			return code
+		}
+	}
+	_, code := detectErrorType(err, builtinErrors)
+	return code
+}
+
+// statusWriter remembers HTTP status written to http.ResponseWriter.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(statusCode int) {
+	if w.status == 0 {
+		w.status = statusCode
+	}
+	w.ResponseWriter.WriteHeader(statusCode)
+}
+
+func (w *statusWriter) Write(p []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+	return w.ResponseWriter.Write(p)
+}
+
+func (w *statusWriter) Flush() {
+	if f, ok := w.ResponseWriter.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// Hijack is used by WebSocketTransport.
+func (w *statusWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := w.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("http.ResponseWriter does not implement http.Hijacker")
+	}
+	conn, brw, err := hijacker.Hijack()
+	if err == nil && w.status == 0 {
+		w.status = http.StatusSwitchingProtocols
+	}
+	return conn, brw, err
+}
+
+// Unwrap is used by http.ResponseController.
+func (w *statusWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,30 @@
+package api2
+
+import (
+	"time"
+)
+
+// MetricsCollector receives per-route measurements from server and client.
+// Routes are identified by Route.Method and Route.Path (the path template
+// with :params, not the actual URL). Package
+// github.com/starius/api2/metrics provides an implementation exposing
+// the metrics in Prometheus text format.
+type MetricsCollector interface {
+	// RequestStarted is called when the server starts handling a request
+	// or when the client starts a call.
+	RequestStarted(route *Route)
+
+	// RequestFinished is called when the request handling or the call is
+	// finished. status is HTTP status (0 if the client got no response),
+	// errorCode is the key of the error in JsonTransport.Errors (empty if
+	// there is no error or it is not registered).
+	RequestFinished(route *Route, status int, errorCode string, err error, latency time.Duration)
+}
+
+// Metrics sets the collector fed by server or client. Use separate
+// collectors for server and client.
+func Metrics(collector MetricsCollector) Option {
+	return func(config *Config) {
+		config.metrics = collector
+	}
+}
@@ -0,0 +1,327 @@
+package metrics
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/starius/api2"
+)
+
+// DefaultBuckets are upper bounds (in seconds) of buckets of latency
+// histograms. They are the same as in Prometheus client library.
+var DefaultBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+type routeKey struct {
+	method string
+	route  string
+}
+
+type statusKey struct {
+	routeKey
+	status int
+}
+
+type errorKey struct {
+	statusKey
+	code string
+}
+
+type histogram struct {
+	// counts[i] is the number of observations in bucket i (not cumulative).
+	// The last element is for observations above all the buckets.
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Metrics collects per-route metrics of api2 server or client and serves
+// them in Prometheus text exposition format. It implements interfaces
+// api2.MetricsCollector and http.Handler.
+//
+// The following metrics are provided (prefixed with namespace):
+//   - requests_total{method,route,status}: counter of finished requests;
+//   - errors_total{method,route,status,code}: counter of failed requests;
+//     code is the key of the error in JsonTransport.Errors;
+//   - in_flight{method,route}: gauge of requests being handled;
+//   - request_duration_seconds{method,route}: histogram of latencies;
+//   - concurrency_in_flight{limiter}, concurrency_queue_depth{limiter}:
+//     gauges of limiters added with ObserveConcurrency.
+type Metrics struct {
+	namespace string
+	buckets   []float64
+
+	mu        sync.Mutex
+	requests  map[statusKey]uint64
+	errors    map[errorKey]uint64
+	inFlight  map[routeKey]int64
+	latencies map[routeKey]*histogram
+	limiters  map[string]*api2.ConcurrencyLimiter
+}
+
+// New creates Metrics. Namespace is the prefix of metrics names, e.g.
+// "api2_server" or "api2_client". If buckets are not passed,
+// DefaultBuckets are used.
+func New(namespace string, buckets ...float64) *Metrics {
+	if len(buckets) == 0 {
+		buckets = DefaultBuckets
+	}
+	buckets = append([]float64(nil), buckets...)
+	sort.Float64s(buckets)
+	return &Metrics{
+		namespace: namespace,
+		buckets:   buckets,
+		requests:  make(map[statusKey]uint64),
+		errors:    make(map[errorKey]uint64),
+		inFlight:  make(map[routeKey]int64),
+		latencies: make(map[routeKey]*histogram),
+		limiters:  make(map[string]*api2.ConcurrencyLimiter),
+	}
+}
+
+// ObserveConcurrency adds gauges of the number of requests in flight and
+// the depth of the queue of the limiter, labelled with name.
+func (m *Metrics) ObserveConcurrency(name string, limiter *api2.ConcurrencyLimiter) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.limiters[name] = limiter
+}
+
+func (m *Metrics) RequestStarted(route *api2.Route) {
+	key := routeKey{method: route.Method, route: route.Path}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.inFlight[key]++
+}
+
+func (m *Metrics) RequestFinished(route *api2.Route, status int, errorCode string, err error, latency time.Duration) {
+	key := routeKey{method: route.Method, route: route.Path}
+	sKey := statusKey{routeKey: key, status: status}
+	seconds := latency.Seconds()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	m.inFlight[key]--
+	m.requests[sKey]++
+	if err != nil {
+		m.errors[errorKey{statusKey: sKey, code: errorCode}]++
+	}
+
+	h, has := m.latencies[key]
+	if !has {
+		h = &histogram{counts: make([]uint64, len(m.buckets)+1)}
+		m.latencies[key] = h
+	}
+	bucket := sort.SearchFloat64s(m.buckets, seconds)
+	h.counts[bucket]++
+	h.sum += seconds
+	h.count++
+}
+
+// ServeHTTP writes the metrics in Prometheus text exposition format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	Handler(m).ServeHTTP(w, r)
+}
+
+// Handler returns http.Handler serving the metrics of several instances
+// of Metrics (e.g. of server and client) in Prometheus text format.
+// The instances must have different namespaces, otherwise the names of
+// metrics would be repeated; Handler panics if they don't.
+func Handler(ms ...*Metrics) http.Handler {
+	namespaces := make(map[string]bool, len(ms))
+	for _, m := range ms {
+		if namespaces[m.namespace] {
+			panic(fmt.Sprintf("metrics: namespace %q is used by several instances of Metrics", m.namespace))
+		}
+		namespaces[m.namespace] = true
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+		for _, m := range ms {
+			if _, err := m.WriteTo(w); err != nil {
+				return
+			}
+		}
+	})
+}
+
+// WriteTo writes the metrics in Prometheus text exposition format.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	cw := &countingWriter{w: w}
+	bw := bufio.NewWriter(cw)
+
+	m.mu.Lock()
+	m.writeRequests(bw)
+	m.writeErrors(bw)
+	m.writeInFlight(bw)
+	m.writeLatencies(bw)
+	m.writeLimiters(bw)
+	m.mu.Unlock()
+
+	err := bw.Flush()
+	return cw.n, err
+}
+
+func (m *Metrics) writeHeader(w io.Writer, name, help, typ string) {
+	fmt.Fprintf(w, "# HELP %s_%s %s\n", m.namespace, name, help)
+	fmt.Fprintf(w, "# TYPE %s_%s %s\n", m.namespace, name, typ)
+}
+
+func (m *Metrics) writeRequests(w io.Writer) {
+	keys := make([]statusKey, 0, len(m.requests))
+	for key := range m.requests {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return lessStatus(keys[i], keys[j])
+	})
+	m.writeHeader(w, "requests_total", "Number of finished requests.", "counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s_requests_total{%s} %d\n", m.namespace, labels(
+			"method", key.method,
+			"route", key.route,
+			"status", strconv.Itoa(key.status),
+		), m.requests[key])
+	}
+}
+
+func (m *Metrics) writeErrors(w io.Writer) {
+	keys := make([]errorKey, 0, len(m.errors))
+	for key := range m.errors {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].statusKey != keys[j].statusKey {
+			return lessStatus(keys[i].statusKey, keys[j].statusKey)
+		}
+		return keys[i].code < keys[j].code
+	})
+	m.writeHeader(w, "errors_total", "Number of failed requests.", "counter")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s_errors_total{%s} %d\n", m.namespace, labels(
+			"method", key.method,
+			"route", key.route,
+			"status", strconv.Itoa(key.status),
+			"code", key.code,
+		), m.errors[key])
+	}
+}
+
+func (m *Metrics) writeInFlight(w io.Writer) {
+	keys := make([]routeKey, 0, len(m.inFlight))
+	for key := range m.inFlight {
+		keys = append(keys, key)
+	}
+	sortRouteKeys(keys)
+	m.writeHeader(w, "in_flight", "Number of requests being handled.", "gauge")
+	for _, key := range keys {
+		fmt.Fprintf(w, "%s_in_flight{%s} %d\n", m.namespace, labels(
+			"method", key.method,
+			"route", key.route,
+		), m.inFlight[key])
+	}
+}
+
+func (m *Metrics) writeLatencies(w io.Writer) {
+	keys := make([]routeKey, 0, len(m.latencies))
+	for key := range m.latencies {
+		keys = append(keys, key)
+	}
+	sortRouteKeys(keys)
+	m.writeHeader(w, "request_duration_seconds", "Latency of requests in seconds.", "histogram")
+	for _, key := range keys {
+		h := m.latencies[key]
+		var cumulative uint64
+		for i, count := range h.counts {
+			cumulative += count
+			le := "+Inf"
+			if i < len(m.buckets) {
+				le = formatFloat(m.buckets[i])
+			}
+			fmt.Fprintf(w, "%s_request_duration_seconds_bucket{%s} %d\n", m.namespace, labels(
+				"method", key.method,
+				"route", key.route,
+				"le", le,
+			), cumulative)
+		}
+		routeLabels := labels("method", key.method, "route", key.route)
+		fmt.Fprintf(w, "%s_request_duration_seconds_sum{%s} %s\n", m.namespace, routeLabels, formatFloat(h.sum))
+		fmt.Fprintf(w, "%s_request_duration_seconds_count{%s} %d\n", m.namespace, routeLabels, h.count)
+	}
+}
+
+func (m *Metrics) writeLimiters(w io.Writer) {
+	if len(m.limiters) == 0 {
+		return
+	}
+	names := make([]string, 0, len(m.limiters))
+	for name := range m.limiters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	m.writeHeader(w, "concurrency_in_flight", "Number of requests holding slots of concurrency limiter.", "gauge")
+	for _, name := range names {
+		fmt.Fprintf(w, "%s_concurrency_in_flight{%s} %d\n", m.namespace, labels("limiter", name), m.limiters[name].InFlight())
+	}
+	m.writeHeader(w, "concurrency_queue_depth", "Number of requests waiting for slots of concurrency limiter.", "gauge")
+	for _, name := range names {
+		fmt.Fprintf(w, "%s_concurrency_queue_depth{%s} %d\n", m.namespace, labels("limiter", name), m.limiters[name].QueueDepth())
+	}
+}
+
+func lessRoute(a, b routeKey) bool {
+	if a.route != b.route {
+		return a.route < b.route
+	}
+	return a.method < b.method
+}
+
+func lessStatus(a, b statusKey) bool {
+	if a.routeKey != b.routeKey {
+		return lessRoute(a.routeKey, b.routeKey)
+	}
+	return a.status < b.status
+}
+
+func sortRouteKeys(keys []routeKey) {
+	sort.Slice(keys, func(i, j int) bool {
+		return lessRoute(keys[i], keys[j])
+	})
+}
+
+var labelValueReplacer = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labels(keyvals ...string) string {
+	parts := make([]string, 0, len(keyvals)/2)
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		parts = append(parts, fmt.Sprintf(`%s="%s"`, keyvals[i], labelValueReplacer.Replace(keyvals[i+1])))
+	}
+	return strings.Join(parts, ",")
+}
+
+func formatFloat(f float64) string {
+	if math.IsInf(f, +1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
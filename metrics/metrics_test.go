@@ -0,0 +1,139 @@
+package metrics
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+type NotFound struct {
+	ID string `json:"id"`
+}
+
+func (e NotFound) Error() string {
+	return "not found: " + e.ID
+}
+
+func (e NotFound) HttpCode() int {
+	return http.StatusNotFound
+}
+
+func TestMetrics(t *testing.T) {
+	type GetRequest struct {
+		ID string `url:"id"`
+	}
+	type GetResponse struct {
+	}
+
+	getHandler := func(ctx context.Context, req *GetRequest) (res *GetResponse, err error) {
+		if req.ID != "1" {
+			return nil, NotFound{ID: req.ID}
+		}
+		return &GetResponse{}, nil
+	}
+
+	routes := []api2.Route{
+		{
+			Method:  http.MethodGet,
+			Path:    "/items/:id",
+			Handler: getHandler,
+			Transport: &api2.JsonTransport{
+				Errors: map[string]error{
+					"NotFound": NotFound{},
+				},
+			},
+		},
+	}
+
+	serverMetrics := New("api2_server", 0.1, 1)
+	clientMetrics := New("api2_client")
+
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes, api2.Metrics(serverMetrics))
+	mux.Handle("/metrics", Handler(serverMetrics, clientMetrics))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL, api2.Metrics(clientMetrics))
+
+	ctx := context.Background()
+	require.NoError(t, client.Call(ctx, &GetResponse{}, &GetRequest{ID: "1"}))
+	require.NoError(t, client.Call(ctx, &GetResponse{}, &GetRequest{ID: "1"}))
+	require.Error(t, client.Call(ctx, &GetResponse{}, &GetRequest{ID: "2"}))
+
+	scrape := func() string {
+		res, err := http.Get(server.URL + "/metrics")
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, "text/plain; version=0.0.4; charset=utf-8", res.Header.Get("Content-Type"))
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return string(body)
+	}
+
+	// The server updates metrics after sending the response.
+	var text string
+	require.Eventually(t, func() bool {
+		text = scrape()
+		return strings.Contains(text, `api2_server_request_duration_seconds_count{method="GET",route="/items/:id"} 3`)
+	}, time.Second, time.Millisecond)
+
+	wantLines := []string{
+		`# TYPE api2_server_requests_total counter`,
+		`api2_server_requests_total{method="GET",route="/items/:id",status="200"} 2`,
+		`api2_server_requests_total{method="GET",route="/items/:id",status="404"} 1`,
+		`api2_server_errors_total{method="GET",route="/items/:id",status="404",code="NotFound"} 1`,
+		`api2_server_in_flight{method="GET",route="/items/:id"} 0`,
+		`# TYPE api2_server_request_duration_seconds histogram`,
+		`api2_server_request_duration_seconds_bucket{method="GET",route="/items/:id",le="0.1"} 3`,
+		`api2_server_request_duration_seconds_bucket{method="GET",route="/items/:id",le="1"} 3`,
+		`api2_server_request_duration_seconds_bucket{method="GET",route="/items/:id",le="+Inf"} 3`,
+		`api2_client_requests_total{method="GET",route="/items/:id",status="200"} 2`,
+		`api2_client_errors_total{method="GET",route="/items/:id",status="404",code="NotFound"} 1`,
+		`api2_client_request_duration_seconds_bucket{method="GET",route="/items/:id",le="10"} 3`,
+	}
+	for _, line := range wantLines {
+		require.Contains(t, text, line+"\n")
+	}
+	require.NotContains(t, text, "/items/1")
+}
+
+func TestHandlerDuplicateNamespace(t *testing.T) {
+	require.Panics(t, func() {
+		Handler(New("api2_server"), New("api2_server"))
+	})
+	require.NotPanics(t, func() {
+		Handler(New("api2_server"), New("api2_client"))
+	})
+}
+
+func TestLabelEscaping(t *testing.T) {
+	m := New("test")
+	route := &api2.Route{Method: "GET", Path: "/a\"b\\c\nd"}
+	m.RequestStarted(route)
+	m.RequestFinished(route, 500, "", fmt.Errorf("failed"), time.Millisecond)
+
+	var buf strings.Builder
+	_, err := m.WriteTo(&buf)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), `test_requests_total{method="GET",route="/a\"b\\c\nd",status="500"} 1`)
+}
+
+func TestObserveConcurrency(t *testing.T) {
+	m := New("test")
+	m.ObserveConcurrency("exports", &api2.ConcurrencyLimiter{MaxInFlight: 1})
+
+	var buf strings.Builder
+	_, err := m.WriteTo(&buf)
+	require.NoError(t, err)
+	require.Contains(t, buf.String(), "# TYPE test_concurrency_in_flight gauge\n")
+	require.Contains(t, buf.String(), `test_concurrency_in_flight{limiter="exports"} 0`+"\n")
+	require.Contains(t, buf.String(), `test_concurrency_queue_depth{limiter="exports"} 0`+"\n")
+}
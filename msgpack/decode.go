@@ -0,0 +1,609 @@
+package msgpack
+
+import (
+	"encoding"
+	"fmt"
+	"math"
+	"reflect"
+	"strings"
+	"time"
+)
+
+// maxDepth limits nesting of decoded values to protect the stack.
+const maxDepth = 10000
+
+type family int
+
+const (
+	familyNil family = iota
+	familyBool
+	familyInt
+	familyUint
+	familyFloat
+	familyStr
+	familyBin
+	familyArray
+	familyMap
+	familyExt
+)
+
+var familyNames = map[family]string{
+	familyNil:   "nil",
+	familyBool:  "bool",
+	familyInt:   "int",
+	familyUint:  "uint",
+	familyFloat: "float",
+	familyStr:   "str",
+	familyBin:   "bin",
+	familyArray: "array",
+	familyMap:   "map",
+	familyExt:   "ext",
+}
+
+// token is the header of an encoded value.
+type token struct {
+	family family
+	b      bool
+	i      int64
+	u      uint64
+	f      float64
+
+	// n is the length of str, bin or ext data or the number of elements
+	// of array or map.
+	n int
+
+	ext int8
+}
+
+type decoder struct {
+	data  []byte
+	pos   int
+	depth int
+}
+
+func (d *decoder) errorf(format string, a ...interface{}) error {
+	return fmt.Errorf("msgpack: "+format+" (offset %d)", append(a, d.pos)...)
+}
+
+func (d *decoder) mismatch(tok token, t reflect.Type) error {
+	return d.errorf("cannot unmarshal %s into Go value of type %s", familyNames[tok.family], t)
+}
+
+func (d *decoder) bytes(n int) ([]byte, error) {
+	if n < 0 || n > len(d.data)-d.pos {
+		return nil, d.errorf("unexpected end of data")
+	}
+	b := d.data[d.pos : d.pos+n]
+	d.pos += n
+	return b, nil
+}
+
+func (d *decoder) uint(size int) (uint64, error) {
+	b, err := d.bytes(size)
+	if err != nil {
+		return 0, err
+	}
+	var n uint64
+	for _, c := range b {
+		n = n<<8 | uint64(c)
+	}
+	return n, nil
+}
+
+func (d *decoder) length(size int) (int, error) {
+	n, err := d.uint(size)
+	if err != nil {
+		return 0, err
+	}
+	if n > uint64(len(d.data)-d.pos) {
+		// Every element takes at least one byte.
+		return 0, d.errorf("length %d exceeds the size of data", n)
+	}
+	return int(n), nil
+}
+
+func (d *decoder) next() (token, error) {
+	b, err := d.bytes(1)
+	if err != nil {
+		return token{}, err
+	}
+	c := b[0]
+	switch {
+	case c <= 0x7f:
+		return token{family: familyUint, u: uint64(c)}, nil
+	case c <= 0x8f:
+		return token{family: familyMap, n: int(c & 0x0f)}, nil
+	case c <= 0x9f:
+		return token{family: familyArray, n: int(c & 0x0f)}, nil
+	case c <= 0xbf:
+		return token{family: familyStr, n: int(c & 0x1f)}, nil
+	case c >= 0xe0:
+		return token{family: familyInt, i: int64(int8(c))}, nil
+	}
+
+	tok := token{}
+	switch c {
+	case codeNil:
+		tok.family = familyNil
+	case codeFalse, codeTrue:
+		tok.family, tok.b = familyBool, c == codeTrue
+	case codeUint8, codeUint16, codeUint32, codeUint64:
+		tok.family = familyUint
+		tok.u, err = d.uint(1 << (c - codeUint8))
+	case codeInt8, codeInt16, codeInt32, codeInt64:
+		size := 1 << (c - codeInt8)
+		var u uint64
+		u, err = d.uint(size)
+		// Sign-extend the value.
+		shift := 64 - 8*size
+		tok.family, tok.i = familyInt, int64(u<<shift)>>shift
+	case codeFloat32:
+		var u uint64
+		u, err = d.uint(4)
+		tok.family, tok.f = familyFloat, float64(math.Float32frombits(uint32(u)))
+	case codeFloat64:
+		var u uint64
+		u, err = d.uint(8)
+		tok.family, tok.f = familyFloat, math.Float64frombits(u)
+	case codeStr8, codeStr16, codeStr32:
+		tok.family = familyStr
+		tok.n, err = d.length(1 << (c - codeStr8))
+	case codeBin8, codeBin16, codeBin32:
+		tok.family = familyBin
+		tok.n, err = d.length(1 << (c - codeBin8))
+	case codeArray16, codeArray32:
+		tok.family = familyArray
+		tok.n, err = d.length(2 << (c - codeArray16))
+	case codeMap16, codeMap32:
+		tok.family = familyMap
+		tok.n, err = d.length(2 << (c - codeMap16))
+	case codeFixExt1, codeFixExt2, codeFixExt4, codeFixExt8, codeFixExt16:
+		tok.family, tok.n = familyExt, 1<<(c-codeFixExt1)
+	case codeExt8, codeExt16, codeExt32:
+		tok.family = familyExt
+		tok.n, err = d.length(1 << (c - codeExt8))
+	default:
+		return token{}, d.errorf("invalid format code 0x%x", c)
+	}
+	if err != nil {
+		return token{}, err
+	}
+	if tok.family == familyExt {
+		var t []byte
+		if t, err = d.bytes(1); err != nil {
+			return token{}, err
+		}
+		tok.ext = int8(t[0])
+	}
+	return tok, nil
+}
+
+func (d *decoder) enter() error {
+	d.depth++
+	if d.depth > maxDepth {
+		return d.errorf("exceeded max depth %d", maxDepth)
+	}
+	return nil
+}
+
+// skip skips the next value.
+func (d *decoder) skip() error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer func() { d.depth-- }()
+	tok, err := d.next()
+	if err != nil {
+		return err
+	}
+	switch tok.family {
+	case familyStr, familyBin, familyExt:
+		_, err = d.bytes(tok.n)
+		return err
+	case familyArray, familyMap:
+		n := tok.n
+		if tok.family == familyMap {
+			n *= 2
+		}
+		for i := 0; i < n; i++ {
+			if err := d.skip(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (d *decoder) decode(v reflect.Value) error {
+	if err := d.enter(); err != nil {
+		return err
+	}
+	defer func() { d.depth-- }()
+
+	t := v.Type()
+	if t == rawMessageType {
+		start := d.pos
+		if err := d.skip(); err != nil {
+			return err
+		}
+		v.SetBytes(append([]byte(nil), d.data[start:d.pos]...))
+		return nil
+	}
+	if d.pos < len(d.data) && d.data[d.pos] == codeNil {
+		d.pos++
+		switch t.Kind() {
+		case reflect.Interface, reflect.Ptr, reflect.Map, reflect.Slice:
+			v.Set(reflect.Zero(t))
+		}
+		return nil
+	}
+	if t.Kind() == reflect.Ptr {
+		if v.IsNil() {
+			v.Set(reflect.New(t.Elem()))
+		}
+		return d.decode(v.Elem())
+	}
+	if t == timeType {
+		tm, err := d.decodeTime()
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(tm))
+		return nil
+	}
+	if t.Kind() != reflect.Interface && v.CanAddr() && reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return d.decodeText(v.Addr().Interface().(encoding.TextUnmarshaler))
+	}
+	if t.Kind() == reflect.Interface {
+		if t.NumMethod() == 0 {
+			x, err := d.decodeAny()
+			if err != nil {
+				return err
+			}
+			if x == nil {
+				v.Set(reflect.Zero(t))
+			} else {
+				v.Set(reflect.ValueOf(x))
+			}
+			return nil
+		}
+		if !v.IsNil() && v.Elem().Kind() == reflect.Ptr {
+			return d.decode(v.Elem())
+		}
+		return d.errorf("cannot unmarshal into Go value of type %s", t)
+	}
+
+	tok, err := d.next()
+	if err != nil {
+		return err
+	}
+	switch tok.family {
+	case familyBool:
+		if t.Kind() != reflect.Bool {
+			return d.mismatch(tok, t)
+		}
+		v.SetBool(tok.b)
+		return nil
+	case familyInt, familyUint, familyFloat:
+		return d.setNumber(v, tok)
+	case familyStr, familyBin:
+		data, err := d.bytes(tok.n)
+		if err != nil {
+			return err
+		}
+		switch {
+		case t.Kind() == reflect.String:
+			v.SetString(string(data))
+		case t.Kind() == reflect.Slice && t.Elem().Kind() == reflect.Uint8:
+			v.SetBytes(append([]byte{}, data...))
+		case t.Kind() == reflect.Array && t.Elem().Kind() == reflect.Uint8:
+			if len(data) != v.Len() {
+				return d.errorf("cannot unmarshal %d bytes into Go value of type %s", len(data), t)
+			}
+			reflect.Copy(v, reflect.ValueOf(data))
+		default:
+			return d.mismatch(tok, t)
+		}
+		return nil
+	case familyArray:
+		return d.decodeArray(v, tok)
+	case familyMap:
+		return d.decodeMap(v, tok)
+	default:
+		return d.mismatch(tok, t)
+	}
+}
+
+func (d *decoder) setNumber(v reflect.Value, tok token) error {
+	t := v.Type()
+	switch t.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var n int64
+		switch tok.family {
+		case familyInt:
+			n = tok.i
+		case familyUint:
+			if tok.u > math.MaxInt64 {
+				return d.errorf("value %d overflows Go value of type %s", tok.u, t)
+			}
+			n = int64(tok.u)
+		default:
+			return d.mismatch(tok, t)
+		}
+		if v.OverflowInt(n) {
+			return d.errorf("value %d overflows Go value of type %s", n, t)
+		}
+		v.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		var n uint64
+		switch tok.family {
+		case familyInt:
+			if tok.i < 0 {
+				return d.errorf("value %d overflows Go value of type %s", tok.i, t)
+			}
+			n = uint64(tok.i)
+		case familyUint:
+			n = tok.u
+		default:
+			return d.mismatch(tok, t)
+		}
+		if v.OverflowUint(n) {
+			return d.errorf("value %d overflows Go value of type %s", n, t)
+		}
+		v.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		switch tok.family {
+		case familyInt:
+			v.SetFloat(float64(tok.i))
+		case familyUint:
+			v.SetFloat(float64(tok.u))
+		default:
+			v.SetFloat(tok.f)
+		}
+	default:
+		return d.mismatch(tok, t)
+	}
+	return nil
+}
+
+func (d *decoder) decodeText(u encoding.TextUnmarshaler) error {
+	tok, err := d.next()
+	if err != nil {
+		return err
+	}
+	if tok.family != familyStr && tok.family != familyBin {
+		return d.errorf("cannot unmarshal %s into Go value of type %T", familyNames[tok.family], u)
+	}
+	text, err := d.bytes(tok.n)
+	if err != nil {
+		return err
+	}
+	return u.UnmarshalText(text)
+}
+
+func (d *decoder) decodeTime() (time.Time, error) {
+	tok, err := d.next()
+	if err != nil {
+		return time.Time{}, err
+	}
+	if tok.family != familyExt || tok.ext != extTimestamp {
+		return time.Time{}, d.errorf("cannot unmarshal %s into Go value of type time.Time", familyNames[tok.family])
+	}
+	data, err := d.bytes(tok.n)
+	if err != nil {
+		return time.Time{}, err
+	}
+	var sec int64
+	var nsec uint64
+	switch len(data) {
+	case 4:
+		sec = int64(uint32(data[0])<<24 | uint32(data[1])<<16 | uint32(data[2])<<8 | uint32(data[3]))
+	case 8:
+		var n uint64
+		for _, c := range data {
+			n = n<<8 | uint64(c)
+		}
+		sec, nsec = int64(n&(1<<34-1)), n>>34
+	case 12:
+		for _, c := range data[:4] {
+			nsec = nsec<<8 | uint64(c)
+		}
+		var n uint64
+		for _, c := range data[4:] {
+			n = n<<8 | uint64(c)
+		}
+		sec = int64(n)
+	default:
+		return time.Time{}, d.errorf("invalid timestamp of %d bytes", len(data))
+	}
+	if nsec >= 1e9 {
+		return time.Time{}, d.errorf("invalid nanoseconds %d in timestamp", nsec)
+	}
+	return time.Unix(sec, int64(nsec)).UTC(), nil
+}
+
+func (d *decoder) decodeArray(v reflect.Value, tok token) error {
+	t := v.Type()
+	switch t.Kind() {
+	case reflect.Slice:
+		if v.IsNil() || v.Cap() < tok.n {
+			v.Set(reflect.MakeSlice(t, tok.n, tok.n))
+		} else {
+			v.SetLen(tok.n)
+		}
+		for i := 0; i < tok.n; i++ {
+			if err := d.decode(v.Index(i)); err != nil {
+				return err
+			}
+		}
+	case reflect.Array:
+		for i := 0; i < tok.n; i++ {
+			var err error
+			if i < v.Len() {
+				err = d.decode(v.Index(i))
+			} else {
+				err = d.skip()
+			}
+			if err != nil {
+				return err
+			}
+		}
+		for i := tok.n; i < v.Len(); i++ {
+			v.Index(i).Set(reflect.Zero(t.Elem()))
+		}
+	default:
+		return d.mismatch(tok, t)
+	}
+	return nil
+}
+
+func (d *decoder) decodeMap(v reflect.Value, tok token) error {
+	t := v.Type()
+	switch t.Kind() {
+	case reflect.Map:
+		if v.IsNil() {
+			v.Set(reflect.MakeMapWithSize(t, tok.n))
+		}
+		for i := 0; i < tok.n; i++ {
+			key := reflect.New(t.Key()).Elem()
+			if err := d.decode(key); err != nil {
+				return err
+			}
+			value := reflect.New(t.Elem()).Elem()
+			if err := d.decode(value); err != nil {
+				return err
+			}
+			v.SetMapIndex(key, value)
+		}
+	case reflect.Struct:
+		fields := structFields(t)
+		for i := 0; i < tok.n; i++ {
+			keyTok, err := d.next()
+			if err != nil {
+				return err
+			}
+			if keyTok.family != familyStr {
+				return d.errorf("cannot unmarshal %s key into field of %s", familyNames[keyTok.family], t)
+			}
+			key, err := d.bytes(keyTok.n)
+			if err != nil {
+				return err
+			}
+			f := findField(fields, string(key))
+			if f == nil {
+				if err := d.skip(); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := d.decode(v.FieldByIndex(f.index)); err != nil {
+				return err
+			}
+		}
+	default:
+		return d.mismatch(tok, t)
+	}
+	return nil
+}
+
+// findField finds the field by name preferring exact match like
+// encoding/json does.
+func findField(fields []field, name string) *field {
+	for i := range fields {
+		if fields[i].name == name {
+			return &fields[i]
+		}
+	}
+	for i := range fields {
+		if strings.EqualFold(fields[i].name, name) {
+			return &fields[i]
+		}
+	}
+	return nil
+}
+
+// decodeAny decodes the next value into interface{}: nil, bool, int64,
+// uint64 (if it doesn't fit into int64), float64, string, []byte,
+// time.Time, []interface{} or map. Maps with string keys are decoded into
+// map[string]interface{}, other maps into map[interface{}]interface{}.
+func (d *decoder) decodeAny() (interface{}, error) {
+	if err := d.enter(); err != nil {
+		return nil, err
+	}
+	defer func() { d.depth-- }()
+
+	start := d.pos
+	tok, err := d.next()
+	if err != nil {
+		return nil, err
+	}
+	switch tok.family {
+	case familyNil:
+		return nil, nil
+	case familyBool:
+		return tok.b, nil
+	case familyInt:
+		return tok.i, nil
+	case familyUint:
+		if tok.u <= math.MaxInt64 {
+			return int64(tok.u), nil
+		}
+		return tok.u, nil
+	case familyFloat:
+		return tok.f, nil
+	case familyStr:
+		data, err := d.bytes(tok.n)
+		return string(data), err
+	case familyBin:
+		data, err := d.bytes(tok.n)
+		return append([]byte{}, data...), err
+	case familyExt:
+		if tok.ext != extTimestamp {
+			return nil, d.errorf("unsupported extension type %d", tok.ext)
+		}
+		d.pos = start
+		return d.decodeTime()
+	case familyArray:
+		values := make([]interface{}, tok.n)
+		for i := range values {
+			if values[i], err = d.decodeAny(); err != nil {
+				return nil, err
+			}
+		}
+		return values, nil
+	default:
+		keys := make([]interface{}, tok.n)
+		values := make([]interface{}, tok.n)
+		stringKeys := true
+		for i := range keys {
+			if keys[i], err = d.decodeAny(); err != nil {
+				return nil, err
+			}
+			switch key := keys[i].(type) {
+			case string:
+			case []byte:
+				keys[i] = string(key)
+				stringKeys = false
+			case []interface{}, map[string]interface{}, map[interface{}]interface{}:
+				return nil, d.errorf("unsupported map key of type %T", key)
+			default:
+				stringKeys = false
+			}
+			if values[i], err = d.decodeAny(); err != nil {
+				return nil, err
+			}
+		}
+		if stringKeys {
+			m := make(map[string]interface{}, tok.n)
+			for i, key := range keys {
+				m[key.(string)] = values[i]
+			}
+			return m, nil
+		}
+		m := make(map[interface{}]interface{}, tok.n)
+		for i, key := range keys {
+			m[key] = values[i]
+		}
+		return m, nil
+	}
+}
@@ -0,0 +1,178 @@
+package msgpack_test
+
+import (
+	"encoding/hex"
+	"math"
+	"net/netip"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/starius/api2/msgpack"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMarshal(t *testing.T) {
+	type Small struct {
+		A int `msgpack:"a"`
+	}
+
+	cases := []struct {
+		value interface{}
+		want  string
+	}{
+		{nil, "c0"},
+		{true, "c3"},
+		{false, "c2"},
+		{1, "01"},
+		{127, "7f"},
+		{128, "cc80"},
+		{65536, "ce00010000"},
+		{uint64(math.MaxUint64), "cfffffffffffffffff"},
+		{-1, "ff"},
+		{-32, "e0"},
+		{-33, "d0df"},
+		{-129, "d1ff7f"},
+		{int64(math.MinInt64), "d38000000000000000"},
+		{float32(1.5), "ca3fc00000"},
+		{1.5, "cb3ff8000000000000"},
+		{"a", "a161"},
+		{strings.Repeat("x", 32), "d920" + strings.Repeat("78", 32)},
+		{[]byte{1, 2}, "c4020102"},
+		{[2]byte{1, 2}, "c4020102"},
+		{[]int{1, 2}, "920102"},
+		{[]int(nil), "c0"},
+		{map[string]int{"b": 2, "a": 1}, "82a16101a16202"},
+		{Small{A: 1}, "81a16101"},
+		{&Small{A: 1}, "81a16101"},
+		{(*Small)(nil), "c0"},
+		{msgpack.RawMessage{0x01}, "01"},
+		{time.Unix(1, 0), "d6ff00000001"},
+		{time.Unix(1, 1), "d7ff0000000400000001"},
+		{time.Unix(-1, 0), "c70cff00000000ffffffffffffffff"},
+		{netip.MustParseAddr("1.2.3.4"), "a7312e322e332e34"},
+	}
+
+	for _, tc := range cases {
+		got, err := msgpack.Marshal(tc.value)
+		require.NoError(t, err, "%#v", tc.value)
+		require.Equal(t, tc.want, hex.EncodeToString(got), "%#v", tc.value)
+	}
+}
+
+func TestRoundTrip(t *testing.T) {
+	type Inner struct {
+		Values []float64 `json:"values"`
+	}
+	type Embedded struct {
+		Shared string `json:"shared"`
+	}
+	type Value struct {
+		Embedded
+		Name       string            `json:"name"`
+		Count      int32             `msgpack:"count" json:"ignored"`
+		Optional   *int              `json:"optional,omitempty"`
+		Empty      string            `json:"empty,omitempty"`
+		Skipped    string            `json:"-"`
+		Inner      Inner             `json:"inner"`
+		InnerPtr   *Inner            `json:"inner_ptr"`
+		Labels     map[string]string `json:"labels"`
+		ByID       map[int]bool      `json:"by_id"`
+		Data       []byte            `json:"data"`
+		Addr       netip.Addr        `json:"addr"`
+		Created    time.Time         `json:"created"`
+		Future     time.Time         `json:"future"`
+		Any        interface{}       `json:"any"`
+		Raw        msgpack.RawMessage
+		unexported int
+	}
+
+	seven := 7
+	value := Value{
+		Embedded: Embedded{Shared: "shared"},
+		Name:     "name",
+		Count:    -100000,
+		Optional: &seven,
+		Skipped:  "skipped",
+		Inner:    Inner{Values: []float64{1, 2.5}},
+		InnerPtr: &Inner{},
+		Labels:   map[string]string{"k": "v"},
+		ByID:     map[int]bool{-1: true, 300: false},
+		Data:     []byte("data"),
+		Addr:     netip.MustParseAddr("::1"),
+		Created:  time.Date(2020, 1, 2, 3, 4, 5, 6, time.UTC),
+		Future:   time.Date(3000, 1, 1, 0, 0, 0, 0, time.UTC),
+		Any: map[string]interface{}{
+			"list": []interface{}{int64(1), "two", nil, true, 3.5},
+		},
+		Raw:        msgpack.RawMessage{0x92, 0x01, 0x02},
+		unexported: 1,
+	}
+	data, err := msgpack.Marshal(&value)
+	require.NoError(t, err)
+
+	var got Value
+	require.NoError(t, msgpack.Unmarshal(data, &got))
+	value.Skipped = ""
+	value.unexported = 0
+	require.Equal(t, value, got)
+
+	var generic map[string]interface{}
+	require.NoError(t, msgpack.Unmarshal(data, &generic))
+	require.Equal(t, "shared", generic["shared"])
+	require.Equal(t, int64(-100000), generic["count"])
+	require.NotContains(t, generic, "empty")
+	require.NotContains(t, generic, "Skipped")
+	require.Equal(t, []interface{}{int64(1), int64(2)}, generic["Raw"])
+	require.Equal(t, map[interface{}]interface{}{int64(-1): true, int64(300): false}, generic["by_id"])
+}
+
+func TestUnmarshalFieldNames(t *testing.T) {
+	type Value struct {
+		UserName string `json:"user_name"`
+		Age      int
+	}
+	// {"USER_NAME": "u", "age": 3, "unknown": [1]}
+	data, err := msgpack.Marshal(map[string]interface{}{
+		"USER_NAME": "u",
+		"age":       3,
+		"unknown":   []int{1},
+	})
+	require.NoError(t, err)
+	var got Value
+	require.NoError(t, msgpack.Unmarshal(data, &got))
+	require.Equal(t, Value{UserName: "u", Age: 3}, got)
+}
+
+func TestUnmarshalErrors(t *testing.T) {
+	cases := []struct {
+		data   string
+		target interface{}
+		want   string
+	}{
+		{"", new(int), "unexpected end of data"},
+		{"cd01", new(int), "unexpected end of data"},
+		{"dc0010", new([]int), "exceeds the size of data"},
+		{"a161", new(int), "cannot unmarshal str into Go value of type int"},
+		{"cd0100", new(int8), "overflows"},
+		{"ff", new(uint), "overflows"},
+		{"0101", new(int), "trailing data"},
+		{"c1", new(interface{}), "invalid format code"},
+		{"81a16101", new([]int), "cannot unmarshal map"},
+		{"8101a161", new(struct{ A int }), "key into field"},
+	}
+	for _, tc := range cases {
+		data, err := hex.DecodeString(tc.data)
+		require.NoError(t, err)
+		err = msgpack.Unmarshal(data, tc.target)
+		require.ErrorContains(t, err, tc.want, "data %s", tc.data)
+	}
+
+	require.ErrorContains(t, msgpack.Unmarshal([]byte{1}, 1), "non-pointer")
+
+	deep := strings.Repeat("91", 20000) + "c0"
+	data, err := hex.DecodeString(deep)
+	require.NoError(t, err)
+	var v interface{}
+	require.ErrorContains(t, msgpack.Unmarshal(data, &v), "max depth")
+}
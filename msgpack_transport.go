@@ -0,0 +1,122 @@
+package api2
+
+import (
+	"context"
+	"io"
+	"net/http"
+
+	"github.com/starius/api2/msgpack"
+)
+
+const msgpackContentType = "application/msgpack"
+
+var msgpackCodec = &bodyCodec{
+	mediaType:   msgpackContentType,
+	contentType: msgpackContentType,
+	encode: func(w io.Writer, v interface{}, human bool) error {
+		// MessagePack has no human readable form.
+		data, err := msgpack.Marshal(v)
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	},
+	decode: func(r io.Reader, v interface{}) error {
+		data, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		return msgpack.Unmarshal(data, v)
+	},
+}
+
+// MessagePackTransport implements interface Transport encoding bodies of
+// requests and responses in MessagePack (see package msgpack).
+//
+// Struct tags have the same meaning as in JsonTransport: fields with tags
+// query, header, cookie and url are passed outside of the body, use_as_body
+// and use_as_status work the same way. Field names in the body are taken
+// from tag msgpack or, if it is missing, from tag json, so the same
+// request and response types can be used with both transports.
+type MessagePackTransport struct {
+	// Errors whose structure is preserved and parsed back by api2 Client.
+	// See JsonTransport.Errors.
+	Errors map[string]error
+
+	// Compression enables compression of responses (if the client accepts
+	// it) and of request bodies sent by Client. See Compression.
+	Compression *Compression
+}
+
+type msgpackErrorMessage struct {
+	Error  string             `msgpack:"error"`
+	Detail msgpack.RawMessage `msgpack:"detail,omitempty"`
+	Code   string             `msgpack:"code,omitempty"`
+}
+
+var msgpackErrorCodec = &errorCodec{
+	contentType:     msgpackContentType,
+	marshalDetail:   msgpack.Marshal,
+	unmarshalDetail: msgpack.Unmarshal,
+	encode: func(w io.Writer, message, code string, detail []byte) error {
+		data, err := msgpack.Marshal(&msgpackErrorMessage{
+			Error:  message,
+			Detail: detail,
+			Code:   code,
+		})
+		if err != nil {
+			return err
+		}
+		_, err = w.Write(data)
+		return err
+	},
+	decode: func(data []byte) (string, string, []byte, error) {
+		var msg msgpackErrorMessage
+		if err := msgpack.Unmarshal(data, &msg); err != nil {
+			return "", "", nil, err
+		}
+		return msg.Error, msg.Code, msg.Detail, nil
+	},
+}
+
+func (h *MessagePackTransport) ContentTypes() []string {
+	return []string{msgpackContentType}
+}
+
+func (h *MessagePackTransport) DecodeRequest(ctx context.Context, r *http.Request, req interface{}) (context.Context, error) {
+	return decodeCodecRequest(ctx, msgpackCodec, h.Compression, r, req)
+}
+
+func (h *MessagePackTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, res interface{}) error {
+	return encodeCodecResponse(ctx, msgpackCodec, h.Compression, w, res)
+}
+
+func (h *MessagePackTransport) EncodeError(ctx context.Context, w http.ResponseWriter, err error) error {
+	return encodeCodecError(msgpackErrorCodec, h.Errors, w, err)
+}
+
+func (h *MessagePackTransport) errorCode(err error) string {
+	_, code := detectErrorType(err, h.Errors)
+	return code
+}
+
+func (h *MessagePackTransport) EncodeRequest(ctx context.Context, method, urlStr string, req interface{}) (*http.Request, error) {
+	return encodeRequest(ctx, msgpackCodec, h.Compression, method, urlStr, req)
+}
+
+func (h *MessagePackTransport) DecodeResponse(ctx context.Context, res *http.Response, response interface{}) error {
+	return decodeCodecResponse(ctx, msgpackCodec, res, response)
+}
+
+func (h *MessagePackTransport) DecodeError(ctx context.Context, res *http.Response) error {
+	return decodeCodecError(ctx, msgpackErrorCodec, h.Errors, res)
+}
+
+func (h *MessagePackTransport) DecodeResponseAndError(ctx context.Context, res *http.Response, response interface{}) error {
+	return decodeResponseOrError(ctx, h, res, response)
+}
+
+func (h *MessagePackTransport) BodyCloseNeeded(ctx context.Context, response, request interface{}) bool {
+	return streamBodyCloseNeeded(response)
+}
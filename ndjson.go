@@ -0,0 +1,320 @@
+package api2
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+)
+
+const ndjsonContentType = "application/x-ndjson"
+
+// ndjsonCodec sets headers of NDJSON streams. The records themselves are
+// written and read by NdjsonTransport.
+var ndjsonCodec = &bodyCodec{
+	mediaType:   ndjsonContentType,
+	contentType: ndjsonContentType,
+	encode:      jsonCodec.encode,
+	decode:      jsonCodec.decode,
+}
+
+// ndjsonRecords returns the channel of records (use_as_body field of
+// channel type) or invalid value if the object has no such field.
+func ndjsonRecords(obj interface{}) reflect.Value {
+	objType := reflect.TypeOf(obj).Elem()
+	p0, has := prepared.Load(objType)
+	if !has {
+		p0 = prepare(objType)
+		prepared.Store(objType, p0)
+	}
+	p := p0.(*preparedType)
+	if !p.Chan {
+		return reflect.Value{}
+	}
+	return reflect.ValueOf(obj).Elem().Field(p.BodyField)
+}
+
+// writeRecords writes records from the channel to w, one JSON object per
+// line, until the channel is closed or ctx is canceled.
+func writeRecords(ctx context.Context, w io.Writer, records reflect.Value, flush func()) error {
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		{Dir: reflect.SelectRecv, Chan: records},
+	}
+	for {
+		chosen, record, ok := reflect.Select(cases)
+		if chosen == 0 {
+			return ctx.Err()
+		}
+		if !ok {
+			return nil
+		}
+		// json.Marshal does not produce newlines.
+		line, err := json.Marshal(record.Interface())
+		if err != nil {
+			return fmt.Errorf("failed to marshal NDJSON record: %w", err)
+		}
+		if _, err := w.Write(append(line, '\n')); err != nil {
+			return err
+		}
+		if flush != nil {
+			flush()
+		}
+	}
+}
+
+// readRecords reads records from r and sends them to the channel until
+// the end of r. If stop is closed, the remaining records are discarded.
+func readRecords(ctx context.Context, r io.Reader, records reflect.Value, stop <-chan struct{}) error {
+	decoder := json.NewDecoder(r)
+	elemType := records.Type().Elem()
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(stop)},
+		{Dir: reflect.SelectSend, Chan: records},
+	}
+	stopped := false
+	for {
+		record := reflect.New(elemType)
+		if err := decoder.Decode(record.Interface()); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			var syntaxErr *json.SyntaxError
+			var typeErr *json.UnmarshalTypeError
+			if errors.As(err, &syntaxErr) || errors.As(err, &typeErr) || err == io.ErrUnexpectedEOF {
+				return httpError{
+					Code:    http.StatusBadRequest,
+					Message: fmt.Sprintf("failed to parse NDJSON record: %v", err),
+				}
+			}
+			return err
+		}
+		if stopped {
+			continue
+		}
+		cases[2].Send = record.Elem()
+		switch chosen, _, _ := reflect.Select(cases); chosen {
+		case 0:
+			return ctx.Err()
+		case 1:
+			// Discard the rest of records.
+			stopped = true
+		}
+	}
+}
+
+type ndjsonUploadType struct{}
+
+// ndjsonUpload is the stream of records in the request being read by
+// the server.
+type ndjsonUpload struct {
+	stop chan struct{}
+	done chan struct{}
+	err  error
+}
+
+// finishUpload discards the records not received by the handler and
+// returns the error of reading the request stream.
+func finishUpload(ctx context.Context) error {
+	u, ok := ctx.Value(ndjsonUploadType{}).(*ndjsonUpload)
+	if !ok {
+		return nil
+	}
+	select {
+	case <-u.stop:
+	default:
+		close(u.stop)
+	}
+	<-u.done
+	return u.err
+}
+
+func ndjsonDecodeRequest(ctx context.Context, r *http.Request, req interface{}) (context.Context, error) {
+	records := ndjsonRecords(req)
+	if !records.IsValid() {
+		return (&JsonTransport{}).RawDecodeRequest(ctx, r, req)
+	}
+	if err := readQueryHeaderCookie(ndjsonCodec, req, r.Body, r.URL.Query(), r, r.Header, 0); err != nil {
+		return ctx, err
+	}
+
+	ch := reflect.MakeChan(reflect.ChanOf(reflect.BothDir, records.Type().Elem()), 0)
+	records.Set(ch)
+
+	ctx, cancel := context.WithCancel(ctx)
+	u := &ndjsonUpload{
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	go func() {
+		defer close(u.done)
+		defer ch.Close()
+		// The body is read here, so the response must be written
+		// after the goroutine finishes, see finishUpload.
+		if err := readRecords(ctx, r.Body, ch, u.stop); err != nil {
+			u.err = err
+			// Let the handler know that the stream is broken.
+			cancel()
+		}
+	}()
+
+	return context.WithValue(ctx, ndjsonUploadType{}, u), nil
+}
+
+func ndjsonEncodeResponse(ctx context.Context, w http.ResponseWriter, res interface{}) error {
+	if err := finishUpload(ctx); err != nil {
+		// The handler got incomplete stream.
+		if err2 := ndjsonEncodeError(ctx, w, err); err2 != nil {
+			return err2
+		}
+		return err
+	}
+	records := ndjsonRecords(res)
+	if !records.IsValid() {
+		return (&JsonTransport{}).RawEncodeResponse(ctx, w, res)
+	}
+	if records.IsNil() {
+		return fmt.Errorf("the channel of records is nil")
+	}
+
+	defer func() {
+		// Drain the channel.
+		for {
+			if _, ok := records.Recv(); !ok {
+				break
+			}
+		}
+	}()
+
+	if _, err := writeQueryHeaderCookie(ndjsonCodec, w, res, nil, nil, w.Header(), false); err != nil {
+		return err
+	}
+
+	var flush func()
+	if httpFlusher, ok := w.(http.Flusher); ok {
+		flush = httpFlusher.Flush
+		// Send headers before the first record.
+		flush()
+	}
+
+	return writeRecords(ctx, w, records, flush)
+}
+
+func ndjsonEncodeError(ctx context.Context, w http.ResponseWriter, err error) error {
+	if uploadErr := finishUpload(ctx); uploadErr != nil {
+		// The handler likely failed because of the broken stream.
+		err = uploadErr
+	}
+	return (&JsonTransport{}).RawEncodeError(ctx, w, err)
+}
+
+func ndjsonEncodeRequest(ctx context.Context, method, urlStr string, req interface{}) (*http.Request, error) {
+	records := ndjsonRecords(req)
+	if !records.IsValid() {
+		return (&JsonTransport{}).RawEncodeRequest(ctx, method, urlStr, req)
+	}
+
+	request, err := http.NewRequestWithContext(ctx, method, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	query, err := url.ParseQuery(request.URL.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query part of URL: %w", err)
+	}
+	if _, err := writeQueryHeaderCookie(ndjsonCodec, io.Discard, req, query, request, request.Header, false); err != nil {
+		return nil, err
+	}
+	request.URL.RawQuery = query.Encode()
+	// The response can be a stream or a JSON object.
+	request.Header.Set("Accept", ndjsonContentType+", "+jsonCodec.mediaType)
+
+	if records.IsNil() {
+		request.Body = http.NoBody
+		return request, nil
+	}
+
+	pr, pw := io.Pipe()
+	go func() {
+		err := writeRecords(ctx, pw, records, nil)
+		pw.CloseWithError(err)
+		if err != nil {
+			// Unblock the sender until it closes the channel.
+			cases := []reflect.SelectCase{
+				{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+				{Dir: reflect.SelectRecv, Chan: records},
+			}
+			for {
+				if chosen, _, ok := reflect.Select(cases); chosen == 0 || !ok {
+					return
+				}
+			}
+		}
+	}()
+	request.Body = pr
+
+	return request, nil
+}
+
+func ndjsonDecodeResponse(ctx context.Context, httpRes *http.Response, res interface{}) error {
+	records := ndjsonRecords(res)
+	if !records.IsValid() {
+		return (&JsonTransport{}).RawDecodeResponse(ctx, httpRes, res)
+	}
+	if records.IsNil() {
+		panic("provide a channel of records in the response")
+	}
+	defer records.Close()
+
+	if err := readQueryHeaderCookie(ndjsonCodec, res, httpRes.Body, nil, nil, httpRes.Header, httpRes.StatusCode); err != nil {
+		return err
+	}
+
+	return readRecords(ctx, httpRes.Body, records, nil)
+}
+
+// NdjsonTransport streams typed records as newline-delimited JSON
+// (application/x-ndjson): one JSON object per line.
+//
+// The stream is a field of channel type with tag use_as_body in the
+// response (download) or in the request (upload); other fields can be
+// passed in headers, cookies, query and URL:
+//
+//	type ExportResponse struct {
+//		Total   int           `header:"X-Total"`
+//		Records chan *Payment `use_as_body:"true"`
+//	}
+//
+// Requests and responses without such a field are encoded as in
+// JsonTransport, so a route can e.g. upload a stream and get JSON
+// response.
+//
+// In ResponseEncoder (server side) the channel should be set by the
+// handler and records written from a goroutine, which closes the channel
+// to finish the stream. The transport flushes each record and drains the
+// channel. In ResponseDecoder (client side) the channel should be passed
+// in response object. The transport writes records to the channel and
+// closes it before returning.
+//
+// When uploading, the client passes a channel in the request and closes it
+// after the last record; it should select on ctx when sending. The
+// handler reads records from the channel until it is closed. The response
+// is sent after the request stream is read to the end, the records not
+// received by the handler are discarded. If the stream is malformed, the
+// context of the handler is canceled and the client gets the error even
+// if the handler succeeded.
+//
+// Errors are encoded as in JsonTransport.
+var NdjsonTransport = &JsonTransport{
+	RequestEncoder:  ndjsonEncodeRequest,
+	RequestDecoder:  ndjsonDecodeRequest,
+	ResponseEncoder: ndjsonEncodeResponse,
+	ResponseDecoder: ndjsonDecodeResponse,
+	ErrorEncoder:    ndjsonEncodeError,
+	ContentType:     ndjsonContentType,
+}
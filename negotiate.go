@@ -0,0 +1,229 @@
+package api2
+
+import (
+	"context"
+	"fmt"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// ContentTyper is implemented by transports which know the media types
+// they use. It is used by the OpenAPI generator.
+type ContentTyper interface {
+	ContentTypes() []string
+}
+
+// Format is a wire format supported by NegotiatingTransport.
+type Format struct {
+	// ContentType is the media type of the format, e.g. "application/json".
+	ContentType string
+
+	// Transport encodes and decodes requests and responses in the format.
+	Transport Transport
+}
+
+// NegotiatingTransport serves one route in several wire formats. For every
+// request the server selects the transport decoding the request by its
+// Content-Type and the transport encoding the response by Accept header
+// (see RFC 9110). The first format is used when the headers are missing
+// or match no format and to decode form requests. Request bodies of
+// unknown Content-Type are rejected with 415 Unsupported Media Type.
+//
+// Client sends requests in the format set by option PreferredContentType
+// (the first format by default) and decodes responses according to their
+// Content-Type.
+//
+// Request and response types must be supported by all the transports.
+type NegotiatingTransport struct {
+	Formats []Format
+}
+
+type negotiatedType struct{}
+
+type preferredContentType struct{}
+
+// PreferredContentType makes the client send requests and ask for
+// responses in the given media type if the route uses
+// NegotiatingTransport supporting it.
+func PreferredContentType(contentType string) Option {
+	return func(config *Config) {
+		config.contentType = contentType
+	}
+}
+
+func (n *NegotiatingTransport) ContentTypes() []string {
+	contentTypes := make([]string, 0, len(n.Formats))
+	for _, f := range n.Formats {
+		contentTypes = append(contentTypes, f.ContentType)
+	}
+	return contentTypes
+}
+
+func (n *NegotiatingTransport) defaultFormat() Format {
+	if len(n.Formats) == 0 {
+		panic("NegotiatingTransport has no formats")
+	}
+	return n.Formats[0]
+}
+
+// byContentType returns the format of the header Content-Type.
+func (n *NegotiatingTransport) byContentType(contentType string) (Format, bool) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return Format{}, false
+	}
+	for _, f := range n.Formats {
+		if strings.EqualFold(f.ContentType, mediaType) {
+			return f, true
+		}
+	}
+	return Format{}, false
+}
+
+// byAccept returns the format best matching header Accept. The quality of
+// a format is taken from the most specific media range matching it.
+func (n *NegotiatingTransport) byAccept(accept string) Format {
+	type mediaRange struct {
+		pattern string
+		q       float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, has := params["q"]; has {
+			if parsed, err := strconv.ParseFloat(value, 64); err == nil {
+				q = parsed
+			}
+		}
+		ranges = append(ranges, mediaRange{pattern: mediaType, q: q})
+	}
+
+	best, bestQ := n.defaultFormat(), 0.0
+	for _, f := range n.Formats {
+		q, specificity := 0.0, -1
+		for _, r := range ranges {
+			if s := mediaTypeMatch(r.pattern, f.ContentType); s > specificity {
+				q, specificity = r.q, s
+			}
+		}
+		if q > bestQ {
+			best, bestQ = f, q
+		}
+	}
+	return best
+}
+
+// mediaTypeMatch returns -1 if pattern (from Accept) doesn't match media
+// type, 0 for "*/*", 1 for "type/*" and 2 for exact match.
+func mediaTypeMatch(pattern, mediaType string) int {
+	pattern, mediaType = strings.ToLower(pattern), strings.ToLower(mediaType)
+	if pattern == "*/*" {
+		return 0
+	}
+	if pattern == mediaType {
+		return 2
+	}
+	if strings.HasSuffix(pattern, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(pattern, "*")) {
+		return 1
+	}
+	return -1
+}
+
+func (n *NegotiatingTransport) responseTransport(ctx context.Context) Transport {
+	if t, ok := ctx.Value(negotiatedType{}).(Transport); ok {
+		return t
+	}
+	return n.defaultFormat().Transport
+}
+
+func (n *NegotiatingTransport) DecodeRequest(ctx context.Context, r *http.Request, req interface{}) (context.Context, error) {
+	request := n.defaultFormat()
+	if contentType := r.Header.Get("Content-Type"); contentType != "" && !isFormContentType(contentType) {
+		f, has := n.byContentType(contentType)
+		if !has {
+			return ctx, httpError{
+				Code:    http.StatusUnsupportedMediaType,
+				Message: fmt.Sprintf("unsupported Content-Type %q, supported: %s", contentType, strings.Join(n.ContentTypes(), ", ")),
+			}
+		}
+		request = f
+	}
+	response := n.byAccept(r.Header.Get("Accept"))
+	ctx = context.WithValue(ctx, negotiatedType{}, response.Transport)
+	return request.Transport.DecodeRequest(ctx, r, req)
+}
+
+func (n *NegotiatingTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, res interface{}) error {
+	w.Header().Add("Vary", "Accept")
+	return n.responseTransport(ctx).EncodeResponse(ctx, w, res)
+}
+
+func (n *NegotiatingTransport) EncodeError(ctx context.Context, w http.ResponseWriter, err error) error {
+	w.Header().Add("Vary", "Accept")
+	return n.responseTransport(ctx).EncodeError(ctx, w, err)
+}
+
+func (n *NegotiatingTransport) errorCode(err error) string {
+	for _, f := range n.Formats {
+		if code := errorCode(f.Transport, err); code != "" {
+			return code
+		}
+	}
+	return ""
+}
+
+func (n *NegotiatingTransport) clientFormat(ctx context.Context) Format {
+	if contentType, ok := ctx.Value(preferredContentType{}).(string); ok {
+		if f, has := n.byContentType(contentType); has {
+			return f
+		}
+	}
+	return n.defaultFormat()
+}
+
+func (n *NegotiatingTransport) EncodeRequest(ctx context.Context, method, url string, req interface{}) (*http.Request, error) {
+	f := n.clientFormat(ctx)
+	request, err := f.Transport.EncodeRequest(ctx, method, url, req)
+	if err != nil {
+		return nil, err
+	}
+	request.Header.Set("Accept", f.ContentType)
+	return request, nil
+}
+
+// responseFormat returns the transport decoding the response.
+func (n *NegotiatingTransport) responseFormat(ctx context.Context, res *http.Response) Transport {
+	if f, has := n.byContentType(res.Header.Get("Content-Type")); has {
+		return f.Transport
+	}
+	return n.clientFormat(ctx).Transport
+}
+
+func (n *NegotiatingTransport) DecodeResponse(ctx context.Context, res *http.Response, response interface{}) error {
+	return n.responseFormat(ctx, res).DecodeResponse(ctx, res, response)
+}
+
+func (n *NegotiatingTransport) DecodeError(ctx context.Context, res *http.Response) error {
+	return n.responseFormat(ctx, res).DecodeError(ctx, res)
+}
+
+func (n *NegotiatingTransport) DecodeResponseAndError(ctx context.Context, res *http.Response, response interface{}) error {
+	t := n.responseFormat(ctx, res)
+	if d, ok := t.(responseAndErrorDecoder); ok {
+		return d.DecodeResponseAndError(ctx, res, response)
+	}
+	if 200 <= res.StatusCode && res.StatusCode < 300 {
+		return t.DecodeResponse(ctx, res, response)
+	}
+	return t.DecodeError(ctx, res)
+}
+
+func (n *NegotiatingTransport) BodyCloseNeeded(ctx context.Context, response, request interface{}) bool {
+	return bodyCloseNeeded(ctx, response, request, n.clientFormat(ctx).Transport)
+}
@@ -0,0 +1,75 @@
+package api2
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNegotiateAccept(t *testing.T) {
+	json := &JsonTransport{}
+	csv := CsvTransport
+	n := &NegotiatingTransport{
+		Formats: []Format{
+			{ContentType: "application/json", Transport: json},
+			{ContentType: "text/csv", Transport: csv},
+		},
+	}
+
+	cases := []struct {
+		accept string
+		want   Transport
+	}{
+		{"", json},
+		{"*/*", json},
+		{"text/csv", csv},
+		{"text/*", csv},
+		{"text/csv;q=0.5, application/json", json},
+		{"text/csv, application/json;q=0.5", csv},
+		{"text/*, */*;q=0.1", csv},
+		{"application/json;q=0, */*", csv},
+		{"image/png", json},
+		{"garbage;;", json},
+	}
+	for _, tc := range cases {
+		require.Equal(t, tc.want, n.byAccept(tc.accept).Transport, tc.accept)
+	}
+
+	f, has := n.byContentType("text/csv; charset=utf-8")
+	require.True(t, has)
+	require.Equal(t, csv, f.Transport)
+	_, has = n.byContentType("application/xml")
+	require.False(t, has)
+
+	require.Equal(t, []string{"application/json", "text/csv"}, responseContentTypes(n))
+	require.Equal(t, []string{"text/csv"}, responseContentTypes(CsvTransport))
+	copied := *SseTransport
+	require.Equal(t, []string{"text/event-stream"}, responseContentTypes(&copied))
+	require.Equal(t, []string{"application/x-ndjson"}, responseContentTypes(NdjsonTransport))
+	require.Equal(t, []string{"application/json"}, responseContentTypes(nil))
+}
+
+func TestRequestContentTypes(t *testing.T) {
+	type JsonRequest struct {
+		ID   string `url:"id"`
+		Name string `json:"name"`
+	}
+	type UploadRequest struct {
+		Records chan *JsonRequest `use_as_body:"true"`
+	}
+	type FormRequest struct {
+		Name string `form:"name"`
+	}
+	jsonReq := prepare(reflect.TypeOf(JsonRequest{}))
+	formReq := prepare(reflect.TypeOf(FormRequest{}))
+	uploadReq := prepare(reflect.TypeOf(UploadRequest{}))
+
+	require.Equal(t, []string{"application/json"}, requestContentTypes(&JsonTransport{}, jsonReq))
+	require.Equal(t, []string{"application/json"}, requestContentTypes(CsvTransport, jsonReq))
+	require.Equal(t, []string{"application/json"}, requestContentTypes(SseTransport, jsonReq))
+	require.Equal(t, []string{"application/json"}, requestContentTypes(NdjsonTransport, jsonReq))
+	require.Equal(t, []string{"application/x-ndjson"}, requestContentTypes(NdjsonTransport, uploadReq))
+	require.Equal(t, []string{"application/xml"}, requestContentTypes(&XmlTransport{}, jsonReq))
+	require.Equal(t, []string{"application/x-www-form-urlencoded", "multipart/form-data"}, requestContentTypes(CsvTransport, formReq))
+}
@@ -11,14 +11,10 @@ import (
 	"github.com/starius/api2/typegen"
 )
 
+// GenerateOpenApiSpec writes openapi.json to options.OutDir. If routes have
+// versions (see Route.Version), a spec is written for each version to
+// subdirectory named after the version, e.g. OutDir/v2/openapi.json.
 func GenerateOpenApiSpec(options *TypesGenConfig) {
-	_ = os.RemoveAll(filepath.Join(options.OutDir, "openapi.json"))
-	err := os.MkdirAll(options.OutDir, os.ModePerm)
-	panicIf(err)
-	typesFile, err := os.OpenFile(filepath.Join(options.OutDir, "openapi.json"), os.O_WRONLY|os.O_CREATE, 0755)
-	panicIf(err)
-	parser := typegen.NewParser()
-	parser.CustomParse = CustomParse
 	allRoutes := []Route{}
 	for _, getRoutes := range options.Routes {
 		genValue := reflect.ValueOf(getRoutes)
@@ -28,11 +24,34 @@ func GenerateOpenApiSpec(options *TypesGenConfig) {
 		allRoutes = append(allRoutes, routes...)
 	}
 
+	versions := routeVersions(allRoutes)
+	if len(versions) == 0 {
+		generateOpenApiSpec(options.OutDir, "", allRoutes, options)
+		return
+	}
+	for _, version := range versions {
+		generateOpenApiSpec(versionDir(options.OutDir, version), version, versionRoutes(allRoutes, version), options)
+	}
+}
+
+func generateOpenApiSpec(outDir, version string, allRoutes []Route, options *TypesGenConfig) {
+	_ = os.RemoveAll(filepath.Join(outDir, "openapi.json"))
+	err := os.MkdirAll(outDir, os.ModePerm)
+	panicIf(err)
+	typesFile, err := os.OpenFile(filepath.Join(outDir, "openapi.json"), os.O_WRONLY|os.O_CREATE, 0755)
+	panicIf(err)
+	parser := typegen.NewParser()
+	parser.CustomParse = CustomParse
+
 	parser.ParseRaw(options.Types...)
+	infoVersion := "3.0.0"
+	if version != "" {
+		infoVersion = version
+	}
 	swag := spec.T{
 		OpenAPI: "3.0.0",
 		Info: &spec.Info{
-			Version: "3.0.0",
+			Version: infoVersion,
 		},
 		Paths: spec.Paths{},
 		Components: &spec.Components{
@@ -108,10 +127,12 @@ OUTER:
 		resp := spec.NewResponse()
 		description := "info"
 		resp.Description = &description
-		resp.Content = spec.NewContentWithSchemaRef(spec.NewSchemaRef(typegen.RefSchemaPrefix+r.ResType, nil), []string{"application/json"})
+		contentTypes := responseContentTypes(route.Transport)
+		resp.Content = spec.NewContentWithSchemaRef(spec.NewSchemaRef(typegen.RefSchemaPrefix+r.ResType, nil), contentTypes)
 		op.AddResponse(200, resp)
+		requestContentTypes := requestContentTypes(route.Transport, prepare(req))
 		swagger.Components.RequestBodies[r.ReqType] = &spec.RequestBodyRef{
-			Value: spec.NewRequestBody().WithContent(spec.NewContentWithSchemaRef(spec.NewSchemaRef(typegen.RefSchemaPrefix+r.ReqType, nil), []string{"application/json"})),
+			Value: spec.NewRequestBody().WithContent(spec.NewContentWithSchemaRef(spec.NewSchemaRef(typegen.RefSchemaPrefix+r.ReqType, nil), requestContentTypes)),
 		}
 		if p == nil {
 			pi := &spec.PathItem{}
@@ -119,8 +140,40 @@ OUTER:
 			p = pi
 		}
 		op.Tags = append(op.Tags, r.FnInfo.PkgName)
+		if route.Version != "" {
+			op.AddParameter(spec.NewHeaderParameter(VersionHeader).
+				WithRequired(true).
+				WithSchema(spec.NewStringSchema().WithEnum(route.Version)))
+		}
 		p.SetOperation(r.Method, op)
 
 	}
 
 }
+
+// responseContentTypes returns media types of responses of the transport.
+func responseContentTypes(t Transport) []string {
+	if ct, ok := t.(ContentTyper); ok {
+		return ct.ContentTypes()
+	}
+	return []string{"application/json"}
+}
+
+// requestContentTypes returns media types of request bodies of the route.
+func requestContentTypes(t Transport, p *preparedType) []string {
+	switch {
+	case len(p.FileMapping) != 0:
+		return []string{multipartContentType}
+	case len(p.FormMapping) != 0:
+		return []string{formContentType, multipartContentType}
+	case p.BodyField != noField && p.Chan:
+		// Records are streamed, see NdjsonTransport.
+		return []string{ndjsonContentType}
+	}
+	if _, ok := t.(*JsonTransport); ok {
+		// Transports built on JsonTransport (e.g. CsvTransport) change
+		// only responses, requests are sent as JSON.
+		return []string{jsonCodec.mediaType}
+	}
+	return responseContentTypes(t)
+}
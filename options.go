@@ -1,6 +1,7 @@
 package api2
 
 import (
+	"context"
 	"log"
 	"net/http"
 )
@@ -12,10 +13,24 @@ type HttpClient interface {
 
 type Config struct {
 	errorf        func(format string, args ...interface{})
+	logger        Logger
+	metrics       MetricsCollector
+	tracer        Tracer
 	authorization string // Affects only clients.
 	client        HttpClient
 	maxBody       int64
 	human         bool
+	interceptors  []Interceptor       // Affects only servers.
+	panicHook     PanicHook           // Affects only servers.
+	rethrowPanics bool                // Affects only servers.
+	concurrency   *ConcurrencyLimiter // Affects only servers.
+	cors          *CORS               // Affects only servers.
+	ambiguous     bool                // Affects only servers.
+
+	clientInterceptors []ClientInterceptor // Affects only clients.
+	clientValidation   bool                // Affects only clients.
+	contentType        string              // Affects only clients.
+	version            string              // Affects only clients.
 }
 
 const defaultMaxBody = 10 * 1024 * 1024
@@ -59,3 +74,36 @@ func HumanJSON(enabled bool) Option {
 		config.human = enabled
 	}
 }
+
+// ClientValidation makes the client check `validate:"..."` rules of
+// requests before sending them. If the check fails, Client.Call returns
+// *ValidationError without sending the request. The server always checks
+// the rules.
+func ClientValidation(enabled bool) Option {
+	return func(config *Config) {
+		config.clientValidation = enabled
+	}
+}
+
+// PanicHook is called by the server if a handler, Transport.DecodeRequest
+// or Transport.EncodeResponse panics. It receives the value passed to
+// panic and the stack trace of the goroutine.
+type PanicHook func(ctx context.Context, route *Route, recovered interface{}, stack []byte)
+
+// OnPanic sets the hook called when the server recovers from a panic.
+// Regardless of the hook, the panic is logged with the stack trace
+// using ErrorLogger and the client gets HTTP status 500 encoded with
+// Transport.EncodeError.
+func OnPanic(hook PanicHook) Option {
+	return func(config *Config) {
+		config.panicHook = hook
+	}
+}
+
+// RethrowPanics makes the server panic again after a panic was recovered,
+// logged and the error was sent to the client. It is useful in tests.
+func RethrowPanics(enabled bool) Option {
+	return func(config *Config) {
+		config.rethrowPanics = enabled
+	}
+}
@@ -0,0 +1,198 @@
+package api2
+
+import (
+	stderrors "errors"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/starius/api2/errors"
+)
+
+// CallerKeyFunc returns the identity of the caller of a request, e.g.
+// API key or IP address. It is used to apply limits per caller.
+type CallerKeyFunc func(r *http.Request) string
+
+// CallerKeyHeader returns CallerKeyFunc identifying callers by the value
+// of HTTP header, e.g. "Authorization" or "X-Api-Key".
+func CallerKeyHeader(name string) CallerKeyFunc {
+	return func(r *http.Request) string {
+		return r.Header.Get(name)
+	}
+}
+
+// CallerKeyRemoteIP identifies callers by IP address of the connection.
+// If the server is behind a proxy, use CallerKeyHeader with the header
+// set by the proxy instead.
+func CallerKeyRemoteIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// RateLimit configures token bucket rate limiting of a route.
+type RateLimit struct {
+	// Rate is the number of requests per second allowed in the long run.
+	Rate float64
+
+	// Burst is the maximum number of requests allowed at once (the size of
+	// the bucket). Zero means 1.
+	Burst int
+
+	// Key returns the identity of the caller. Every caller has its own
+	// bucket. If Key is nil, all callers share one bucket.
+	Key CallerKeyFunc
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+type rateLimiter struct {
+	rate  float64
+	burst float64
+	key   CallerKeyFunc
+
+	// Time needed to fill an empty bucket.
+	fillTime time.Duration
+
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+func newRateLimiter(limit *RateLimit, path string) *rateLimiter {
+	if limit == nil {
+		return nil
+	}
+	if !(limit.Rate > 0) {
+		panic(fmt.Sprintf("route %s: rate limit must be positive, got %v", path, limit.Rate))
+	}
+	if limit.Burst < 0 {
+		panic(fmt.Sprintf("route %s: burst must not be negative, got %d", path, limit.Burst))
+	}
+	burst := limit.Burst
+	if burst == 0 {
+		burst = 1
+	}
+	return &rateLimiter{
+		rate:     limit.Rate,
+		burst:    float64(burst),
+		key:      limit.Key,
+		fillTime: time.Duration(float64(burst) / limit.Rate * float64(time.Second)),
+		buckets:  make(map[string]*tokenBucket),
+	}
+}
+
+// allow takes a token from the bucket of the caller. If the bucket is
+// empty, it returns the time until a token becomes available.
+func (l *rateLimiter) allow(r *http.Request, now time.Time) (time.Duration, bool) {
+	key := ""
+	if l.key != nil {
+		key = l.key(r)
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if now.Sub(l.lastSweep) > l.fillTime {
+		// Full buckets are the same as missing ones, remove them to
+		// bound the memory used by callers who went away.
+		for k, b := range l.buckets {
+			if l.refill(b, now) >= l.burst {
+				delete(l.buckets, k)
+			}
+		}
+		l.lastSweep = now
+	}
+
+	b, has := l.buckets[key]
+	if !has {
+		b = &tokenBucket{tokens: l.burst, last: now}
+		l.buckets[key] = b
+	}
+	b.tokens = l.refill(b, now)
+	b.last = now
+	if b.tokens >= 1 {
+		b.tokens--
+		return 0, true
+	}
+	wait := (1 - b.tokens) / l.rate
+	return time.Duration(wait * float64(time.Second)), false
+}
+
+func (l *rateLimiter) refill(b *tokenBucket, now time.Time) float64 {
+	elapsed := now.Sub(b.last).Seconds()
+	if elapsed < 0 {
+		elapsed = 0
+	}
+	return math.Min(l.burst, b.tokens+elapsed*l.rate)
+}
+
+const retryAfterHeader = "Retry-After"
+
+// rejectRateLimited sets Retry-After header and returns the error to send.
+func rejectRateLimited(w http.ResponseWriter, delay time.Duration) error {
+	// Retry-After is in whole seconds, round up.
+	seconds := int64(math.Ceil(delay.Seconds()))
+	if seconds < 1 {
+		seconds = 1
+	}
+	w.Header().Set(retryAfterHeader, strconv.FormatInt(seconds, 10))
+	return errors.ResourceExhausted("rate limit exceeded, retry after %s", delay.Round(time.Millisecond))
+}
+
+// RetryAfterError is returned by Client.Call if the server rejected the
+// request and sent Retry-After header (e.g. 429 Too Many Requests).
+type RetryAfterError struct {
+	// Err is the error decoded by the transport.
+	Err error
+
+	// RetryAfter is the delay after which the request can be retried.
+	RetryAfter time.Duration
+}
+
+func (e *RetryAfterError) Error() string {
+	return fmt.Sprintf("%v (retry after %s)", e.Err, e.RetryAfter)
+}
+
+func (e *RetryAfterError) Unwrap() error {
+	return e.Err
+}
+
+// RetryAfter returns the delay requested by the server if err (or an
+// error wrapped by it) is RetryAfterError.
+func RetryAfter(err error) (time.Duration, bool) {
+	var retryErr *RetryAfterError
+	if !stderrors.As(err, &retryErr) {
+		return 0, false
+	}
+	return retryErr.RetryAfter, true
+}
+
+// parseRetryAfter parses Retry-After header: either delay in seconds or
+// HTTP date.
+func parseRetryAfter(header http.Header, now time.Time) (time.Duration, bool) {
+	value := header.Get(retryAfterHeader)
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.ParseInt(value, 10, 64); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := date.Sub(now)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
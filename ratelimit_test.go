@@ -0,0 +1,76 @@
+package api2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimiter(t *testing.T) {
+	l := newRateLimiter(&RateLimit{
+		Rate:  2,
+		Burst: 3,
+		Key:   CallerKeyHeader("X-Api-Key"),
+	}, "/test")
+
+	alice := httptest.NewRequest(http.MethodGet, "/test", nil)
+	alice.Header.Set("X-Api-Key", "alice")
+	bob := httptest.NewRequest(http.MethodGet, "/test", nil)
+	bob.Header.Set("X-Api-Key", "bob")
+
+	now := time.Unix(1000, 0)
+	for i := 0; i < 3; i++ {
+		_, ok := l.allow(alice, now)
+		require.True(t, ok)
+	}
+	delay, ok := l.allow(alice, now)
+	require.False(t, ok)
+	require.Equal(t, 500*time.Millisecond, delay)
+
+	// Other callers have their own buckets.
+	_, ok = l.allow(bob, now)
+	require.True(t, ok)
+
+	delay, ok = l.allow(alice, now.Add(250*time.Millisecond))
+	require.False(t, ok)
+	require.Equal(t, 250*time.Millisecond, delay)
+	_, ok = l.allow(alice, now.Add(500*time.Millisecond))
+	require.True(t, ok)
+
+	// Full buckets are removed.
+	_, ok = l.allow(alice, now.Add(time.Hour))
+	require.True(t, ok)
+	require.Len(t, l.buckets, 1)
+
+	require.Panics(t, func() {
+		newRateLimiter(&RateLimit{}, "/test")
+	})
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cases := []struct {
+		value string
+		want  time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"3", 3 * time.Second, true},
+		{"Mon, 01 Jan 2024 00:00:10 GMT", 10 * time.Second, true},
+		{"Sun, 31 Dec 2023 00:00:00 GMT", 0, true},
+		{"soon", 0, false},
+		{"-1", 0, false},
+	}
+	for _, tc := range cases {
+		header := http.Header{}
+		if tc.value != "" {
+			header.Set("Retry-After", tc.value)
+		}
+		got, ok := parseRetryAfter(header, now)
+		require.Equal(t, tc.ok, ok, tc.value)
+		require.Equal(t, tc.want, got, tc.value)
+	}
+}
@@ -0,0 +1,365 @@
+package api2
+
+import (
+	"fmt"
+	"regexp/syntax"
+	"strings"
+	"unicode"
+)
+
+// ConflictKind is the kind of RouteConflict.
+type ConflictKind int
+
+const (
+	// DuplicateRoute means that two routes match exactly the same requests,
+	// so the second one is unreachable.
+	DuplicateRoute ConflictKind = iota
+
+	// AmbiguousRoute means that some requests match both routes, e.g.
+	// "/users/:id" and "/users/me". Such requests are served by the more
+	// specific route (see the rules of matching in the description of
+	// paths). BindRoutes accepts ambiguous routes only with option
+	// AllowAmbiguousRoutes.
+	AmbiguousRoute
+)
+
+func (k ConflictKind) String() string {
+	switch k {
+	case DuplicateRoute:
+		return "duplicate"
+	case AmbiguousRoute:
+		return "ambiguous"
+	default:
+		return fmt.Sprintf("ConflictKind(%d)", int(k))
+	}
+}
+
+// RouteConflict describes two routes with the same method and version
+// which match the same requests.
+type RouteConflict struct {
+	Kind    ConflictKind
+	Method  string
+	Version string
+
+	Path    string
+	Handler string
+
+	// The route registered earlier.
+	OtherPath    string
+	OtherHandler string
+}
+
+func (c RouteConflict) String() string {
+	verb := "conflicts with"
+	if c.Kind == AmbiguousRoute {
+		verb = "is ambiguous with"
+	}
+	s := fmt.Sprintf("%s %s (%s) %s %s %s (%s)", c.Method, c.Path, c.Handler, verb, c.Method, c.OtherPath, c.OtherHandler)
+	if c.Version != "" {
+		s += " in version " + c.Version
+	}
+	return s
+}
+
+// RouteConflictError is returned by CheckRoutes. It lists all conflicts
+// found in the table of routes.
+type RouteConflictError struct {
+	Conflicts []RouteConflict
+}
+
+func (e *RouteConflictError) Error() string {
+	lines := make([]string, 0, len(e.Conflicts))
+	for _, c := range e.Conflicts {
+		lines = append(lines, c.String())
+	}
+	return fmt.Sprintf("found %d route conflict(s): %s", len(e.Conflicts), strings.Join(lines, "; "))
+}
+
+// AllowAmbiguousRoutes makes BindRoutes accept ambiguous routes (see
+// AmbiguousRoute), e.g. "/users/:id" next to "/users/me". Duplicate routes
+// are always rejected. Affects only servers.
+func AllowAmbiguousRoutes(enabled bool) Option {
+	return func(config *Config) {
+		config.ambiguous = enabled
+	}
+}
+
+// pathShape returns the key which is equal for paths matching the same
+// requests: names of parameters and trailing slashes are ignored.
+func pathShape(path string) (string, error) {
+	segments, err := parseMask(path)
+	if err != nil {
+		return "", err
+	}
+	parts := make([]string, 0, len(segments))
+	for _, s := range segments {
+		switch s.kind {
+		case staticSegment:
+			parts = append(parts, s.name)
+		case paramSegment:
+			parts = append(parts, ":{"+s.pattern+"}")
+		case catchAllSegment:
+			parts = append(parts, "*")
+		}
+	}
+	return "/" + strings.Join(parts, "/"), nil
+}
+
+// runeSet is a set of runes as pairs of inclusive ranges, like in
+// syntax.Regexp.Rune of character classes.
+type runeSet []rune
+
+func (s runeSet) has(r rune) bool {
+	for i := 0; i+1 < len(s); i += 2 {
+		if s[i] <= r && r <= s[i+1] {
+			return true
+		}
+	}
+	return false
+}
+
+func (s runeSet) intersects(other runeSet) bool {
+	for i := 0; i+1 < len(s); i += 2 {
+		for j := 0; j+1 < len(other); j += 2 {
+			if s[i] <= other[j+1] && other[j] <= s[i+1] {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// possibleRunes returns the runes which can appear in a match of re.
+// It returns false if any rune can appear.
+func possibleRunes(re *syntax.Regexp) (runeSet, bool) {
+	switch re.Op {
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		return nil, false
+	case syntax.OpLiteral:
+		var set runeSet
+		for _, r := range re.Rune {
+			set = append(set, r, r)
+			if re.Flags&syntax.FoldCase != 0 {
+				for f := unicode.SimpleFold(r); f != r; f = unicode.SimpleFold(f) {
+					set = append(set, f, f)
+				}
+			}
+		}
+		return set, true
+	case syntax.OpCharClass:
+		return runeSet(re.Rune), true
+	}
+	var set runeSet
+	for _, sub := range re.Sub {
+		subSet, ok := possibleRunes(sub)
+		if !ok {
+			return nil, false
+		}
+		set = append(set, subSet...)
+	}
+	return set, true
+}
+
+// requiredRunes returns runes which appear in every match of re. It may
+// return less runes than there are, e.g. "-" for uuid.
+func requiredRunes(re *syntax.Regexp) []rune {
+	switch re.Op {
+	case syntax.OpLiteral:
+		if re.Flags&syntax.FoldCase != 0 {
+			return nil
+		}
+		return re.Rune
+	case syntax.OpCharClass:
+		if len(re.Rune) == 2 && re.Rune[0] == re.Rune[1] {
+			return re.Rune[:1]
+		}
+		return nil
+	case syntax.OpCapture, syntax.OpPlus:
+		return requiredRunes(re.Sub[0])
+	case syntax.OpRepeat:
+		if re.Min >= 1 {
+			return requiredRunes(re.Sub[0])
+		}
+		return nil
+	case syntax.OpConcat:
+		var runes []rune
+		for _, sub := range re.Sub {
+			runes = append(runes, requiredRunes(sub)...)
+		}
+		return runes
+	case syntax.OpAlternate:
+		runes := requiredRunes(re.Sub[0])
+		for _, sub := range re.Sub[1:] {
+			subRunes := requiredRunes(sub)
+			var common []rune
+			for _, r := range runes {
+				for _, r2 := range subRunes {
+					if r == r2 {
+						common = append(common, r)
+						break
+					}
+				}
+			}
+			runes = common
+		}
+		return runes
+	default:
+		return nil
+	}
+}
+
+// constraintsDisjoint returns if no segment matches both constraints. It
+// checks only the runes the matches can and must contain, e.g. int and
+// "[a-z]+" are disjoint, while "[a-z]{2}" and "[a-z]{3}" are reported as
+// overlapping.
+func constraintsDisjoint(a, b *segment) bool {
+	if a.re == nil || b.re == nil {
+		return false
+	}
+	if a.re.MatchString("") && b.re.MatchString("") {
+		return false
+	}
+	reA, errA := syntax.Parse(a.pattern, syntax.Perl)
+	reB, errB := syntax.Parse(b.pattern, syntax.Perl)
+	if errA != nil || errB != nil {
+		return false
+	}
+	reA, reB = reA.Simplify(), reB.Simplify()
+	setA, okA := possibleRunes(reA)
+	setB, okB := possibleRunes(reB)
+	if okA && okB && !setA.intersects(setB) {
+		// A non-empty match of one can't be a match of the other.
+		return true
+	}
+	for _, r := range requiredRunes(reA) {
+		if okB && !setB.has(r) {
+			return true
+		}
+	}
+	for _, r := range requiredRunes(reB) {
+		if okA && !setA.has(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// segmentsOverlap returns if some path matches both masks. Parameters with
+// different constraints are assumed to overlap unless constraintsDisjoint
+// proves that they don't.
+func segmentsOverlap(a, b []segment) bool {
+	if len(a) != 0 && a[0].kind == catchAllSegment {
+		return true
+	}
+	if len(b) != 0 && b[0].kind == catchAllSegment {
+		return true
+	}
+	if len(a) == 0 || len(b) == 0 {
+		return len(a) == len(b)
+	}
+	x, y := a[0], b[0]
+	if y.kind == staticSegment {
+		x, y = y, x
+	}
+	switch {
+	case x.kind == staticSegment && y.kind == staticSegment:
+		if x.name != y.name {
+			return false
+		}
+	case x.kind == staticSegment:
+		if y.re != nil && !y.re.MatchString(x.name) {
+			return false
+		}
+	case x.kind == paramSegment && y.kind == paramSegment:
+		if constraintsDisjoint(&x, &y) {
+			return false
+		}
+	}
+	return segmentsOverlap(a[1:], b[1:])
+}
+
+// CheckRoutes finds routes with the same method and version which match
+// the same requests. Duplicate routes (DuplicateRoute) have paths which
+// differ only in names of parameters or trailing slashes, e.g.
+// "/users/:id" and "/users/:name/". Ambiguous routes (AmbiguousRoute)
+// match some requests in common, e.g. "/users/:id" and "/users/me" or
+// "/files/*path" and "/files/readme". It returns *RouteConflictError
+// listing all the conflicts or nil. BindRoutes panics if the table has
+// conflicts (see AllowAmbiguousRoutes), so the function is useful to check
+// tables in tests.
+//
+// Malformed paths are skipped, they are reported by BindRoutes and
+// NewClient.
+func CheckRoutes(routes []Route) error {
+	type parsedRoute struct {
+		route     *Route
+		segments  []segment
+		shape     string
+		duplicate bool
+	}
+	parsed := make([]*parsedRoute, 0, len(routes))
+	for i := range routes {
+		route := &routes[i]
+		segments, err := parseMask(route.Path)
+		if err != nil {
+			continue
+		}
+		shape, err := pathShape(route.Path)
+		if err != nil {
+			continue
+		}
+		parsed = append(parsed, &parsedRoute{route: route, segments: segments, shape: shape})
+	}
+
+	var conflicts []RouteConflict
+	for j, b := range parsed {
+		for _, a := range parsed[:j] {
+			if a.duplicate || a.route.Method != b.route.Method || a.route.Version != b.route.Version {
+				continue
+			}
+			kind := DuplicateRoute
+			if a.shape != b.shape {
+				if !segmentsOverlap(a.segments, b.segments) {
+					continue
+				}
+				kind = AmbiguousRoute
+			}
+			conflicts = append(conflicts, RouteConflict{
+				Kind:         kind,
+				Method:       b.route.Method,
+				Version:      b.route.Version,
+				Path:         b.route.Path,
+				Handler:      handlerName(b.route.Handler),
+				OtherPath:    a.route.Path,
+				OtherHandler: handlerName(a.route.Handler),
+			})
+			if kind == DuplicateRoute {
+				// The route is unreachable, don't report it again.
+				b.duplicate = true
+				break
+			}
+		}
+	}
+	if len(conflicts) != 0 {
+		return &RouteConflictError{Conflicts: conflicts}
+	}
+	return nil
+}
+
+// checkRoutes is CheckRoutes ignoring ambiguous routes if they are allowed.
+func checkRoutes(routes []Route, allowAmbiguous bool) error {
+	err := CheckRoutes(routes)
+	if err == nil || !allowAmbiguous {
+		return err
+	}
+	var conflicts []RouteConflict
+	for _, c := range err.(*RouteConflictError).Conflicts {
+		if c.Kind != AmbiguousRoute {
+			conflicts = append(conflicts, c)
+		}
+	}
+	if len(conflicts) == 0 {
+		return nil
+	}
+	return &RouteConflictError{Conflicts: conflicts}
+}
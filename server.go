@@ -3,9 +3,13 @@ package api2
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"net/http"
 	"reflect"
+	"runtime/debug"
+	"strings"
+	"time"
 )
 
 type errorMessage struct {
@@ -26,115 +30,216 @@ func jsonError(w http.ResponseWriter, human bool, code int, format string, args
 }
 
 // BindRoutes adds handlers of routes to http.ServeMux.
+// It panics if routes conflict, see CheckRoutes and AllowAmbiguousRoutes,
+// or if a CORS policy allows any origin with credentials.
+//
+// Note that ambiguous routes (e.g. "/users/:id" and "/users/me") used to
+// be accepted silently. Now BindRoutes panics on them, pass option
+// AllowAmbiguousRoutes(true) to keep such tables working.
 func BindRoutes(mux Router, routes []Route, opts ...Option) {
 	config := NewDefaultConfig()
 	for _, opt := range opts {
 		opt(config)
 	}
-	errorf := config.errorf
+	logger := config.getLogger()
 	human := config.human
 
-	path2routes := make(map[string][]Route)
-	for _, route := range routes {
-		path := cutUrlParams(route.Path)
-		path2routes[path] = append(path2routes[path], route)
+	if err := checkRoutes(routes, config.ambiguous); err != nil {
+		panic(err.Error())
+	}
+	if err := checkCORS(routes, config.cors); err != nil {
+		panic(err.Error())
 	}
 
-	for path, routes := range path2routes {
-		method2routes := make(map[string][]Route, len(routes))
-		for _, route := range routes {
-			method2routes[route.Method] = append(method2routes[route.Method], route)
-		}
-		method2handler := make(map[string]http.HandlerFunc, len(routes))
-		for method, routes := range method2routes {
-			method2handler[method] = newHTTPMethodHandler(routes, human, errorf)
-		}
+	method2router := newMethodRouters(routes, func(route Route) http.HandlerFunc {
+		return newHTTPHandler(route, config)
+	})
 
-		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
-			// Calling FormValue before parsing JSON "eats" r.Body if Content-Type is
-			// application/x-www-form-urlencoded. This happens in curl for me.
-			human2 := human || r.FormValue("human") != ""
-			if human2 {
-				r = r.WithContext(context.WithValue(r.Context(), humanType{}, true))
+	// All paths are matched by one trie per method, so the order of
+	// registration in mux does not matter.
+	handler := func(w http.ResponseWriter, r *http.Request) {
+		// Don't use FormValue: it "eats" r.Body of form requests.
+		human2 := human || r.URL.Query().Get("human") != ""
+		if human2 {
+			r = r.WithContext(context.WithValue(r.Context(), humanType{}, true))
+		}
+		version := requestVersion(r)
+		method := method2router.routeMethod(r.Method, r.URL.Path)
+		router, index, param2value := method2router.find(method, version, r.URL.Path)
+		if router == nil {
+			if version != "" && method2router.hasPath(method, r.URL.Path) {
+				if err := jsonError(w, human2, http.StatusBadRequest, "unsupported API version: %s", version); err != nil {
+					logger.Log(r.Context(), LevelError, "handler failed to send BadRequest error to client", "method", r.Method, "path", r.URL.Path, "error", err)
+				}
+				return
 			}
-			handler, has := method2handler[r.Method]
-			if !has {
+			if allow := method2router.allowedMethods(r.URL.Path); allow != nil {
+				w.Header().Set("Allow", strings.Join(allow, ", "))
+				if r.Method == http.MethodOptions {
+					method2router.answerOptions(w, r, config.cors, allow)
+					return
+				}
 				if err := jsonError(w, human2, http.StatusMethodNotAllowed, "unsupported method: %v", r.Method); err != nil {
-					errorf("%s handler failed to send MethodNotAllowed error to client: %v", r.URL.Path, err)
+					logger.Log(r.Context(), LevelError, "handler failed to send MethodNotAllowed error to client", "method", r.Method, "path", r.URL.Path, "error", err)
 				}
 				return
 			}
-			r.Body = http.MaxBytesReader(w, r.Body, config.maxBody)
-			handler(w, r)
-		})
+			if err := jsonError(w, human2, http.StatusNotFound, "failed to find route by path"); err != nil {
+				logger.Log(r.Context(), LevelError, "handler failed to send NotFound error to client", "method", r.Method, "path", r.URL.Path, "error", err)
+			}
+			return
+		}
+		if origin := r.Header.Get("Origin"); origin != "" {
+			if cors := routeCORS(&router.routes[index], config.cors); cors != nil {
+				cors.setHeaders(w.Header(), origin)
+			}
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, config.maxBody)
+		// The limit of decompressed body (see Compression).
+		ctx := context.WithValue(r.Context(), maxBodyType{}, config.maxBody)
+		ctx = context.WithValue(ctx, paramMapType{}, param2value)
+		router.handlers[index](w, r.WithContext(ctx))
 	}
-}
 
-// GetMatcher returns a function converting http.Request to Route.
-func GetMatcher(routes []Route) func(*http.Request) (*Route, bool) {
-	path2method2route := make(map[string]map[string]*Route)
+	path2routes := make(map[string][]Route)
+	var paths []string
 	for _, route := range routes {
-		route := route
-		method2route, has := path2method2route[route.Path]
-		if !has {
-			method2route = make(map[string]*Route)
-			path2method2route[route.Path] = method2route
+		path := cutUrlParams(route.Path)
+		if _, has := path2routes[path]; !has {
+			paths = append(paths, path)
 		}
-		method2route[route.Method] = &route
+		path2routes[path] = append(path2routes[path], route)
+	}
+	for _, path := range paths {
+		handleFunc(mux, path, handler, path2routes[path])
 	}
+}
+
+// handleFunc registers the pattern in mux. If mux panics (e.g. the
+// pattern was registered by previous call of BindRoutes), it panics with
+// the list of routes using the pattern.
+func handleFunc(mux Router, pattern string, handler http.HandlerFunc, routes []Route) {
+	defer func() {
+		recovered := recover()
+		if recovered == nil {
+			return
+		}
+		descriptions := make([]string, 0, len(routes))
+		for _, route := range routes {
+			descriptions = append(descriptions, fmt.Sprintf("%s %s (%s)", route.Method, route.Path, handlerName(route.Handler)))
+		}
+		panic(fmt.Sprintf("failed to register pattern %q of routes %s: %v", pattern, strings.Join(descriptions, ", "), recovered))
+	}()
+	mux.HandleFunc(pattern, handler)
+}
 
-	// Use mux to detect route.Path from http.Request.
-	mux := http.NewServeMux()
-	BindRoutes(mux, routes)
+// methodRouter finds the route of a method and version by path.
+type methodRouter struct {
+	version    string
+	classifier *classifier
+	routes     []Route
+	handlers   []http.HandlerFunc
+}
 
-	return func(r *http.Request) (*Route, bool) {
-		_, path := mux.Handler(r)
-		method2route, has := path2method2route[path]
-		if !has {
-			return nil, false
+// methodRouters maps a method to its routers, one per version, in the
+// order of first appearance of versions in the table of routes.
+type methodRouters map[string][]*methodRouter
+
+func newMethodRouters(routes []Route, newHandler func(route Route) http.HandlerFunc) methodRouters {
+	method2router := make(methodRouters)
+	for _, route := range routes {
+		var router *methodRouter
+		for _, r := range method2router[route.Method] {
+			if r.version == route.Version {
+				router = r
+				break
+			}
+		}
+		if router == nil {
+			router = &methodRouter{version: route.Version}
+			method2router[route.Method] = append(method2router[route.Method], router)
+		}
+		router.routes = append(router.routes, route)
+		if newHandler != nil {
+			router.handlers = append(router.handlers, newHandler(route))
 		}
-		route, has := method2route[r.Method]
-		return route, has
 	}
+	for _, routers := range method2router {
+		for _, router := range routers {
+			paths := make([]string, 0, len(router.routes))
+			for _, route := range router.routes {
+				paths = append(paths, route.Path)
+			}
+			router.classifier = newPathClassifier(paths)
+		}
+	}
+	return method2router
 }
 
-func newHTTPMethodHandler(routes []Route, human bool, errorf func(format string, args ...interface{})) http.HandlerFunc {
-	if len(routes) == 1 && len(findUrlKeys(routes[0].Path)) == 0 {
-		// Single handler without URL parameters.
-		return newHTTPHandler(routes[0], human, errorf)
+// find returns the router and the index of the route matching the method,
+// the version and the path or nil if not found. Routes of the version are
+// preferred over unversioned routes. If the version is not specified,
+// unversioned routes are tried first and then all versions in order.
+func (m methodRouters) find(method, version, path string) (*methodRouter, int, map[string]string) {
+	first := func(v string) bool { return v == version }
+	second := func(v string) bool { return v == "" }
+	if version == "" {
+		second = func(string) bool { return true }
 	}
-	paths := make([]string, 0, len(routes))
-	handlers := make([]http.HandlerFunc, 0, len(routes))
-	for _, route := range routes {
-		paths = append(paths, route.Path)
-		handlers = append(handlers, newHTTPHandler(route, human, errorf))
+	for _, accept := range []func(string) bool{first, second} {
+		for _, router := range m[method] {
+			if !accept(router.version) {
+				continue
+			}
+			if index, param2value := router.classifier.Classify(path); index != -1 {
+				return router, index, param2value
+			}
+		}
 	}
-	c := newPathClassifier(paths)
+	return nil, -1, nil
+}
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		index, param2value := c.Classify(r.URL.Path)
-		if index == -1 {
-			// Calling FormValue before parsing JSON "eats" r.Body if Content-Type is
-			// application/x-www-form-urlencoded. This happens in curl for me.
-			human2 := human || r.FormValue("human") != ""
-			if err := jsonError(w, human2, http.StatusNotFound, "failed to find route by path"); err != nil {
-				errorf("%s handler failed to send NotFound error to client: %v", r.URL.Path, err)
+// hasPath returns if the path matches a route of the method (in any
+// version) or of any method if method is "".
+func (m methodRouters) hasPath(method, path string) bool {
+	for method1, routers := range m {
+		if method != "" && method1 != method {
+			continue
+		}
+		for _, router := range routers {
+			if index, _ := router.classifier.Classify(path); index != -1 {
+				return true
 			}
-			return
 		}
+	}
+	return false
+}
 
-		handler := handlers[index]
-		r = r.WithContext(context.WithValue(r.Context(), paramMapType{}, param2value))
-		handler(w, r)
+// GetMatcher returns a function converting http.Request to Route.
+func GetMatcher(routes []Route) func(*http.Request) (*Route, bool) {
+	method2router := newMethodRouters(routes, nil)
+
+	return func(r *http.Request) (*Route, bool) {
+		method := method2router.routeMethod(r.Method, r.URL.Path)
+		router, index, _ := method2router.find(method, requestVersion(r), r.URL.Path)
+		if router == nil {
+			return nil, false
+		}
+		return &router.routes[index], true
 	}
 }
 
-func newHTTPHandler(route Route, human bool, errorf func(format string, args ...interface{})) http.HandlerFunc {
+func newHTTPHandler(route Route, config *Config) http.HandlerFunc {
+	logger := config.getLogger()
+
 	h := route.Handler
 	t := route.Transport
 	if t == nil {
 		t = DefaultTransport
 	}
+	if _, ok := t.(upgrader); ok && route.Method != http.MethodGet {
+		panic(fmt.Sprintf("route %s %s: the transport upgrades the connection, so the method must be GET", route.Method, route.Path))
+	}
 
 	if m, ok := h.(*interfaceMethod); ok {
 		h = m.Func()
@@ -143,42 +248,199 @@ func newHTTPHandler(route Route, human bool, errorf func(format string, args ...
 	handlerValue := reflect.ValueOf(h)
 	handlerType := handlerValue.Type()
 	validateHandler(handlerType, route.Path)
+	validator := getValidator(handlerType.In(1).Elem())
+	name := handlerName(route.Handler)
+	limiter := newRateLimiter(route.RateLimit, route.Path)
+	var concurrencyLimiters []*ConcurrencyLimiter
+	for _, l := range []*ConcurrencyLimiter{route.Concurrency, config.concurrency} {
+		if l != nil {
+			l.check(route.Path)
+			concurrencyLimiters = append(concurrencyLimiters, l)
+		}
+	}
+
+	call := func(ctx context.Context, req interface{}) (interface{}, error) {
+		results := handlerValue.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(req)})
+		resp := results[0].Interface()
+		errReflect := results[1].Interface()
+		if errReflect != nil {
+			return resp, errReflect.(error)
+		}
+		return resp, nil
+	}
+	call = chainInterceptors(route.Interceptors, &route, call)
+	call = chainInterceptors(config.interceptors, &route, call)
+
+	return func(w0 http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		w := &statusWriter{ResponseWriter: w0}
+		ctx := context.WithValue(r.Context(), routeType{}, &route)
+		ctx = extractSpanContext(ctx, r.Header)
+		timeout := requestTimeout(r, &route)
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		var span Span
+		if config.tracer != nil {
+			ctx, span = config.tracer.StartSpan(ctx, name, SpanKindServer, &route)
+		}
+		r = r.WithContext(ctx)
+
+		// The outcome of the request, logged when the handler returns.
+		msg := "handler succeeded"
+		var (
+			failure error
+			stack   []byte
+		)
+		logf := func(level LogLevel, msg string, err error, extra ...interface{}) {
+			keyvals := []interface{}{
+				"method", r.Method,
+				"path", r.URL.Path,
+				"route", route.Path,
+				"handler", name,
+			}
+			keyvals = append(keyvals, extra...)
+			if err != nil {
+				keyvals = append(keyvals, "error", err)
+				if code := errorCode(t, err); code != "" {
+					keyvals = append(keyvals, "error_code", code)
+				}
+			}
+			logger.Log(ctx, level, msg, keyvals...)
+		}
+		if config.metrics != nil {
+			config.metrics.RequestStarted(&route)
+		}
+		defer func() {
+			latency := time.Since(start)
+			if w.status == 0 {
+				// Nothing was written, net/http sends 200.
+				w.status = http.StatusOK
+			}
+			if config.metrics != nil {
+				code := ""
+				if failure != nil {
+					code = errorCode(t, failure)
+				}
+				config.metrics.RequestFinished(&route, w.status, code, failure, latency)
+			}
+			if span != nil {
+				span.End(w.status, failure)
+			}
+			level := LevelInfo
+			extra := []interface{}{"status", w.status, "latency", latency}
+			if failure != nil {
+				level = LevelError
+			}
+			if stack != nil {
+				extra = append(extra, "stack", string(stack))
+			}
+			logf(level, msg, failure, extra...)
+		}()
+		encodeError := func(err error, what string) {
+			if err := t.EncodeError(ctx, w, err); err != nil {
+				logf(LevelError, "handler failed to send "+what+" to client", err)
+			}
+		}
+
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			if recovered == http.ErrAbortHandler {
+				// Used by net/http to abort the response silently.
+				panic(recovered)
+			}
+			stack = debug.Stack()
+			msg, failure = "handler panicked", fmt.Errorf("%v", recovered)
+			if config.panicHook != nil {
+				config.panicHook(ctx, &route, recovered, stack)
+			}
+			encodeError(httpError{
+				Code:    http.StatusInternalServerError,
+				Message: "internal server error",
+			}, "panic error")
+			if config.rethrowPanics {
+				panic(recovered)
+			}
+		}()
+
+		if limiter != nil {
+			if delay, ok := limiter.allow(r, time.Now()); !ok {
+				msg, failure = "handler rejected request over rate limit", rejectRateLimited(w, delay)
+				encodeError(failure, "rate limit error")
+				return
+			}
+		}
+
+		// Wait for the slot of the route first, then for the global one.
+		for _, l := range concurrencyLimiters {
+			if err := l.acquire(ctx); err != nil {
+				msg, failure = "handler rejected request over concurrency limit", err
+				encodeError(failure, "concurrency limit error")
+				return
+			}
+			defer l.release()
+		}
 
-	return func(w http.ResponseWriter, r *http.Request) {
-		ctx := r.Context()
 		req := reflect.New(handlerType.In(1).Elem()).Interface()
 		ctx, err := t.DecodeRequest(ctx, r, req)
 		if err != nil {
-			errorf("%s %s handler failed to parse request: %v", r.Method, r.URL.Path, err)
-			err = t.EncodeError(ctx, w, httpError{
-				Code:    http.StatusBadRequest,
-				Message: fmt.Sprintf("failed to parse request: %v", err),
-			})
-			if err != nil {
-				errorf("%s %s handler failed to send parsing error to client: %v", r.Method, r.URL.Path, err)
+			msg, failure = "handler failed to parse request", err
+			code := http.StatusBadRequest
+			var httpErr HttpError
+			if errors.As(err, &httpErr) {
+				// E.g. 415 Unsupported Media Type.
+				code = httpErr.HttpCode()
 			}
+			encodeError(httpError{
+				Code:    code,
+				Message: fmt.Sprintf("failed to parse request: %v", err),
+			}, "parsing error")
 			return
 		}
 
-		results := handlerValue.Call([]reflect.Value{reflect.ValueOf(ctx), reflect.ValueOf(req)})
-		resp := results[0].Interface()
-		errReflect := results[1].Interface()
+		if err := validator.validate(req); err != nil {
+			msg, failure = "handler got invalid request", err
+			encodeError(err, "validation error")
+			return
+		}
 
-		if errReflect != nil {
-			errorf("%s %s handler failed: %v", r.Method, r.URL.Path, errReflect)
-			if err := t.EncodeError(ctx, w, errReflect.(error)); err != nil {
-				errorf("%s %s handler failed to send handler error to client: %v", r.Method, r.URL.Path, err)
+		if u, ok := t.(upgrader); ok {
+			ctx, err = u.Upgrade(ctx, w, r, req)
+			if err != nil {
+				msg, failure = "handler failed to upgrade connection", err
+				encodeError(err, "upgrade error")
+				return
 			}
+		}
+
+		resp, err := call(ctx, req)
+		if timeout > 0 {
+			err = deadlineError(ctx, timeout, err)
+		}
+		if err != nil {
+			msg, failure = "handler failed", err
+			encodeError(err, "handler error")
 			return
 		}
 
 		if err := t.EncodeResponse(ctx, w, resp); err != nil {
-			errorf("%s %s handler failed to write response: %v", r.Method, r.URL.Path, err)
+			msg, failure = "handler failed to write response", err
 			return
 		}
 	}
 }
 
+// upgrader is implemented by transports taking over the connection
+// before the handler is called, e.g. WebSocketTransport.
+type upgrader interface {
+	Upgrade(ctx context.Context, w http.ResponseWriter, r *http.Request, req interface{}) (context.Context, error)
+}
+
 type httpError struct {
 	Code    int
 	Message string
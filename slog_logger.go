@@ -0,0 +1,22 @@
+//go:build go1.21
+
+package api2
+
+import (
+	"context"
+	"log/slog"
+)
+
+type slogLogger struct {
+	logger *slog.Logger
+}
+
+// SlogLogger converts *slog.Logger to Logger. Use it with option
+// StructuredLogger.
+func SlogLogger(logger *slog.Logger) Logger {
+	return slogLogger{logger: logger}
+}
+
+func (l slogLogger) Log(ctx context.Context, level LogLevel, msg string, keyvals ...interface{}) {
+	l.logger.Log(ctx, slog.Level(level), msg, keyvals...)
+}
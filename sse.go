@@ -0,0 +1,467 @@
+package api2
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	sseContentType = "text/event-stream"
+
+	// defaultSseRetry is the delay before reconnection if the server did
+	// not set it in field retry.
+	defaultSseRetry = 3 * time.Second
+)
+
+// httpClientType is the key of the context value storing HttpClient of
+// Client. SseTransport uses it to reconnect.
+type httpClientType struct{}
+
+var durationType = reflect.TypeOf(time.Duration(0))
+
+// sseEventType describes the type of events: which fields are passed in
+// SSE fields id, event and retry and which are encoded as JSON in data.
+type sseEventType struct {
+	IdField    int
+	EventField int
+	RetryField int
+	Ptr        bool
+
+	// If the event has SSE fields, fields for JSON are copied to an
+	// instance of TypeForJson, otherwise the whole event is encoded.
+	JsonMapping []intMapping
+	TypeForJson reflect.Type
+}
+
+var sseEventTypes sync.Map
+
+func prepareSseEvent(eventType reflect.Type) *sseEventType {
+	if e, has := sseEventTypes.Load(eventType); has {
+		return e.(*sseEventType)
+	}
+	e := &sseEventType{IdField: noField, EventField: noField, RetryField: noField}
+	structType := eventType
+	if structType.Kind() == reflect.Ptr {
+		e.Ptr = true
+		structType = structType.Elem()
+	}
+	if structType.Kind() == reflect.Struct {
+		jsonFields := make([]reflect.StructField, 0, structType.NumField())
+		for i := 0; i < structType.NumField(); i++ {
+			field := structType.Field(i)
+			if field.PkgPath != "" {
+				continue
+			}
+			switch sseKey := field.Tag.Get("sse"); sseKey {
+			case "id", "event":
+				if field.Type.Kind() != reflect.String {
+					panic(fmt.Sprintf("field %s of struct %s: sse:%q must be of type string, got %s", field.Name, structType.Name(), sseKey, field.Type))
+				}
+				if sseKey == "id" {
+					e.IdField = i
+				} else {
+					e.EventField = i
+				}
+			case "retry":
+				if field.Type != durationType {
+					panic(fmt.Sprintf("field %s of struct %s: sse:\"retry\" must be of type time.Duration, got %s", field.Name, structType.Name(), field.Type))
+				}
+				e.RetryField = i
+			case "":
+				e.JsonMapping = append(e.JsonMapping, intMapping{
+					OrigField: i,
+					JsonField: len(jsonFields),
+				})
+				jsonFields = append(jsonFields, field)
+			default:
+				panic(fmt.Sprintf("field %s of struct %s: unknown sse tag %q, want id, event or retry", field.Name, structType.Name(), sseKey))
+			}
+		}
+		if e.IdField != noField || e.EventField != noField || e.RetryField != noField {
+			e.TypeForJson = reflect.StructOf(jsonFields)
+		}
+	}
+	sseEventTypes.Store(eventType, e)
+	return e
+}
+
+// sseEventTypeOf returns the type of events if the transport sends
+// Server-Sent Events (see SseTransport) or nil.
+func sseEventTypeOf(t Transport, response reflect.Type) reflect.Type {
+	if jt, ok := t.(*JsonTransport); !ok || jt.ContentType != sseContentType {
+		// E.g. NdjsonTransport has responses of the same shape.
+		return nil
+	}
+	p := prepare(response)
+	if p.BodyField == noField {
+		return nil
+	}
+	field := response.Field(p.BodyField)
+	if field.Type.Kind() != reflect.Chan {
+		return nil
+	}
+	return field.Type.Elem()
+}
+
+// sseEvents returns the channel of events of SSE response.
+func sseEvents(res interface{}) (reflect.Value, *preparedType) {
+	objType := reflect.TypeOf(res).Elem()
+	p0, has := prepared.Load(objType)
+	if !has {
+		p0 = prepare(objType)
+		prepared.Store(objType, p0)
+	}
+	p := p0.(*preparedType)
+	if p.BodyField == noField || objType.Field(p.BodyField).Type.Kind() != reflect.Chan {
+		panic(fmt.Sprintf("response %s of SseTransport must have channel field with tag use_as_body", objType.Name()))
+	}
+	return reflect.ValueOf(res).Elem().Field(p.BodyField), p
+}
+
+// writeSseEvent writes the event in text/event-stream format.
+func writeSseEvent(w io.Writer, e *sseEventType, event reflect.Value) error {
+	var buf strings.Builder
+	data := event
+	if e.Ptr && !event.IsNil() {
+		event = event.Elem()
+	}
+	if e.TypeForJson != nil && event.Kind() == reflect.Struct {
+		if e.IdField != noField {
+			if id := event.Field(e.IdField).String(); id != "" {
+				if strings.ContainsAny(id, "\r\n\x00") {
+					return fmt.Errorf("SSE event id %q contains forbidden characters", id)
+				}
+				buf.WriteString("id: " + id + "\n")
+			}
+		}
+		if e.EventField != noField {
+			if name := event.Field(e.EventField).String(); name != "" {
+				if strings.ContainsAny(name, "\r\n") {
+					return fmt.Errorf("SSE event name %q contains forbidden characters", name)
+				}
+				buf.WriteString("event: " + name + "\n")
+			}
+		}
+		if e.RetryField != noField {
+			if retry := time.Duration(event.Field(e.RetryField).Int()); retry > 0 {
+				buf.WriteString("retry: " + strconv.FormatInt(retry.Milliseconds(), 10) + "\n")
+			}
+		}
+		forJson := reflect.New(e.TypeForJson).Elem()
+		for _, m := range e.JsonMapping {
+			forJson.Field(m.JsonField).Set(event.Field(m.OrigField))
+		}
+		data = forJson
+	}
+	// JSON does not contain newlines unless it is indented.
+	jsonData, err := json.Marshal(data.Interface())
+	if err != nil {
+		return fmt.Errorf("failed to marshal SSE event: %w", err)
+	}
+	buf.WriteString("data: ")
+	buf.Write(jsonData)
+	buf.WriteString("\n\n")
+	_, err = io.WriteString(w, buf.String())
+	return err
+}
+
+func sseEncodeResponse(ctx context.Context, w http.ResponseWriter, res interface{}) error {
+	events, p := sseEvents(res)
+	if events.IsNil() {
+		return fmt.Errorf("the channel of events is nil")
+	}
+
+	defer func() {
+		// Drain the channel.
+		for {
+			if _, ok := events.Recv(); !ok {
+				break
+			}
+		}
+	}()
+
+	objValue := reflect.ValueOf(res).Elem()
+	for _, m := range p.HeaderMapping {
+		value, err := toString(objValue.Field(m.Field).Interface())
+		if err != nil {
+			field := objValue.Type().Field(m.Field)
+			return fmt.Errorf("failed to marshal value for field %s: %w", field.Name, err)
+		}
+		w.Header().Set(m.Key, value)
+	}
+	w.Header().Set("Content-Type", sseContentType)
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+
+	httpFlusher, hasFlusher := w.(http.Flusher)
+	if hasFlusher {
+		httpFlusher.Flush()
+	}
+
+	e := prepareSseEvent(events.Type().Elem())
+	cases := []reflect.SelectCase{
+		{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		{Dir: reflect.SelectRecv, Chan: events},
+	}
+	for {
+		chosen, event, ok := reflect.Select(cases)
+		if chosen == 0 {
+			return ctx.Err()
+		}
+		if !ok {
+			return nil
+		}
+		if err := writeSseEvent(w, e, event); err != nil {
+			return err
+		}
+		if hasFlusher {
+			httpFlusher.Flush()
+		}
+	}
+}
+
+// sseReader reads events from text/event-stream body.
+type sseReader struct {
+	lastEventID string
+	retry       time.Duration
+}
+
+// read reads events from body and sends them to events until the end of
+// body. It returns the number of events received and the error reading
+// body (connErr) separately from other errors.
+func (s *sseReader) read(ctx context.Context, body io.Reader, events reflect.Value) (received int, connErr, err error) {
+	e := prepareSseEvent(events.Type().Elem())
+	reader := bufio.NewReader(body)
+	var data []string
+	hasData := false
+	name := ""
+	var retry time.Duration
+	for {
+		line, err := reader.ReadString('\n')
+		if err == io.EOF {
+			// Incomplete event in the end of the stream is discarded.
+			return received, nil, nil
+		}
+		if err != nil {
+			return received, err, nil
+		}
+		line = strings.TrimSuffix(strings.TrimSuffix(line, "\n"), "\r")
+
+		if line == "" {
+			// Dispatch the event.
+			if hasData {
+				event, err := s.decode(e, events.Type().Elem(), strings.Join(data, "\n"), name, retry)
+				if err != nil {
+					return received, nil, err
+				}
+				cases := []reflect.SelectCase{
+					{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+					{Dir: reflect.SelectSend, Chan: events, Send: event},
+				}
+				if chosen, _, _ := reflect.Select(cases); chosen == 0 {
+					return received, nil, ctx.Err()
+				}
+				received++
+			}
+			data, hasData, name, retry = data[:0], false, "", 0
+			continue
+		}
+		if strings.HasPrefix(line, ":") {
+			// Comment.
+			continue
+		}
+		field, value := line, ""
+		if i := strings.IndexByte(line, ':'); i != -1 {
+			field, value = line[:i], strings.TrimPrefix(line[i+1:], " ")
+		}
+		switch field {
+		case "data":
+			data = append(data, value)
+			hasData = true
+		case "event":
+			name = value
+		case "id":
+			if !strings.ContainsRune(value, 0) {
+				s.lastEventID = value
+			}
+		case "retry":
+			if ms, err := strconv.ParseInt(value, 10, 64); err == nil {
+				retry = time.Duration(ms) * time.Millisecond
+				s.retry = retry
+			}
+		}
+	}
+}
+
+// decode creates an event of type eventType from SSE fields.
+func (s *sseReader) decode(e *sseEventType, eventType reflect.Type, data, name string, retry time.Duration) (reflect.Value, error) {
+	eventPtr := reflect.New(eventType)
+	if e.TypeForJson == nil {
+		if err := json.Unmarshal([]byte(data), eventPtr.Interface()); err != nil {
+			return reflect.Value{}, fmt.Errorf("failed to unmarshal SSE event: %w", err)
+		}
+		return eventPtr.Elem(), nil
+	}
+
+	jsonPtrValue := reflect.New(e.TypeForJson)
+	if err := json.Unmarshal([]byte(data), jsonPtrValue.Interface()); err != nil {
+		return reflect.Value{}, fmt.Errorf("failed to unmarshal SSE event: %w", err)
+	}
+	event := eventPtr.Elem()
+	if e.Ptr {
+		event.Set(reflect.New(eventType.Elem()))
+		event = event.Elem()
+	}
+	jsonValue := jsonPtrValue.Elem()
+	for _, m := range e.JsonMapping {
+		event.Field(m.OrigField).Set(jsonValue.Field(m.JsonField))
+	}
+	if e.IdField != noField {
+		event.Field(e.IdField).SetString(s.lastEventID)
+	}
+	if e.EventField != noField {
+		event.Field(e.EventField).SetString(name)
+	}
+	if e.RetryField != noField {
+		event.Field(e.RetryField).SetInt(int64(retry))
+	}
+	return eventPtr.Elem(), nil
+}
+
+func sseDecodeResponse(ctx context.Context, httpRes *http.Response, res interface{}) error {
+	events, p := sseEvents(res)
+	if events.IsNil() {
+		panic("provide a channel of events in the response")
+	}
+	defer events.Close()
+
+	objValue := reflect.ValueOf(res).Elem()
+	for _, m := range p.HeaderMapping {
+		fieldPtr := objValue.Field(m.Field).Addr().Interface()
+		value := httpRes.Header.Get(m.Key)
+		if err := fromString(fieldPtr, value); err != nil {
+			field := objValue.Type().Field(m.Field)
+			return fmt.Errorf("failed to parse value %q from header key %s for field %s: %w", value, m.Key, field.Name, err)
+		}
+	}
+
+	s := &sseReader{retry: defaultSseRetry}
+	body := httpRes.Body
+	for {
+		received, connErr, err := s.read(ctx, body, events)
+		if body != httpRes.Body {
+			body.Close()
+		}
+		if err != nil {
+			return err
+		}
+		if connErr == nil {
+			// The server closed the stream.
+			return nil
+		}
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		client, ok := ctx.Value(httpClientType{}).(HttpClient)
+		if received == 0 || !ok || httpRes.Request == nil {
+			// Reconnect only if the connection was making progress.
+			return connErr
+		}
+
+		// The connection was broken, reconnect.
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.retry):
+		}
+		newRes, err2 := sseReconnect(ctx, client, httpRes.Request, s.lastEventID)
+		if err2 != nil {
+			return fmt.Errorf("failed to reconnect after error %v: %w", connErr, err2)
+		}
+		body = newRes.Body
+	}
+}
+
+// sseReconnect repeats the request with header Last-Event-ID.
+func sseReconnect(ctx context.Context, client HttpClient, request *http.Request, lastEventID string) (*http.Response, error) {
+	req := request.Clone(ctx)
+	if request.Body != nil && request.Body != http.NoBody {
+		if request.GetBody == nil {
+			return nil, fmt.Errorf("the request body can not be sent again")
+		}
+		body, err := request.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		req.Body = body
+	}
+	if lastEventID != "" {
+		req.Header.Set("Last-Event-ID", lastEventID)
+	}
+	res, err := client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	if res.StatusCode != http.StatusOK {
+		defer res.Body.Close()
+		return nil, (&JsonTransport{}).RawDecodeError(ctx, res)
+	}
+	body, err := decodeContentEncoding(ctx, res.Header, res.Body)
+	if err != nil {
+		res.Body.Close()
+		return nil, err
+	}
+	if maxBody, ok := ctx.Value(maxBodyType{}).(int64); ok {
+		body = http.MaxBytesReader(nil, body, maxBody)
+	}
+	res.Body = body
+	return res, nil
+}
+
+// SseTransport streams events to the client in Server-Sent Events format
+// (text/event-stream), which browsers consume with EventSource.
+//
+// The response must have a field of channel type with tag use_as_body and
+// may have header fields:
+//
+//	type WatchResponse struct {
+//		Events chan *PriceEvent `use_as_body:"true"`
+//	}
+//
+//	type PriceEvent struct {
+//		ID    string        `sse:"id"`
+//		Name  string        `sse:"event"`
+//		Retry time.Duration `sse:"retry"`
+//		Price float64       `json:"price"`
+//	}
+//
+// Fields of the event with tag sse are passed in SSE fields id, event and
+// retry, all of them are optional; other fields are encoded as JSON in
+// field data.
+//
+// In ResponseEncoder (server side) the channel should be set by the handler
+// and events written from a goroutine, which closes the channel to finish
+// the stream. The transport flushes each event and drains the channel.
+//
+// In ResponseDecoder (client side) the channel should be passed in response
+// object. The transport writes events to the channel and closes it before
+// returning. If the connection breaks after receiving some events, the
+// client waits for the retry delay (3 seconds unless set by the server)
+// and reconnects sending header Last-Event-ID, which the handler can
+// receive in a request field with tag header:"Last-Event-ID".
+//
+// Requests and errors are encoded as in JsonTransport.
+var SseTransport = &JsonTransport{
+	ResponseEncoder: sseEncodeResponse,
+	ResponseDecoder: sseDecodeResponse,
+	ContentType:     sseContentType,
+}
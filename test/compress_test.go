@@ -0,0 +1,247 @@
+package api2
+
+import (
+	"bufio"
+	"compress/gzip"
+	"compress/zlib"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompression(t *testing.T) {
+	type ListRequest struct {
+		Filter string `json:"filter"`
+		N      int    `query:"n"`
+	}
+	type ListResponse struct {
+		Items []string `json:"items"`
+	}
+	type UploadRequest struct {
+		Body io.ReadCloser `use_as_body:"true" is_stream:"true"`
+	}
+	type UploadResponse struct {
+		Body io.ReadCloser `use_as_body:"true" is_stream:"true"`
+	}
+
+	listHandler := func(ctx context.Context, req *ListRequest) (*ListResponse, error) {
+		items := make([]string, req.N)
+		for i := range items {
+			items[i] = req.Filter
+		}
+		return &ListResponse{Items: items}, nil
+	}
+
+	// The server gets the request stream line by line, the client sends
+	// the next line after the server got the previous one. It only works
+	// if the request is compressed incrementally.
+	lines := make(chan string)
+	uploadHandler := func(ctx context.Context, req *UploadRequest) (*UploadResponse, error) {
+		var all strings.Builder
+		scanner := bufio.NewScanner(req.Body)
+		for scanner.Scan() {
+			lines <- scanner.Text()
+			all.WriteString(scanner.Text())
+		}
+		if err := scanner.Err(); err != nil {
+			return nil, err
+		}
+		close(lines)
+		return &UploadResponse{
+			Body: io.NopCloser(strings.NewReader(strings.Repeat(all.String(), 10000))),
+		}, nil
+	}
+
+	compressed := &api2.JsonTransport{
+		Compression: &api2.Compression{MinSize: 100},
+	}
+	routes := []api2.Route{
+		{Method: http.MethodPost, Path: "/list", Handler: listHandler, Transport: compressed},
+		{Method: http.MethodPost, Path: "/upload", Handler: uploadHandler, Transport: compressed},
+	}
+
+	var mu sync.Mutex
+	var requestEncodings []string
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		requestEncodings = append(requestEncodings, r.Header.Get("Content-Encoding"))
+		mu.Unlock()
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL)
+	ctx := context.Background()
+
+	takeEncodings := func() []string {
+		mu.Lock()
+		defer mu.Unlock()
+		encodings := requestEncodings
+		requestEncodings = nil
+		return encodings
+	}
+
+	t.Run("client", func(t *testing.T) {
+		res := &ListResponse{}
+		require.NoError(t, client.Call(ctx, res, &ListRequest{Filter: "x", N: 3}))
+		require.Equal(t, []string{"x", "x", "x"}, res.Items)
+		require.Equal(t, []string{""}, takeEncodings())
+
+		filter := strings.Repeat("y", 1000)
+		require.NoError(t, client.Call(ctx, res, &ListRequest{Filter: filter, N: 1000}))
+		require.Len(t, res.Items, 1000)
+		require.Equal(t, filter, res.Items[999])
+		require.Equal(t, []string{"gzip"}, takeEncodings())
+	})
+
+	post := func(t *testing.T, n int, acceptEncoding string) *http.Response {
+		body := strings.NewReader(`{"filter":"abc"}`)
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/list?n="+strings.Repeat("9", n), body)
+		require.NoError(t, err)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		t.Cleanup(func() {
+			res.Body.Close()
+		})
+		return res
+	}
+
+	decode := func(t *testing.T, r io.Reader) *ListResponse {
+		res := &ListResponse{}
+		require.NoError(t, json.NewDecoder(r).Decode(res))
+		return res
+	}
+
+	t.Run("gzip response", func(t *testing.T) {
+		res := post(t, 3, "deflate;q=0.5, gzip")
+		require.Equal(t, "gzip", res.Header.Get("Content-Encoding"))
+		require.Equal(t, "Accept-Encoding", res.Header.Get("Vary"))
+		gr, err := gzip.NewReader(res.Body)
+		require.NoError(t, err)
+		require.Len(t, decode(t, gr).Items, 999)
+	})
+
+	t.Run("deflate response", func(t *testing.T) {
+		res := post(t, 3, "deflate, gzip;q=0")
+		require.Equal(t, "deflate", res.Header.Get("Content-Encoding"))
+		zr, err := zlib.NewReader(res.Body)
+		require.NoError(t, err)
+		require.Len(t, decode(t, zr).Items, 999)
+	})
+
+	t.Run("small response", func(t *testing.T) {
+		res := post(t, 1, "gzip")
+		require.Equal(t, "", res.Header.Get("Content-Encoding"))
+		require.Len(t, decode(t, res.Body).Items, 9)
+	})
+
+	t.Run("not accepted", func(t *testing.T) {
+		res := post(t, 3, "identity")
+		require.Equal(t, "", res.Header.Get("Content-Encoding"))
+		require.Len(t, decode(t, res.Body).Items, 999)
+	})
+
+	t.Run("unsupported request encoding", func(t *testing.T) {
+		req, err := http.NewRequest(http.MethodPost, server.URL+"/list", strings.NewReader(`{}`))
+		require.NoError(t, err)
+		req.Header.Set("Content-Encoding", "br")
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+
+	t.Run("stream", func(t *testing.T) {
+		takeEncodings()
+		pr, pw := io.Pipe()
+		res := &UploadResponse{}
+		callErr := make(chan error, 1)
+		go func() {
+			callErr <- client.Call(ctx, res, &UploadRequest{Body: pr})
+		}()
+
+		for _, line := range []string{"first", "second", "third"} {
+			_, err := pw.Write([]byte(line + "\n"))
+			require.NoError(t, err)
+			require.Equal(t, line, <-lines)
+		}
+		require.NoError(t, pw.Close())
+		_, open := <-lines
+		require.False(t, open)
+
+		require.NoError(t, <-callErr)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Equal(t, strings.Repeat("firstsecondthird", 10000), string(body))
+		require.Equal(t, []string{"gzip"}, takeEncodings())
+	})
+}
+
+func TestCompressedCSV(t *testing.T) {
+	type Request struct {
+	}
+
+	gotAlice := make(chan struct{})
+	getHandler := func(ctx context.Context, req *Request) (res *api2.CsvResponse, err error) {
+		rows := make(chan []string)
+		go func() {
+			defer close(rows)
+			rows <- []string{"Alice", "31"}
+			// The client must get Alice before Bob is sent.
+			<-gotAlice
+			rows <- []string{"Bob", "13"}
+		}()
+		return &api2.CsvResponse{
+			HttpCode:  http.StatusOK,
+			CsvHeader: []string{"Name", "Age"},
+			Rows:      rows,
+		}, nil
+	}
+
+	csvTransport := api2.CsvTransport.WithCompression(&api2.Compression{})
+	require.Nil(t, api2.CsvTransport.Compression)
+	routes := []api2.Route{
+		{Method: http.MethodGet, Path: "/csv", Handler: getHandler, Transport: csvTransport},
+	}
+
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	contentEncoding := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		contentEncoding <- w.Header().Get("Content-Encoding")
+	}))
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL)
+
+	res := &api2.CsvResponse{
+		Rows: make(chan []string),
+	}
+	var results [][]string
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for row := range res.Rows {
+			results = append(results, row)
+			if row[0] == "Alice" {
+				close(gotAlice)
+			}
+		}
+	}()
+	require.NoError(t, client.Call(context.Background(), res, &Request{}))
+	<-done
+
+	require.Equal(t, [][]string{{"Alice", "31"}, {"Bob", "13"}}, results)
+	require.Equal(t, "gzip", <-contentEncoding)
+}
@@ -0,0 +1,116 @@
+package api2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConcurrencyLimit(t *testing.T) {
+	type ExportRequest struct {
+	}
+	type ExportResponse struct {
+	}
+	type PingRequest struct {
+	}
+	type PingResponse struct {
+	}
+
+	unblock := make(chan struct{})
+	exportHandler := func(ctx context.Context, req *ExportRequest) (*ExportResponse, error) {
+		<-unblock
+		return &ExportResponse{}, nil
+	}
+	pingHandler := func(ctx context.Context, req *PingRequest) (*PingResponse, error) {
+		return &PingResponse{}, nil
+	}
+
+	exportLimiter := &api2.ConcurrencyLimiter{MaxInFlight: 1, MaxQueue: 1}
+	globalLimiter := &api2.ConcurrencyLimiter{MaxInFlight: 2}
+	routes := []api2.Route{
+		{Method: http.MethodPost, Path: "/export", Handler: exportHandler, Concurrency: exportLimiter},
+		{Method: http.MethodPost, Path: "/ping", Handler: pingHandler},
+	}
+
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes, api2.GlobalConcurrency(globalLimiter))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL)
+	ctx := context.Background()
+
+	errs := make(chan error, 2)
+	for i := 0; i < 2; i++ {
+		go func() {
+			errs <- client.Call(ctx, &ExportResponse{}, &ExportRequest{})
+		}()
+	}
+	require.Eventually(t, func() bool {
+		// The queued request does not occupy a global slot.
+		return exportLimiter.InFlight() == 1 && exportLimiter.QueueDepth() == 1 && globalLimiter.InFlight() == 1
+	}, time.Second, time.Millisecond)
+	require.NoError(t, client.Call(ctx, &PingResponse{}, &PingRequest{}))
+
+	// The queue is full.
+	err := client.Call(ctx, &ExportResponse{}, &ExportRequest{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "503")
+	require.Contains(t, err.Error(), "too many requests in flight")
+
+	close(unblock)
+	require.NoError(t, <-errs)
+	require.NoError(t, <-errs)
+	require.Equal(t, 0, exportLimiter.InFlight())
+	require.Equal(t, 0, exportLimiter.QueueDepth())
+	require.Eventually(t, func() bool {
+		return globalLimiter.InFlight() == 0
+	}, time.Second, time.Millisecond)
+}
+
+func TestConcurrencyQueueTimeout(t *testing.T) {
+	type SlowRequest struct {
+	}
+	type SlowResponse struct {
+	}
+
+	unblock := make(chan struct{})
+	slowHandler := func(ctx context.Context, req *SlowRequest) (*SlowResponse, error) {
+		<-unblock
+		return &SlowResponse{}, nil
+	}
+
+	limiter := &api2.ConcurrencyLimiter{MaxInFlight: 1, MaxQueue: 10, QueueTimeout: 50 * time.Millisecond}
+	routes := []api2.Route{
+		{Method: http.MethodPost, Path: "/slow", Handler: slowHandler, Concurrency: limiter},
+	}
+
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL)
+	ctx := context.Background()
+
+	errs := make(chan error, 1)
+	go func() {
+		errs <- client.Call(ctx, &SlowResponse{}, &SlowRequest{})
+	}()
+	require.Eventually(t, func() bool {
+		return limiter.InFlight() == 1
+	}, time.Second, time.Millisecond)
+
+	t1 := time.Now()
+	err := client.Call(ctx, &SlowResponse{}, &SlowRequest{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "waited in queue for 50ms")
+	require.GreaterOrEqual(t, time.Since(t1), 50*time.Millisecond)
+	require.Equal(t, 0, limiter.QueueDepth())
+
+	close(unblock)
+	require.NoError(t, <-errs)
+}
@@ -0,0 +1,184 @@
+package api2
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+type GetItemRequest struct {
+	ID string `url:"id"`
+}
+
+type GetItemResponse struct {
+	Name  string `json:"name"`
+	Count int    `header:"X-Count"`
+}
+
+type DeleteItemRequest struct {
+	ID string `url:"id"`
+}
+
+type DeleteItemResponse struct {
+}
+
+func TestCors(t *testing.T) {
+	getItem := func(ctx context.Context, req *GetItemRequest) (*GetItemResponse, error) {
+		return &GetItemResponse{Name: "item " + req.ID, Count: 3}, nil
+	}
+	deleteItem := func(ctx context.Context, req *DeleteItemRequest) (*DeleteItemResponse, error) {
+		return &DeleteItemResponse{}, nil
+	}
+	getPrivateItem := func(ctx context.Context, req *GetUserV1Request) (*GetUserV1Response, error) {
+		return &GetUserV1Response{Name: "private"}, nil
+	}
+
+	routes := []api2.Route{
+		{Method: http.MethodGet, Path: "/items/:id", Handler: getItem},
+		{Method: http.MethodDelete, Path: "/items/:id", Handler: deleteItem},
+		{
+			Method:  http.MethodGet,
+			Path:    "/private/:id",
+			Handler: getPrivateItem,
+			Meta: map[string]interface{}{
+				api2.CORSMetaKey: (*api2.CORS)(nil),
+			},
+		},
+	}
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes, api2.Cors(&api2.CORS{
+		AllowedOrigins: []string{"https://app.example.com"},
+		AllowedHeaders: []string{"X-Custom"},
+		ExposedHeaders: []string{"X-Count"},
+		MaxAge:         time.Hour,
+	}))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	do := func(t *testing.T, method, path string, header map[string]string) (*http.Response, string) {
+		req, err := http.NewRequest(method, server.URL+path, nil)
+		require.NoError(t, err)
+		for k, v := range header {
+			req.Header.Set(k, v)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, string(body)
+	}
+
+	t.Run("preflight", func(t *testing.T) {
+		res, body := do(t, http.MethodOptions, "/items/1", map[string]string{
+			"Origin":                         "https://app.example.com",
+			"Access-Control-Request-Method":  http.MethodDelete,
+			"Access-Control-Request-Headers": "x-api2-timeout",
+		})
+		require.Equal(t, http.StatusNoContent, res.StatusCode)
+		require.Equal(t, "", body)
+		require.Equal(t, "DELETE, GET, HEAD, OPTIONS", res.Header.Get("Allow"))
+		require.Equal(t, "https://app.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "DELETE, GET, HEAD, OPTIONS", res.Header.Get("Access-Control-Allow-Methods"))
+		require.Equal(t, "Content-Type, Authorization, X-Api2-Timeout, X-Api2-Version, Traceparent, Tracestate, X-Custom", res.Header.Get("Access-Control-Allow-Headers"))
+		require.Equal(t, "3600", res.Header.Get("Access-Control-Max-Age"))
+	})
+
+	t.Run("preflight from unknown origin", func(t *testing.T) {
+		res, _ := do(t, http.MethodOptions, "/items/1", map[string]string{
+			"Origin":                        "https://evil.example.com",
+			"Access-Control-Request-Method": http.MethodGet,
+		})
+		require.Equal(t, http.StatusNoContent, res.StatusCode)
+		require.Equal(t, "", res.Header.Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("preflight of route without CORS", func(t *testing.T) {
+		res, _ := do(t, http.MethodOptions, "/private/1", map[string]string{
+			"Origin":                        "https://app.example.com",
+			"Access-Control-Request-Method": http.MethodGet,
+		})
+		require.Equal(t, http.StatusNoContent, res.StatusCode)
+		require.Equal(t, "GET, HEAD, OPTIONS", res.Header.Get("Allow"))
+		require.Equal(t, "", res.Header.Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("plain options", func(t *testing.T) {
+		res, _ := do(t, http.MethodOptions, "/items/1", nil)
+		require.Equal(t, http.StatusNoContent, res.StatusCode)
+		require.Equal(t, "DELETE, GET, HEAD, OPTIONS", res.Header.Get("Allow"))
+		require.Equal(t, "", res.Header.Get("Access-Control-Allow-Origin"))
+
+		res, _ = do(t, http.MethodOptions, "/unknown/1", nil)
+		require.Equal(t, http.StatusNotFound, res.StatusCode)
+	})
+
+	t.Run("actual request", func(t *testing.T) {
+		res, body := do(t, http.MethodGet, "/items/1", map[string]string{
+			"Origin": "https://app.example.com",
+		})
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.JSONEq(t, `{"name":"item 1"}`, body)
+		require.Equal(t, "https://app.example.com", res.Header.Get("Access-Control-Allow-Origin"))
+		require.Equal(t, "X-Count", res.Header.Get("Access-Control-Expose-Headers"))
+		require.Equal(t, "Origin", res.Header.Get("Vary"))
+
+		res, _ = do(t, http.MethodGet, "/private/1", map[string]string{
+			"Origin": "https://app.example.com",
+		})
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "", res.Header.Get("Access-Control-Allow-Origin"))
+	})
+
+	t.Run("head", func(t *testing.T) {
+		res, body := do(t, http.MethodHead, "/items/1", nil)
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "", body)
+		require.Equal(t, "3", res.Header.Get("X-Count"))
+
+		matcher := api2.GetMatcher(routes)
+		route, has := matcher(httptest.NewRequest(http.MethodHead, "/items/1", nil))
+		require.True(t, has)
+		require.Equal(t, http.MethodGet, route.Method)
+	})
+
+	t.Run("method not allowed", func(t *testing.T) {
+		res, body := do(t, http.MethodPost, "/items/1", nil)
+		require.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+		require.Equal(t, "DELETE, GET, HEAD, OPTIONS", res.Header.Get("Allow"))
+		require.Contains(t, body, "unsupported method: POST")
+	})
+
+	t.Run("any origin with credentials", func(t *testing.T) {
+		anyOrigin := &api2.CORS{
+			AllowedOrigins:   []string{"*"},
+			AllowCredentials: true,
+		}
+		require.Panics(t, func() {
+			api2.BindRoutes(http.NewServeMux(), routes[:2], api2.Cors(anyOrigin))
+		})
+		require.Panics(t, func() {
+			api2.BindRoutes(http.NewServeMux(), []api2.Route{
+				{
+					Method:  http.MethodGet,
+					Path:    "/items/:id",
+					Handler: getItem,
+					Meta: map[string]interface{}{
+						api2.CORSMetaKey: anyOrigin,
+					},
+				},
+			})
+		})
+		require.NotPanics(t, func() {
+			api2.BindRoutes(http.NewServeMux(), routes[:2], api2.Cors(&api2.CORS{
+				AllowedOrigins: []string{"*"},
+			}))
+		})
+	})
+}
@@ -0,0 +1,112 @@
+package api2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestDeadline(t *testing.T) {
+	type WaitRequest struct {
+		IgnoreCtx bool `json:"ignore_ctx"`
+	}
+	type WaitResponse struct {
+	}
+	type SlowRequest struct {
+	}
+	type SlowResponse struct {
+	}
+
+	type observation struct {
+		timeout time.Duration
+		err     error
+	}
+	observed := make(chan observation, 1)
+	waitHandler := func(ctx context.Context, req *WaitRequest) (*WaitResponse, error) {
+		deadline, has := ctx.Deadline()
+		if !has {
+			observed <- observation{}
+			return &WaitResponse{}, nil
+		}
+		timeout := time.Until(deadline)
+		if req.IgnoreCtx {
+			time.Sleep(timeout + 50*time.Millisecond)
+			observed <- observation{timeout: timeout}
+			return &WaitResponse{}, nil
+		}
+		<-ctx.Done()
+		observed <- observation{timeout: timeout, err: ctx.Err()}
+		return nil, ctx.Err()
+	}
+	slowHandler := func(ctx context.Context, req *SlowRequest) (*SlowResponse, error) {
+		<-ctx.Done()
+		return nil, ctx.Err()
+	}
+
+	routes := []api2.Route{
+		{Method: http.MethodPost, Path: "/wait", Handler: waitHandler},
+		{Method: http.MethodPost, Path: "/slow", Handler: slowHandler, Timeout: 50 * time.Millisecond},
+	}
+
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL)
+
+	t.Run("no deadline", func(t *testing.T) {
+		require.NoError(t, client.Call(context.Background(), &WaitResponse{}, &WaitRequest{}))
+		require.Equal(t, observation{}, <-observed)
+	})
+
+	t.Run("client deadline", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 200*time.Millisecond)
+		defer cancel()
+		require.Error(t, client.Call(ctx, &WaitResponse{}, &WaitRequest{}))
+		o := <-observed
+		require.Equal(t, context.DeadlineExceeded, o.err)
+		require.Greater(t, o.timeout, 100*time.Millisecond)
+		require.LessOrEqual(t, o.timeout, 201*time.Millisecond)
+	})
+
+	t.Run("route timeout", func(t *testing.T) {
+		err := client.Call(context.Background(), &SlowResponse{}, &SlowRequest{})
+		require.Error(t, err)
+		require.Contains(t, err.Error(), "504")
+		require.Contains(t, err.Error(), "handler did not finish in 50ms")
+	})
+
+	t.Run("route timeout is smaller than client's", func(t *testing.T) {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		t1 := time.Now()
+		err := client.Call(ctx, &SlowResponse{}, &SlowRequest{})
+		require.Contains(t, err.Error(), "504")
+		require.Less(t, time.Since(t1), 5*time.Second)
+	})
+
+	t.Run("handler ignores deadline", func(t *testing.T) {
+		// The handler succeeded, so the late response is sent.
+		r := httptest.NewRequest(http.MethodPost, "/wait", strings.NewReader(`{"ignore_ctx":true}`))
+		r.Header.Set(api2.TimeoutHeader, "50ms")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.LessOrEqual(t, (<-observed).timeout, 50*time.Millisecond)
+	})
+
+	t.Run("invalid header is ignored", func(t *testing.T) {
+		r := httptest.NewRequest(http.MethodPost, "/wait", strings.NewReader(`{"ignore_ctx":true}`))
+		r.Header.Set(api2.TimeoutHeader, "soon")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, r)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, observation{}, <-observed)
+	})
+}
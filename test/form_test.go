@@ -0,0 +1,132 @@
+package api2
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormRequests(t *testing.T) {
+	type SubscribeRequest struct {
+		List    string `url:"list"`
+		Source  string `query:"source"`
+		Email   string `form:"email" validate:"required"`
+		Name    string `form:"name"`
+		Weekly  bool   `form:"weekly"`
+		Retries int    `form:"retries"`
+	}
+	type SubscribeResponse struct {
+		Summary string `json:"summary"`
+	}
+
+	var got []SubscribeRequest
+	subscribeHandler := func(ctx context.Context, req *SubscribeRequest) (*SubscribeResponse, error) {
+		got = append(got, *req)
+		return &SubscribeResponse{Summary: req.List + ":" + req.Email}, nil
+	}
+
+	routes := []api2.Route{
+		{Method: http.MethodPost, Path: "/lists/:list/subscribe", Handler: subscribeHandler, Transport: &api2.JsonTransport{}},
+	}
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	want := SubscribeRequest{
+		List:    "news",
+		Source:  "web",
+		Email:   "a@example.com",
+		Name:    "Alice Smith",
+		Weekly:  true,
+		Retries: 3,
+	}
+
+	t.Run("client", func(t *testing.T) {
+		got = nil
+		client := api2.NewClient(routes, server.URL)
+		res := &SubscribeResponse{}
+		req := want
+		require.NoError(t, client.Call(context.Background(), res, &req))
+		require.Equal(t, "news:a@example.com", res.Summary)
+		require.Equal(t, []SubscribeRequest{want}, got)
+	})
+
+	t.Run("html form", func(t *testing.T) {
+		got = nil
+		res, err := http.PostForm(server.URL+"/lists/news/subscribe?source=web", url.Values{
+			"email":   {"a@example.com"},
+			"name":    {"Alice Smith"},
+			"weekly":  {"true"},
+			"retries": {"3"},
+			"unknown": {"x"},
+		})
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		var response SubscribeResponse
+		require.NoError(t, json.NewDecoder(res.Body).Decode(&response))
+		require.Equal(t, "news:a@example.com", response.Summary)
+		require.Equal(t, []SubscribeRequest{want}, got)
+	})
+
+	t.Run("multipart", func(t *testing.T) {
+		got = nil
+		var body bytes.Buffer
+		mw := multipart.NewWriter(&body)
+		require.NoError(t, mw.WriteField("email", "a@example.com"))
+		require.NoError(t, mw.WriteField("name", "Alice Smith"))
+		require.NoError(t, mw.WriteField("weekly", "true"))
+		require.NoError(t, mw.WriteField("retries", "3"))
+		require.NoError(t, mw.Close())
+		res, err := http.Post(server.URL+"/lists/news/subscribe?source=web", mw.FormDataContentType(), &body)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, []SubscribeRequest{want}, got)
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		got = nil
+		res, err := http.Post(server.URL+"/lists/news/subscribe", "application/json", strings.NewReader(`{"email":"a@example.com"}`))
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusUnsupportedMediaType, res.StatusCode)
+
+		res, err = http.PostForm(server.URL+"/lists/news/subscribe", url.Values{"retries": {"many"}})
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+
+		res, err = http.PostForm(server.URL+"/lists/news/subscribe", url.Values{"name": {"no email"}})
+		require.NoError(t, err)
+		res.Body.Close()
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		require.Empty(t, got)
+	})
+}
+
+func TestFormFieldsValidation(t *testing.T) {
+	type MixedRequest struct {
+		Email string `form:"email"`
+		Note  string `json:"note"`
+	}
+	type Response struct{}
+	handler := func(ctx context.Context, req *MixedRequest) (*Response, error) {
+		return &Response{}, nil
+	}
+	require.PanicsWithValue(t, "struct MixedRequest has both form ([Email]) and body ([Note]) fields", func() {
+		api2.BindRoutes(http.NewServeMux(), []api2.Route{
+			{Method: http.MethodPost, Path: "/mixed", Handler: handler},
+		})
+	})
+}
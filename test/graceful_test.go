@@ -0,0 +1,162 @@
+package api2
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGracefulServer(t *testing.T) {
+	type StreamRequest struct {
+	}
+	type StreamResponse struct {
+		Body io.ReadCloser `use_as_body:"true" is_stream:"true"`
+	}
+	type BlockRequest struct {
+	}
+	type BlockResponse struct {
+	}
+
+	started := make(chan struct{}, 1)
+	streamHandler := func(ctx context.Context, req *StreamRequest) (*StreamResponse, error) {
+		r, w := io.Pipe()
+		go func() {
+			defer w.Close()
+			started <- struct{}{}
+			// The response is sent when the server drains.
+			<-api2.Draining(ctx)
+			_, _ = w.Write([]byte("done"))
+		}()
+		return &StreamResponse{Body: r}, nil
+	}
+	blockErr := make(chan error, 1)
+	blockHandler := func(ctx context.Context, req *BlockRequest) (*BlockResponse, error) {
+		started <- struct{}{}
+		<-ctx.Done()
+		blockErr <- ctx.Err()
+		return nil, ctx.Err()
+	}
+
+	routes := []api2.Route{
+		{Method: http.MethodGet, Path: "/stream", Handler: streamHandler},
+		{Method: http.MethodGet, Path: "/block", Handler: blockHandler},
+	}
+
+	start := func(t *testing.T) (*api2.Server, *api2.Client, chan error) {
+		server := api2.NewServer(routes)
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		serveErr := make(chan error, 1)
+		go func() {
+			serveErr <- server.Serve(l)
+		}()
+		client := api2.NewClient(routes, "http://"+l.Addr().String())
+		return server, client, serveErr
+	}
+
+	t.Run("drain stream", func(t *testing.T) {
+		server, client, serveErr := start(t)
+
+		res := &StreamResponse{}
+		callErr := make(chan error, 1)
+		go func() {
+			callErr <- client.Call(context.Background(), res, &StreamRequest{})
+		}()
+		<-started
+		require.Equal(t, 1, server.ActiveRequests())
+
+		shutdownErr := make(chan error, 1)
+		go func() {
+			shutdownErr <- server.Shutdown(context.Background())
+		}()
+
+		require.NoError(t, <-callErr)
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.NoError(t, res.Body.Close())
+		require.Equal(t, "done", string(body))
+
+		require.NoError(t, <-shutdownErr)
+		require.Equal(t, http.ErrServerClosed, <-serveErr)
+		require.Equal(t, 0, server.ActiveRequests())
+
+		// New requests are rejected.
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/stream", nil))
+		require.Equal(t, http.StatusServiceUnavailable, w.Code)
+		require.Contains(t, w.Body.String(), "server is shutting down")
+	})
+
+	t.Run("force cancellation", func(t *testing.T) {
+		server, client, serveErr := start(t)
+
+		callErr := make(chan error, 1)
+		go func() {
+			callErr <- client.Call(context.Background(), &BlockResponse{}, &BlockRequest{})
+		}()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		t1 := time.Now()
+		require.Equal(t, context.DeadlineExceeded, server.Shutdown(ctx))
+		require.GreaterOrEqual(t, time.Since(t1), 100*time.Millisecond)
+
+		require.Equal(t, context.Canceled, <-blockErr)
+		require.Error(t, <-callErr)
+		require.Equal(t, http.ErrServerClosed, <-serveErr)
+		require.Equal(t, 0, server.ActiveRequests())
+	})
+
+	t.Run("handler ignoring ctx", func(t *testing.T) {
+		server := api2.NewServer(routes)
+		release := make(chan struct{})
+		defer close(release)
+		server.Mux().HandleFunc("/stuck", func(w http.ResponseWriter, r *http.Request) {
+			started <- struct{}{}
+			<-release
+		})
+		l, err := net.Listen("tcp", "127.0.0.1:0")
+		require.NoError(t, err)
+		go func() {
+			_ = server.Serve(l)
+		}()
+		go func() {
+			res, err := http.Get("http://" + l.Addr().String() + "/stuck")
+			if err == nil {
+				res.Body.Close()
+			}
+		}()
+		<-started
+
+		ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+		defer cancel()
+		t1 := time.Now()
+		require.Equal(t, context.DeadlineExceeded, server.Shutdown(ctx))
+		require.Less(t, time.Since(t1), 5*time.Second)
+	})
+
+	t.Run("mux", func(t *testing.T) {
+		server := api2.NewServer(routes)
+		server.Mux().HandleFunc("/healthz", func(w http.ResponseWriter, r *http.Request) {
+			_, _ = io.WriteString(w, "ok")
+		})
+
+		w := httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "ok", w.Body.String())
+
+		require.NoError(t, server.Shutdown(context.Background()))
+		w = httptest.NewRecorder()
+		server.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+		require.Equal(t, http.StatusServiceUnavailable, w.Code)
+	})
+}
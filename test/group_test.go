@@ -0,0 +1,121 @@
+package api2
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestGroup(t *testing.T) {
+	type InvoiceRequest struct {
+		Org string `url:"org"`
+		ID  string `url:"id"`
+	}
+	type InvoiceResponse struct {
+		Org   string `json:"org"`
+		ID    string `json:"id"`
+		Scope string `json:"scope"`
+	}
+	type PingRequest struct {
+	}
+	type PingResponse struct {
+		Scope string `json:"scope"`
+	}
+
+	scope := func(ctx context.Context) string {
+		route, _ := api2.RouteFromContext(ctx)
+		scope, _ := route.Meta["scope"].(string)
+		return scope
+	}
+	invoiceHandler := func(ctx context.Context, req *InvoiceRequest) (*InvoiceResponse, error) {
+		return &InvoiceResponse{Org: req.Org, ID: req.ID, Scope: scope(ctx)}, nil
+	}
+	pingHandler := func(ctx context.Context, req *PingRequest) (*PingResponse, error) {
+		return &PingResponse{Scope: scope(ctx)}, nil
+	}
+
+	var calls []string
+	interceptor := func(name string) api2.Interceptor {
+		return func(ctx context.Context, route *api2.Route, req interface{}, next api2.CallHandler) (interface{}, error) {
+			calls = append(calls, name)
+			return next(ctx, req)
+		}
+	}
+
+	billingRoutes := []api2.Route{
+		{
+			Method:       http.MethodGet,
+			Path:         "/invoices/:id",
+			Handler:      invoiceHandler,
+			Interceptors: []api2.Interceptor{interceptor("route")},
+		},
+	}
+	transport := &api2.JsonTransport{}
+	routes := api2.Group{
+		Prefix:       "/v1/",
+		Meta:         map[string]interface{}{"scope": "v1", "version": 1},
+		Interceptors: []api2.Interceptor{interceptor("v1")},
+	}.Routes(
+		api2.Group{
+			Prefix:       "/orgs/:org/billing",
+			Transport:    transport,
+			Meta:         map[string]interface{}{"scope": "billing"},
+			Interceptors: []api2.Interceptor{interceptor("billing")},
+		}.Routes(billingRoutes),
+		[]api2.Route{
+			{Method: http.MethodGet, Path: "/ping", Handler: pingHandler},
+		},
+	)
+
+	require.Len(t, routes, 2)
+	require.Equal(t, "/v1/orgs/:org/billing/invoices/:id", routes[0].Path)
+	require.Equal(t, transport, routes[0].Transport)
+	require.Equal(t, map[string]interface{}{"scope": "billing", "version": 1}, routes[0].Meta)
+	require.Len(t, routes[0].Interceptors, 3)
+	require.Equal(t, "/v1/ping", routes[1].Path)
+	require.Nil(t, routes[1].Transport)
+	require.Equal(t, map[string]interface{}{"scope": "v1", "version": 1}, routes[1].Meta)
+	// The original routes are not modified.
+	require.Equal(t, "/invoices/:id", billingRoutes[0].Path)
+	require.Nil(t, billingRoutes[0].Meta)
+	require.Len(t, billingRoutes[0].Interceptors, 1)
+
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes, api2.Interceptors(interceptor("server")))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL)
+	ctx := context.Background()
+
+	t.Run("nested", func(t *testing.T) {
+		calls = nil
+		res := &InvoiceResponse{}
+		require.NoError(t, client.Call(ctx, res, &InvoiceRequest{Org: "acme", ID: "42"}))
+		require.Equal(t, &InvoiceResponse{Org: "acme", ID: "42", Scope: "billing"}, res)
+		require.Equal(t, []string{"server", "v1", "billing", "route"}, calls)
+	})
+
+	t.Run("outer", func(t *testing.T) {
+		calls = nil
+		res := &PingResponse{}
+		require.NoError(t, client.Call(ctx, res, &PingRequest{}))
+		require.Equal(t, "v1", res.Scope)
+		require.Equal(t, []string{"server", "v1"}, calls)
+	})
+
+	t.Run("bad prefix", func(t *testing.T) {
+		require.PanicsWithValue(t, `prefix of group "v1" must start with '/'`, func() {
+			api2.Group{Prefix: "v1"}.Routes(billingRoutes)
+		})
+		require.PanicsWithValue(t, fmt.Sprintf("path %q in group %q must start with '/'", "ping", "/v1"), func() {
+			api2.Group{Prefix: "/v1"}.Routes([]api2.Route{
+				{Method: http.MethodGet, Path: "ping", Handler: pingHandler},
+			})
+		})
+	})
+}
@@ -0,0 +1,183 @@
+package api2
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestInterceptors(t *testing.T) {
+	type EchoRequest struct {
+		Foo int `json:"foo"`
+	}
+	type EchoResponse struct {
+		Foo int `json:"foo"`
+	}
+	type PrivateRequest struct {
+		ID string `url:"id"`
+	}
+	type PrivateResponse struct {
+	}
+
+	const publicKey = "public"
+
+	var handlerMeta map[string]interface{}
+	echoHandler := func(ctx context.Context, req *EchoRequest) (res *EchoResponse, err error) {
+		route, has := api2.RouteFromContext(ctx)
+		if !has {
+			return nil, fmt.Errorf("no route in context")
+		}
+		handlerMeta = route.Meta
+		return &EchoResponse{
+			Foo: req.Foo,
+		}, nil
+	}
+
+	privateHandler := func(ctx context.Context, req *PrivateRequest) (res *PrivateResponse, err error) {
+		return &PrivateResponse{}, nil
+	}
+
+	routes := []api2.Route{
+		{
+			Method:  http.MethodPost,
+			Path:    "/public",
+			Handler: echoHandler,
+			Meta: map[string]interface{}{
+				publicKey: true,
+			},
+		},
+		{
+			Method:  http.MethodPost,
+			Path:    "/private/:id",
+			Handler: privateHandler,
+		},
+	}
+
+	var calls []string
+	logger := func(ctx context.Context, route *api2.Route, req interface{}, next api2.CallHandler) (interface{}, error) {
+		calls = append(calls, "logger:"+route.Path)
+		return next(ctx, req)
+	}
+	auth := func(ctx context.Context, route *api2.Route, req interface{}, next api2.CallHandler) (interface{}, error) {
+		calls = append(calls, "auth:"+route.Path)
+		if public, _ := route.Meta[publicKey].(bool); !public {
+			return nil, fmt.Errorf("access denied")
+		}
+		return next(ctx, req)
+	}
+	doubler := func(ctx context.Context, route *api2.Route, req interface{}, next api2.CallHandler) (interface{}, error) {
+		if echoReq, ok := req.(*EchoRequest); ok {
+			echoReq.Foo *= 2
+		}
+		res, err := next(ctx, req)
+		if echoRes, ok := res.(*EchoResponse); ok && err == nil {
+			return &EchoResponse{Foo: echoRes.Foo + 1}, nil
+		}
+		return res, err
+	}
+
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes, api2.Interceptors(logger, auth), api2.Interceptors(doubler))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL)
+
+	ctx := context.Background()
+
+	t.Run("public", func(t *testing.T) {
+		calls = nil
+		res := &EchoResponse{}
+		err := client.Call(ctx, res, &EchoRequest{Foo: 10})
+		require.NoError(t, err)
+		require.Equal(t, 21, res.Foo)
+		require.Equal(t, []string{"logger:/public", "auth:/public"}, calls)
+		require.Equal(t, true, handlerMeta[publicKey])
+	})
+
+	t.Run("private", func(t *testing.T) {
+		calls = nil
+		res := &PrivateResponse{}
+		err := client.Call(ctx, res, &PrivateRequest{ID: "123"})
+		require.Error(t, err)
+		require.True(t, strings.Contains(err.Error(), "access denied"))
+		require.Equal(t, []string{"logger:/private/:id", "auth:/private/:id"}, calls)
+	})
+}
+
+func TestClientInterceptors(t *testing.T) {
+	type EchoRequest struct {
+		Foo    int    `json:"foo"`
+		Caller string `header:"X-Caller"`
+	}
+	type EchoResponse struct {
+		Foo    int    `json:"foo"`
+		Caller string `header:"X-Caller"`
+	}
+
+	echoHandler := func(ctx context.Context, req *EchoRequest) (res *EchoResponse, err error) {
+		if req.Foo < 0 {
+			return nil, fmt.Errorf("negative foo")
+		}
+		return &EchoResponse{
+			Foo:    req.Foo,
+			Caller: req.Caller,
+		}, nil
+	}
+
+	routes := []api2.Route{
+		{Method: http.MethodPost, Path: "/echo", Handler: echoHandler},
+	}
+
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	errTranslated := fmt.Errorf("translated error")
+
+	var calls []string
+	logger := func(ctx context.Context, route *api2.Route, response, request interface{}, next api2.ClientCall) error {
+		err := next(ctx, response, request)
+		calls = append(calls, fmt.Sprintf("%s %s %d %v", route.Method, route.Path, response.(*EchoResponse).Foo, err))
+		return err
+	}
+	headers := func(ctx context.Context, route *api2.Route, response, request interface{}, next api2.ClientCall) error {
+		ctx = api2.WithRequestHeader(ctx, "X-Caller", "interceptor")
+		return next(ctx, response, request)
+	}
+	translator := func(ctx context.Context, route *api2.Route, response, request interface{}, next api2.ClientCall) error {
+		if err := next(ctx, response, request); err != nil {
+			return fmt.Errorf("%w: %v", errTranslated, err)
+		}
+		return nil
+	}
+
+	client := api2.NewClient(routes, server.URL, api2.ClientInterceptors(logger, headers), api2.ClientInterceptors(translator))
+
+	ctx := context.Background()
+
+	t.Run("ok", func(t *testing.T) {
+		calls = nil
+		res := &EchoResponse{}
+		err := client.Call(ctx, res, &EchoRequest{Foo: 10})
+		require.NoError(t, err)
+		require.Equal(t, 10, res.Foo)
+		require.Equal(t, "interceptor", res.Caller)
+		require.Equal(t, []string{"POST /echo 10 <nil>"}, calls)
+	})
+
+	t.Run("error", func(t *testing.T) {
+		calls = nil
+		res := &EchoResponse{}
+		err := client.Call(ctx, res, &EchoRequest{Foo: -1})
+		require.ErrorIs(t, err, errTranslated)
+		require.True(t, strings.Contains(err.Error(), "negative foo"))
+		require.Len(t, calls, 1)
+	})
+}
@@ -0,0 +1,162 @@
+package api2
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+type logRecord struct {
+	level api2.LogLevel
+	msg   string
+	attrs map[string]interface{}
+}
+
+type recordingLogger struct {
+	mu      sync.Mutex
+	records []logRecord
+}
+
+func (l *recordingLogger) Log(ctx context.Context, level api2.LogLevel, msg string, keyvals ...interface{}) {
+	attrs := make(map[string]interface{})
+	for i := 0; i+1 < len(keyvals); i += 2 {
+		attrs[keyvals[i].(string)] = keyvals[i+1]
+	}
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.records = append(l.records, logRecord{level: level, msg: msg, attrs: attrs})
+}
+
+// wait waits until n records are logged and takes them. The server logs
+// the request after sending the response, so the client may return first.
+func (l *recordingLogger) wait(t *testing.T, n int) []logRecord {
+	require.Eventually(t, func() bool {
+		l.mu.Lock()
+		defer l.mu.Unlock()
+		return len(l.records) >= n
+	}, time.Second, time.Millisecond)
+	return l.take()
+}
+
+func (l *recordingLogger) take() []logRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	records := l.records
+	l.records = nil
+	return records
+}
+
+type UserNotFound struct {
+	ID string `json:"id"`
+}
+
+func (e UserNotFound) Error() string {
+	return "user not found: " + e.ID
+}
+
+func (e UserNotFound) HttpCode() int {
+	return http.StatusNotFound
+}
+
+type GetUserRequest struct {
+	ID string `url:"id"`
+}
+
+type GetUserResponse struct {
+	Name string `json:"name"`
+}
+
+type UserService struct{}
+
+func (s *UserService) GetUser(ctx context.Context, req *GetUserRequest) (*GetUserResponse, error) {
+	if req.ID != "alice" {
+		return nil, UserNotFound{ID: req.ID}
+	}
+	return &GetUserResponse{Name: "Alice"}, nil
+}
+
+func TestStructuredLogger(t *testing.T) {
+	s := &UserService{}
+	routes := []api2.Route{
+		{
+			Method:  http.MethodGet,
+			Path:    "/users/:id",
+			Handler: s.GetUser,
+			Transport: &api2.JsonTransport{
+				Errors: map[string]error{
+					"UserNotFound": UserNotFound{},
+				},
+			},
+		},
+	}
+
+	serverLogger := &recordingLogger{}
+	clientLogger := &recordingLogger{}
+
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes, api2.StructuredLogger(serverLogger))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL, api2.StructuredLogger(clientLogger))
+
+	ctx := context.Background()
+
+	t.Run("success", func(t *testing.T) {
+		err := client.Call(ctx, &GetUserResponse{}, &GetUserRequest{ID: "alice"})
+		require.NoError(t, err)
+
+		records := serverLogger.wait(t, 1)
+		require.Len(t, records, 1)
+		r := records[0]
+		require.Equal(t, api2.LevelInfo, r.level)
+		require.Equal(t, "GET", r.attrs["method"])
+		require.Equal(t, "/users/alice", r.attrs["path"])
+		require.Equal(t, "/users/:id", r.attrs["route"])
+		require.Equal(t, "UserService.GetUser", r.attrs["handler"])
+		require.Equal(t, http.StatusOK, r.attrs["status"])
+		require.IsType(t, time.Duration(0), r.attrs["latency"])
+		require.NotContains(t, r.attrs, "error")
+
+		records = clientLogger.take()
+		require.Len(t, records, 1)
+		require.Equal(t, api2.LevelInfo, records[0].level)
+		require.Equal(t, "/users/:id", records[0].attrs["route"])
+		require.Equal(t, http.StatusOK, records[0].attrs["status"])
+	})
+
+	t.Run("error", func(t *testing.T) {
+		err := client.Call(ctx, &GetUserResponse{}, &GetUserRequest{ID: "bob"})
+		require.Error(t, err)
+
+		records := serverLogger.wait(t, 1)
+		require.Len(t, records, 1)
+		r := records[0]
+		require.Equal(t, api2.LevelError, r.level)
+		require.Equal(t, "handler failed", r.msg)
+		require.Equal(t, http.StatusNotFound, r.attrs["status"])
+		require.Equal(t, "UserNotFound", r.attrs["error_code"])
+
+		records = clientLogger.take()
+		require.Len(t, records, 1)
+		require.Equal(t, api2.LevelWarn, records[0].level)
+		require.Equal(t, "UserNotFound", records[0].attrs["error_code"])
+		require.Equal(t, http.StatusNotFound, records[0].attrs["status"])
+	})
+
+	t.Run("printf adapter", func(t *testing.T) {
+		var lines []string
+		logger := api2.PrintfLogger(func(format string, args ...interface{}) {
+			lines = append(lines, fmt.Sprintf(format, args...))
+		})
+		logger.Log(ctx, api2.LevelInfo, "handler succeeded", "method", "GET", "path", "/users/alice")
+		logger.Log(ctx, api2.LevelError, "handler failed", "method", "GET", "path", "/users/bob", "route", "/users/:id", "error", UserNotFound{ID: "bob"})
+		require.Equal(t, []string{"GET /users/bob handler failed: user not found: bob"}, lines)
+	})
+}
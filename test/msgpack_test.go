@@ -0,0 +1,204 @@
+package api2
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/starius/api2"
+	"github.com/starius/api2/msgpack"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMessagePackTransport(t *testing.T) {
+	type Item struct {
+		Name    string    `json:"name"`
+		Tags    []string  `json:"tags,omitempty"`
+		Created time.Time `json:"created"`
+	}
+	type PutRequest struct {
+		ID      string `url:"id"`
+		Version int    `query:"version"`
+		Trace   string `header:"X-Trace"`
+		Session string `cookie:"session"`
+		Item    Item   `json:"item" validate:"required"`
+		Raw     []byte `json:"raw"`
+	}
+	type PutResponse struct {
+		Status  int         `use_as_status:"true"`
+		Trace   string      `header:"X-Trace"`
+		Cookie  http.Cookie `cookie:"session"`
+		Path    string      `json:"path"`
+		Item    *Item       `json:"item"`
+		RawSize int         `msgpack:"raw_size" json:"-"`
+	}
+	type GetRequest struct {
+		ID    string `url:"id"`
+		Limit int    `query:"limit" validate:"max=10"`
+	}
+	type GetResponse struct {
+		Item Item `use_as_body:"true"`
+	}
+
+	items := make(map[string]Item)
+	putHandler := func(ctx context.Context, req *PutRequest) (*PutResponse, error) {
+		_, existed := items[req.ID]
+		items[req.ID] = req.Item
+		status := http.StatusCreated
+		if existed {
+			status = http.StatusOK
+		}
+		return &PutResponse{
+			Status:  status,
+			Trace:   req.Trace,
+			Cookie:  http.Cookie{Name: "session", Value: req.Session + "-renewed"},
+			Path:    req.ID + "@" + string(rune('0'+req.Version)),
+			Item:    &req.Item,
+			RawSize: len(req.Raw),
+		}, nil
+	}
+	getHandler := func(ctx context.Context, req *GetRequest) (*GetResponse, error) {
+		item, has := items[req.ID]
+		if !has {
+			return nil, UserNotFound{ID: req.ID}
+		}
+		return &GetResponse{Item: item}, nil
+	}
+
+	transport := &api2.MessagePackTransport{
+		Errors: map[string]error{
+			"UserNotFound": UserNotFound{},
+		},
+	}
+	routes := []api2.Route{
+		{Method: http.MethodPut, Path: "/items/:id", Handler: putHandler, Transport: transport},
+		{Method: http.MethodGet, Path: "/items/:id", Handler: getHandler, Transport: transport},
+	}
+
+	var contentTypes []string
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		contentTypes = append(contentTypes, w.Header().Get("Content-Type"))
+	}))
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL)
+	ctx := context.Background()
+
+	item := Item{
+		Name:    "item",
+		Tags:    []string{"a", "b"},
+		Created: time.Date(2023, 5, 6, 7, 8, 9, 10, time.UTC),
+	}
+	putReq := &PutRequest{ID: "x1", Version: 2, Trace: "trace", Session: "s", Item: item, Raw: []byte{0, 1, 2}}
+
+	putRes := &PutResponse{}
+	require.NoError(t, client.Call(ctx, putRes, putReq))
+	require.Equal(t, http.StatusCreated, putRes.Status)
+	require.Equal(t, "trace", putRes.Trace)
+	require.Equal(t, "s-renewed", putRes.Cookie.Value)
+	require.Equal(t, "x1@2", putRes.Path)
+	require.Equal(t, &item, putRes.Item)
+	require.Equal(t, 3, putRes.RawSize)
+
+	putRes = &PutResponse{}
+	require.NoError(t, client.Call(ctx, putRes, putReq))
+	require.Equal(t, http.StatusOK, putRes.Status)
+
+	getRes := &GetResponse{}
+	require.NoError(t, client.Call(ctx, getRes, &GetRequest{ID: "x1"}))
+	require.Equal(t, item, getRes.Item)
+
+	// Registered errors keep their structure.
+	err := client.Call(ctx, getRes, &GetRequest{ID: "x2"})
+	require.Equal(t, UserNotFound{ID: "x2"}, err)
+
+	// Builtin errors are registered too.
+	err = client.Call(ctx, getRes, &GetRequest{ID: "x1", Limit: 11})
+	var validationErr *api2.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+	require.Equal(t, "limit", validationErr.Violations[0].Field)
+
+	// Response has status field, so the error is not decoded.
+	require.NoError(t, client.Call(ctx, putRes, &PutRequest{ID: "x3"}))
+	require.Equal(t, http.StatusBadRequest, putRes.Status)
+
+	require.Equal(t, []string{"application/msgpack", "application/msgpack", "application/msgpack", "application/msgpack", "application/msgpack", "application/msgpack"}, contentTypes)
+
+	t.Run("wire format", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/items/x1")
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		var got map[string]interface{}
+		require.NoError(t, msgpack.Unmarshal(body, &got))
+		require.Equal(t, map[string]interface{}{
+			"name":    "item",
+			"tags":    []interface{}{"a", "b"},
+			"created": item.Created,
+		}, got)
+	})
+
+	t.Run("malformed body", func(t *testing.T) {
+		res, err := http.Post(server.URL+"/items/x1", "application/msgpack", bytes.NewReader([]byte{0xc1}))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusMethodNotAllowed, res.StatusCode)
+
+		req, err := http.NewRequest(http.MethodPut, server.URL+"/items/x1", bytes.NewReader([]byte{0xc1}))
+		require.NoError(t, err)
+		res, err = http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
+
+func TestMessagePackNegotiation(t *testing.T) {
+	type EchoRequest struct {
+		Text string `json:"text"`
+	}
+	type EchoResponse struct {
+		Text string `json:"text"`
+	}
+	echoHandler := func(ctx context.Context, req *EchoRequest) (*EchoResponse, error) {
+		return &EchoResponse{Text: req.Text}, nil
+	}
+
+	routes := []api2.Route{
+		{Method: http.MethodPost, Path: "/echo", Handler: echoHandler, Transport: &api2.NegotiatingTransport{
+			Formats: []api2.Format{
+				{ContentType: "application/json", Transport: &api2.JsonTransport{}},
+				{ContentType: "application/msgpack", Transport: &api2.MessagePackTransport{
+					Compression: &api2.Compression{},
+				}},
+			},
+		}},
+	}
+
+	var responseTypes []string
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		responseTypes = append(responseTypes, w.Header().Get("Content-Type")+" "+w.Header().Get("Content-Encoding"))
+	}))
+	t.Cleanup(server.Close)
+	ctx := context.Background()
+
+	for _, client := range []*api2.Client{
+		api2.NewClient(routes, server.URL),
+		api2.NewClient(routes, server.URL, api2.PreferredContentType("application/msgpack")),
+	} {
+		res := &EchoResponse{}
+		require.NoError(t, client.Call(ctx, res, &EchoRequest{Text: "hello"}))
+		require.Equal(t, "hello", res.Text)
+	}
+	require.Equal(t, []string{"application/json; charset=UTF-8 ", "application/msgpack gzip"}, responseTypes)
+}
@@ -0,0 +1,189 @@
+package api2
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/starius/api2"
+	"github.com/starius/api2/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type Payment struct {
+	ID     int     `json:"id"`
+	Amount float64 `json:"amount"`
+}
+
+type ExportRequest struct {
+	Account string `query:"account"`
+	Limit   int    `query:"limit"`
+}
+
+type ExportResponse struct {
+	Total   int           `header:"X-Total"`
+	Records chan *Payment `use_as_body:"true"`
+}
+
+type ImportRequest struct {
+	Account string        `url:"account"`
+	Records chan *Payment `use_as_body:"true"`
+}
+
+type ImportResponse struct {
+	Count int     `json:"count"`
+	Sum   float64 `json:"sum"`
+}
+
+func TestNdjson(t *testing.T) {
+	exportHandler := func(ctx context.Context, req *ExportRequest) (*ExportResponse, error) {
+		if req.Account == "" {
+			return nil, errors.NotFound("unknown account")
+		}
+		records := make(chan *Payment)
+		go func() {
+			defer close(records)
+			for i := 1; req.Limit == 0 || i <= req.Limit; i++ {
+				select {
+				case records <- &Payment{ID: i, Amount: float64(i) * 1.5}:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return &ExportResponse{Total: req.Limit, Records: records}, nil
+	}
+
+	importHandler := func(ctx context.Context, req *ImportRequest) (*ImportResponse, error) {
+		res := &ImportResponse{}
+		for payment := range req.Records {
+			if payment.Amount < 0 {
+				return nil, errors.InvalidArgument("negative amount in payment %d", payment.ID)
+			}
+			res.Count++
+			res.Sum += payment.Amount
+		}
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		return res, nil
+	}
+
+	routes := []api2.Route{
+		{Method: http.MethodGet, Path: "/export", Handler: exportHandler, Transport: api2.NdjsonTransport},
+		{Method: http.MethodPost, Path: "/import/:account", Handler: importHandler, Transport: api2.NdjsonTransport},
+	}
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL)
+	ctx := context.Background()
+
+	collect := func(records chan *Payment) func() []*Payment {
+		var wg sync.WaitGroup
+		var payments []*Payment
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for payment := range records {
+				payments = append(payments, payment)
+			}
+		}()
+		return func() []*Payment {
+			wg.Wait()
+			return payments
+		}
+	}
+
+	t.Run("export", func(t *testing.T) {
+		res := &ExportResponse{Records: make(chan *Payment)}
+		wait := collect(res.Records)
+		require.NoError(t, client.Call(ctx, res, &ExportRequest{Account: "a", Limit: 3}))
+		require.Equal(t, []*Payment{
+			{ID: 1, Amount: 1.5},
+			{ID: 2, Amount: 3},
+			{ID: 3, Amount: 4.5},
+		}, wait())
+		require.Equal(t, 3, res.Total)
+	})
+
+	t.Run("export error", func(t *testing.T) {
+		res := &ExportResponse{Records: make(chan *Payment)}
+		err := client.Call(ctx, res, &ExportRequest{})
+		require.EqualError(t, err, "API returned error with HTTP status 404 Not Found: unknown account")
+	})
+
+	t.Run("export cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		res := &ExportResponse{Records: make(chan *Payment)}
+		result := make(chan error, 1)
+		go func() {
+			result <- client.Call(ctx, res, &ExportRequest{Account: "a"})
+		}()
+		// The stream is endless.
+		for i := 1; i <= 10; i++ {
+			require.Equal(t, i, (<-res.Records).ID)
+		}
+		cancel()
+		for range res.Records {
+		}
+		require.ErrorIs(t, <-result, context.Canceled)
+	})
+
+	t.Run("wire format", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/export?account=a&limit=2")
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, "application/x-ndjson", res.Header.Get("Content-Type"))
+		require.Equal(t, "2", res.Header.Get("X-Total"))
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Equal(t, "{\"id\":1,\"amount\":1.5}\n{\"id\":2,\"amount\":3}\n", string(body))
+	})
+
+	upload := func(payments ...*Payment) (*ImportResponse, error) {
+		records := make(chan *Payment)
+		go func() {
+			defer close(records)
+			for _, payment := range payments {
+				records <- payment
+			}
+		}()
+		res := &ImportResponse{}
+		err := client.Call(ctx, res, &ImportRequest{Account: "a", Records: records})
+		return res, err
+	}
+
+	t.Run("import", func(t *testing.T) {
+		res, err := upload(&Payment{ID: 1, Amount: 1}, &Payment{ID: 2, Amount: 2.5})
+		require.NoError(t, err)
+		require.Equal(t, &ImportResponse{Count: 2, Sum: 3.5}, res)
+
+		res, err = upload()
+		require.NoError(t, err)
+		require.Equal(t, &ImportResponse{}, res)
+	})
+
+	t.Run("import handler error", func(t *testing.T) {
+		// The handler stops reading after the second record.
+		_, err := upload(&Payment{ID: 1, Amount: 1}, &Payment{ID: 2, Amount: -1}, &Payment{ID: 3, Amount: 1})
+		require.EqualError(t, err, "API returned error with HTTP status 400 Bad Request: negative amount in payment 2")
+	})
+
+	t.Run("import malformed", func(t *testing.T) {
+		body := "{\"id\":1,\"amount\":1}\n{\"id\":2,\n"
+		res, err := http.Post(server.URL+"/import/a", "application/x-ndjson", strings.NewReader(body))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		message, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Contains(t, string(message), "failed to parse NDJSON record")
+	})
+}
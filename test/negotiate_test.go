@@ -0,0 +1,146 @@
+package api2
+
+import (
+	"bytes"
+	"context"
+	"encoding/gob"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+// newGobTransport returns transport encoding bodies with encoding/gob.
+// Errors are sent in JSON.
+func newGobTransport(errors map[string]error) *api2.JsonTransport {
+	return &api2.JsonTransport{
+		RequestDecoder: func(ctx context.Context, r *http.Request, req interface{}) (context.Context, error) {
+			return ctx, gob.NewDecoder(r.Body).Decode(req)
+		},
+		ResponseEncoder: func(ctx context.Context, w http.ResponseWriter, res interface{}) error {
+			w.Header().Set("Content-Type", "application/x-gob")
+			return gob.NewEncoder(w).Encode(res)
+		},
+		RequestEncoder: func(ctx context.Context, method, url string, req interface{}) (*http.Request, error) {
+			var buf bytes.Buffer
+			if err := gob.NewEncoder(&buf).Encode(req); err != nil {
+				return nil, err
+			}
+			request, err := http.NewRequestWithContext(ctx, method, url, &buf)
+			if err != nil {
+				return nil, err
+			}
+			request.Header.Set("Content-Type", "application/x-gob")
+			return request, nil
+		},
+		ResponseDecoder: func(ctx context.Context, res *http.Response, response interface{}) error {
+			return gob.NewDecoder(res.Body).Decode(response)
+		},
+		Errors: errors,
+	}
+}
+
+func TestNegotiatingTransport(t *testing.T) {
+	type GreetRequest struct {
+		Name string `json:"name"`
+	}
+	type GreetResponse struct {
+		Greeting string `json:"greeting"`
+	}
+
+	greetHandler := func(ctx context.Context, req *GreetRequest) (*GreetResponse, error) {
+		if req.Name == "" {
+			return nil, UserNotFound{ID: req.Name}
+		}
+		return &GreetResponse{Greeting: "Hello, " + req.Name}, nil
+	}
+
+	errors := map[string]error{
+		"UserNotFound": UserNotFound{},
+	}
+	jsonTransport := &api2.JsonTransport{Errors: errors}
+	transport := &api2.NegotiatingTransport{
+		Formats: []api2.Format{
+			{ContentType: "application/json", Transport: jsonTransport},
+			{ContentType: "application/x-gob", Transport: newGobTransport(errors)},
+		},
+	}
+	routes := []api2.Route{
+		{Method: http.MethodPost, Path: "/greet", Handler: greetHandler, Transport: transport},
+	}
+
+	type contentTypes struct {
+		request, response string
+	}
+	var mu sync.Mutex
+	var seen []contentTypes
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mux.ServeHTTP(w, r)
+		mu.Lock()
+		defer mu.Unlock()
+		seen = append(seen, contentTypes{
+			request:  r.Header.Get("Content-Type"),
+			response: w.Header().Get("Content-Type"),
+		})
+	}))
+	t.Cleanup(server.Close)
+	ctx := context.Background()
+
+	takeSeen := func() []contentTypes {
+		mu.Lock()
+		defer mu.Unlock()
+		s := seen
+		seen = nil
+		return s
+	}
+
+	t.Run("default format", func(t *testing.T) {
+		client := api2.NewClient(routes, server.URL)
+		res := &GreetResponse{}
+		require.NoError(t, client.Call(ctx, res, &GreetRequest{Name: "Alice"}))
+		require.Equal(t, "Hello, Alice", res.Greeting)
+		require.Equal(t, []contentTypes{{"application/json; charset=UTF-8", "application/json; charset=UTF-8"}}, takeSeen())
+	})
+
+	t.Run("preferred format", func(t *testing.T) {
+		client := api2.NewClient(routes, server.URL, api2.PreferredContentType("application/x-gob"))
+		res := &GreetResponse{}
+		require.NoError(t, client.Call(ctx, res, &GreetRequest{Name: "Bob"}))
+		require.Equal(t, "Hello, Bob", res.Greeting)
+		require.Equal(t, []contentTypes{{"application/x-gob", "application/x-gob"}}, takeSeen())
+
+		// Errors are decoded by the transport of their Content-Type.
+		err := client.Call(ctx, res, &GreetRequest{})
+		require.Equal(t, UserNotFound{ID: ""}, err)
+		takeSeen()
+	})
+
+	t.Run("accept", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/greet", strings.NewReader(`{"name":"Carol"}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Accept", "application/json;q=0.5, application/*")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		require.Equal(t, http.StatusOK, w.Code)
+		require.Equal(t, "application/x-gob", w.Header().Get("Content-Type"))
+		require.Equal(t, "Accept", w.Header().Get("Vary"))
+		res := &GreetResponse{}
+		require.NoError(t, gob.NewDecoder(w.Body).Decode(res))
+		require.Equal(t, "Hello, Carol", res.Greeting)
+	})
+
+	t.Run("unsupported content type", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPost, "/greet", strings.NewReader(`<name>Dave</name>`))
+		req.Header.Set("Content-Type", "application/xml")
+		w := httptest.NewRecorder()
+		mux.ServeHTTP(w, req)
+		require.Equal(t, http.StatusUnsupportedMediaType, w.Code)
+		require.Contains(t, w.Body.String(), "supported: application/json, application/x-gob")
+	})
+}
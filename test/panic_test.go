@@ -0,0 +1,131 @@
+package api2
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestPanic(t *testing.T) {
+	type Request struct {
+		Foo int `json:"foo"`
+	}
+	type Response struct {
+		Bar int `json:"bar"`
+	}
+
+	handler := func(ctx context.Context, req *Request) (res *Response, err error) {
+		var m map[string]int
+		m["foo"] = req.Foo // Panics: assignment to entry in nil map.
+		return &Response{}, nil
+	}
+
+	decoderPanics := &api2.JsonTransport{
+		RequestDecoder: func(ctx context.Context, r *http.Request, req interface{}) (context.Context, error) {
+			panic("decoder panicked")
+		},
+	}
+	encoderPanics := &api2.JsonTransport{
+		ResponseEncoder: func(ctx context.Context, w http.ResponseWriter, res interface{}) error {
+			panic("encoder panicked")
+		},
+	}
+	okHandler := func(ctx context.Context, req *Request) (res *Response, err error) {
+		return &Response{Bar: req.Foo}, nil
+	}
+
+	type Request2 struct {
+		Foo int `json:"foo"`
+	}
+	type Request3 struct {
+		Foo int `json:"foo"`
+	}
+	okHandler2 := func(ctx context.Context, req *Request2) (res *Response, err error) {
+		return okHandler(ctx, (*Request)(req))
+	}
+	okHandler3 := func(ctx context.Context, req *Request3) (res *Response, err error) {
+		return okHandler(ctx, (*Request)(req))
+	}
+
+	routes := []api2.Route{
+		{Method: http.MethodPost, Path: "/handler", Handler: handler},
+		{Method: http.MethodPost, Path: "/decoder", Handler: okHandler2, Transport: decoderPanics},
+		{Method: http.MethodPost, Path: "/encoder", Handler: okHandler3, Transport: encoderPanics},
+	}
+
+	var mu sync.Mutex
+	var logs []string
+	var hookCalls []string
+	logger := func(format string, args ...interface{}) {
+		mu.Lock()
+		defer mu.Unlock()
+		logs = append(logs, fmt.Sprintf(format, args...))
+	}
+	hook := func(ctx context.Context, route *api2.Route, recovered interface{}, stack []byte) {
+		mu.Lock()
+		defer mu.Unlock()
+		hookCalls = append(hookCalls, fmt.Sprintf("%s %v", route.Path, recovered))
+	}
+
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes, api2.ErrorLogger(logger), api2.OnPanic(hook))
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL)
+
+	ctx := context.Background()
+
+	cases := []struct {
+		name     string
+		request  interface{}
+		wantHook string
+	}{
+		{"handler", &Request{Foo: 1}, "/handler assignment to entry in nil map"},
+		{"decoder", &Request2{Foo: 1}, "/decoder decoder panicked"},
+		{"encoder", &Request3{Foo: 1}, "/encoder encoder panicked"},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			mu.Lock()
+			logs, hookCalls = nil, nil
+			mu.Unlock()
+
+			err := client.Call(ctx, &Response{}, tc.request)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), "500")
+
+			// The server logs the request after sending the response.
+			require.Eventually(t, func() bool {
+				mu.Lock()
+				defer mu.Unlock()
+				return len(logs) != 0
+			}, time.Second, time.Millisecond)
+
+			mu.Lock()
+			defer mu.Unlock()
+			require.Equal(t, []string{tc.wantHook}, hookCalls)
+			require.True(t, strings.Contains(logs[0], "panicked"), logs[0])
+			require.True(t, strings.Contains(logs[0], "goroutine"), "no stack trace in %q", logs[0])
+		})
+	}
+
+	t.Run("rethrow", func(t *testing.T) {
+		mux := http.NewServeMux()
+		api2.BindRoutes(mux, routes, api2.ErrorLogger(logger), api2.RethrowPanics(true))
+		r := httptest.NewRequest(http.MethodPost, "/handler", strings.NewReader(`{"foo":1}`))
+		w := httptest.NewRecorder()
+		require.Panics(t, func() {
+			mux.ServeHTTP(w, r)
+		})
+		require.Equal(t, http.StatusInternalServerError, w.Code)
+	})
+}
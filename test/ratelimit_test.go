@@ -0,0 +1,68 @@
+package api2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRateLimit(t *testing.T) {
+	type PingRequest struct {
+	}
+	type PingResponse struct {
+	}
+
+	pingHandler := func(ctx context.Context, req *PingRequest) (*PingResponse, error) {
+		return &PingResponse{}, nil
+	}
+
+	routes := []api2.Route{
+		{
+			Method:  http.MethodGet,
+			Path:    "/ping",
+			Handler: pingHandler,
+			RateLimit: &api2.RateLimit{
+				Rate:  0.5,
+				Burst: 2,
+				Key:   api2.CallerKeyHeader("X-Api-Key"),
+			},
+		},
+	}
+
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL)
+
+	alice := api2.WithRequestHeader(context.Background(), "X-Api-Key", "alice")
+	bob := api2.WithRequestHeader(context.Background(), "X-Api-Key", "bob")
+
+	require.NoError(t, client.Call(alice, &PingResponse{}, &PingRequest{}))
+	require.NoError(t, client.Call(alice, &PingResponse{}, &PingRequest{}))
+
+	err := client.Call(alice, &PingResponse{}, &PingRequest{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "429")
+	require.Contains(t, err.Error(), "rate limit exceeded")
+	delay, has := api2.RetryAfter(err)
+	require.True(t, has)
+	require.Equal(t, 2*time.Second, delay)
+
+	require.NoError(t, client.Call(bob, &PingResponse{}, &PingRequest{}))
+
+	r := httptest.NewRequest(http.MethodGet, "/ping", nil)
+	r.Header.Set("X-Api-Key", "alice")
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, r)
+	require.Equal(t, http.StatusTooManyRequests, w.Code)
+	require.Equal(t, "2", w.Header().Get("Retry-After"))
+
+	_, has = api2.RetryAfter(client.Call(bob, &PingResponse{}, &PingRequest{}))
+	require.False(t, has)
+}
@@ -0,0 +1,205 @@
+package api2
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+type ConflictRequest struct {
+	ID string `url:"id"`
+}
+
+type MeRequest struct{}
+
+type ConflictResponse struct {
+	Handler string `json:"handler"`
+}
+
+type ConflictService struct{}
+
+func (s *ConflictService) GetUser(ctx context.Context, req *ConflictRequest) (*ConflictResponse, error) {
+	return &ConflictResponse{Handler: "GetUser"}, nil
+}
+
+func (s *ConflictService) GetUserByName(ctx context.Context, req *ConflictRequest) (*ConflictResponse, error) {
+	return &ConflictResponse{Handler: "GetUserByName"}, nil
+}
+
+func (s *ConflictService) GetMe(ctx context.Context, req *MeRequest) (*ConflictResponse, error) {
+	return &ConflictResponse{Handler: "GetMe"}, nil
+}
+
+func (s *ConflictService) UpdateMe(ctx context.Context, req *MeRequest) (*ConflictResponse, error) {
+	return &ConflictResponse{Handler: "UpdateMe"}, nil
+}
+
+func TestCheckRoutes(t *testing.T) {
+	s := &ConflictService{}
+
+	t.Run("no conflicts", func(t *testing.T) {
+		routes := []api2.Route{
+			{Method: http.MethodGet, Path: "/users/:id", Handler: s.GetUser},
+			{Method: http.MethodGet, Path: "/users/:id/name", Handler: s.GetUserByName},
+			{Method: http.MethodGet, Path: "/me", Handler: s.GetMe},
+			{Method: http.MethodPost, Path: "/users/:id", Handler: s.GetUser},
+			{Method: http.MethodGet, Path: "/ids/:id{int}", Handler: s.GetUser},
+			{Method: http.MethodGet, Path: "/ids/me", Handler: s.GetMe},
+			{Method: http.MethodGet, Path: "/files/:id{int}/*rest", Handler: s.GetUser},
+			{Method: http.MethodGet, Path: "/files/me", Handler: s.GetMe},
+			// Constraints which can't match the same segment.
+			{Method: http.MethodGet, Path: "/items/:id{uint}", Handler: s.GetUser},
+			{Method: http.MethodGet, Path: "/items/:id{[a-z]+}", Handler: s.GetUserByName},
+			{Method: http.MethodGet, Path: "/things/:id{uuid}", Handler: s.GetUser},
+			{Method: http.MethodGet, Path: "/things/:id{[a-z]+}", Handler: s.GetUserByName},
+		}
+		require.NoError(t, api2.CheckRoutes(routes))
+		require.NotPanics(t, func() {
+			api2.BindRoutes(http.NewServeMux(), routes[len(routes)-4:])
+		})
+	})
+
+	t.Run("ambiguous", func(t *testing.T) {
+		routes := []api2.Route{
+			{Method: http.MethodGet, Path: "/users/:id", Handler: s.GetUser},
+			{Method: http.MethodGet, Path: "/users/:id{int}", Handler: s.GetUserByName},
+			{Method: http.MethodGet, Path: "/users/me", Handler: s.GetMe},
+			{Method: http.MethodPost, Path: "/users/:id", Handler: s.GetUser},
+			{Method: http.MethodGet, Path: "/users/:id/*rest", Handler: s.GetUserByName},
+		}
+		err := api2.CheckRoutes(routes)
+		var conflictErr *api2.RouteConflictError
+		require.ErrorAs(t, err, &conflictErr)
+		ambiguous := func(path, handler, otherPath, otherHandler string) api2.RouteConflict {
+			return api2.RouteConflict{
+				Kind:         api2.AmbiguousRoute,
+				Method:       http.MethodGet,
+				Path:         path,
+				Handler:      "ConflictService." + handler,
+				OtherPath:    otherPath,
+				OtherHandler: "ConflictService." + otherHandler,
+			}
+		}
+		require.Equal(t, []api2.RouteConflict{
+			ambiguous("/users/:id{int}", "GetUserByName", "/users/:id", "GetUser"),
+			ambiguous("/users/me", "GetMe", "/users/:id", "GetUser"),
+			ambiguous("/users/:id/*rest", "GetUserByName", "/users/:id", "GetUser"),
+			ambiguous("/users/:id/*rest", "GetUserByName", "/users/:id{int}", "GetUserByName"),
+			ambiguous("/users/:id/*rest", "GetUserByName", "/users/me", "GetMe"),
+		}, conflictErr.Conflicts)
+		require.Contains(t, err.Error(), "GET /users/me (ConflictService.GetMe) is ambiguous with GET /users/:id (ConflictService.GetUser)")
+
+		require.PanicsWithValue(t, err.Error(), func() {
+			api2.BindRoutes(http.NewServeMux(), routes)
+		})
+		require.NotPanics(t, func() {
+			// The handlers don't have field of the catch-all parameter.
+			api2.BindRoutes(http.NewServeMux(), routes[:4], api2.AllowAmbiguousRoutes(true))
+		})
+
+		// Only the runes of constraints are compared, not lengths.
+		require.Error(t, api2.CheckRoutes([]api2.Route{
+			{Method: http.MethodGet, Path: "/codes/:id{[a-z]{2}}", Handler: s.GetUser},
+			{Method: http.MethodGet, Path: "/codes/:id{[a-z]{3}}", Handler: s.GetUserByName},
+		}))
+	})
+
+	t.Run("conflicts", func(t *testing.T) {
+		routes := []api2.Route{
+			{Method: http.MethodGet, Path: "/users/:id", Handler: s.GetUser},
+			{Method: http.MethodGet, Path: "/users/:name/", Handler: s.GetUserByName},
+			{Method: http.MethodPost, Path: "/me", Handler: s.GetMe},
+			{Method: http.MethodPost, Path: "/me", Handler: s.UpdateMe},
+		}
+		err := api2.CheckRoutes(routes)
+		var conflictErr *api2.RouteConflictError
+		require.ErrorAs(t, err, &conflictErr)
+		require.Equal(t, []api2.RouteConflict{
+			{
+				Kind:         api2.DuplicateRoute,
+				Method:       http.MethodGet,
+				Path:         "/users/:name/",
+				Handler:      "ConflictService.GetUserByName",
+				OtherPath:    "/users/:id",
+				OtherHandler: "ConflictService.GetUser",
+			},
+			{
+				Kind:         api2.DuplicateRoute,
+				Method:       http.MethodPost,
+				Path:         "/me",
+				Handler:      "ConflictService.UpdateMe",
+				OtherPath:    "/me",
+				OtherHandler: "ConflictService.GetMe",
+			},
+		}, conflictErr.Conflicts)
+
+		// Duplicates are rejected even if ambiguous routes are allowed.
+		require.PanicsWithValue(t, err.Error(), func() {
+			api2.BindRoutes(http.NewServeMux(), routes, api2.AllowAmbiguousRoutes(true))
+		})
+	})
+
+	t.Run("mux conflict", func(t *testing.T) {
+		mux := http.NewServeMux()
+		api2.BindRoutes(mux, []api2.Route{
+			{Method: http.MethodGet, Path: "/users/:id", Handler: s.GetUser},
+		})
+		// The message of http.ServeMux depends on the version of Go.
+		var recovered interface{}
+		func() {
+			defer func() {
+				recovered = recover()
+			}()
+			api2.BindRoutes(mux, []api2.Route{
+				{Method: http.MethodPost, Path: "/users/:id", Handler: s.GetUserByName},
+			})
+		}()
+		require.IsType(t, "", recovered)
+		require.Contains(t, recovered, `failed to register pattern "/users/" of routes POST /users/:id (ConflictService.GetUserByName): `)
+	})
+}
+
+func TestRoutesAcrossMethods(t *testing.T) {
+	s := &ConflictService{}
+	routes := []api2.Route{
+		{Method: http.MethodGet, Path: "/users/:id", Handler: s.GetUser},
+		{Method: http.MethodPost, Path: "/users/me", Handler: s.UpdateMe},
+	}
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL)
+
+	ctx := context.Background()
+	res := &ConflictResponse{}
+	require.NoError(t, client.Call(ctx, res, &ConflictRequest{ID: "me"}))
+	require.Equal(t, "GetUser", res.Handler)
+
+	httpRes, err := http.Post(server.URL+"/users/me", "application/json", nil)
+	require.NoError(t, err)
+	defer httpRes.Body.Close()
+	body, err := io.ReadAll(httpRes.Body)
+	require.NoError(t, err)
+	require.Equal(t, http.StatusOK, httpRes.StatusCode)
+	require.JSONEq(t, `{"handler":"UpdateMe"}`, string(body))
+
+	req, err := http.NewRequest(http.MethodDelete, server.URL+"/users/me", nil)
+	require.NoError(t, err)
+	httpRes2, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	defer httpRes2.Body.Close()
+	require.Equal(t, http.StatusMethodNotAllowed, httpRes2.StatusCode)
+
+	matcher := api2.GetMatcher(routes)
+	route, has := matcher(httptest.NewRequest(http.MethodGet, "/users/42", nil))
+	require.True(t, has)
+	require.Equal(t, "/users/:id", route.Path)
+	_, has = matcher(httptest.NewRequest(http.MethodDelete, "/users/42", nil))
+	require.False(t, has)
+}
@@ -0,0 +1,188 @@
+package api2
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/starius/api2"
+	"github.com/starius/api2/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type PriceEvent struct {
+	ID    string        `sse:"id"`
+	Name  string        `sse:"event"`
+	Retry time.Duration `sse:"retry"`
+	Price float64       `json:"price"`
+	Note  string        `json:"note,omitempty"`
+}
+
+type WatchRequest struct {
+	Symbol      string `query:"symbol"`
+	LastEventID string `header:"Last-Event-ID"`
+}
+
+type WatchResponse struct {
+	Session string           `header:"X-Session"`
+	Events  chan *PriceEvent `use_as_body:"true"`
+}
+
+func TestSSE(t *testing.T) {
+	const total = 4
+
+	watchHandler := func(ctx context.Context, req *WatchRequest) (*WatchResponse, error) {
+		if req.Symbol == "" {
+			return nil, errors.NotFound("unknown symbol")
+		}
+		start := 0
+		if req.LastEventID != "" {
+			var err error
+			start, err = strconv.Atoi(req.LastEventID)
+			if err != nil {
+				return nil, errors.InvalidArgument("bad Last-Event-ID")
+			}
+		}
+		events := make(chan *PriceEvent)
+		go func() {
+			defer close(events)
+			for i := start + 1; i <= total; i++ {
+				event := &PriceEvent{
+					ID:    strconv.Itoa(i),
+					Price: float64(i) / 2,
+				}
+				if i == 1 {
+					event.Retry = 10 * time.Millisecond
+					event.Name = "open"
+					event.Note = "line1\nline2"
+				}
+				select {
+				case events <- event:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+		return &WatchResponse{Session: "s-" + req.Symbol, Events: events}, nil
+	}
+
+	routes := []api2.Route{
+		{Method: http.MethodGet, Path: "/watch", Handler: watchHandler, Transport: api2.SseTransport},
+	}
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+
+	var mu sync.Mutex
+	var lastEventIDs []string
+	breakAfter := 0
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		lastEventIDs = append(lastEventIDs, r.Header.Get("Last-Event-ID"))
+		limit := breakAfter
+		breakAfter = 0
+		mu.Unlock()
+		if limit != 0 {
+			w = &breakingWriter{ResponseWriter: w, limit: limit}
+		}
+		mux.ServeHTTP(w, r)
+	}))
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL)
+	ctx := context.Background()
+
+	collect := func(res *WatchResponse) func() []*PriceEvent {
+		var wg sync.WaitGroup
+		var events []*PriceEvent
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for event := range res.Events {
+				events = append(events, event)
+			}
+		}()
+		return func() []*PriceEvent {
+			wg.Wait()
+			return events
+		}
+	}
+
+	wantEvents := []*PriceEvent{
+		{ID: "1", Name: "open", Retry: 10 * time.Millisecond, Price: 0.5, Note: "line1\nline2"},
+		{ID: "2", Price: 1},
+		{ID: "3", Price: 1.5},
+		{ID: "4", Price: 2},
+	}
+
+	t.Run("events", func(t *testing.T) {
+		mu.Lock()
+		lastEventIDs = nil
+		mu.Unlock()
+		res := &WatchResponse{Events: make(chan *PriceEvent)}
+		wait := collect(res)
+		require.NoError(t, client.Call(ctx, res, &WatchRequest{Symbol: "BTC"}))
+		require.Equal(t, wantEvents, wait())
+		require.Equal(t, "s-BTC", res.Session)
+		mu.Lock()
+		require.Equal(t, []string{""}, lastEventIDs)
+		mu.Unlock()
+	})
+
+	t.Run("reconnect", func(t *testing.T) {
+		mu.Lock()
+		lastEventIDs = nil
+		breakAfter = 2
+		mu.Unlock()
+		res := &WatchResponse{Events: make(chan *PriceEvent)}
+		wait := collect(res)
+		require.NoError(t, client.Call(ctx, res, &WatchRequest{Symbol: "BTC"}))
+		require.Equal(t, wantEvents, wait())
+		mu.Lock()
+		require.Equal(t, []string{"", "2"}, lastEventIDs)
+		mu.Unlock()
+	})
+
+	t.Run("error", func(t *testing.T) {
+		res := &WatchResponse{Events: make(chan *PriceEvent)}
+		err := client.Call(ctx, res, &WatchRequest{})
+		require.EqualError(t, err, "API returned error with HTTP status 404 Not Found: unknown symbol")
+	})
+
+	t.Run("wire format", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/watch?symbol=ETH")
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, "text/event-stream", res.Header.Get("Content-Type"))
+		require.Equal(t, "no-cache", res.Header.Get("Cache-Control"))
+		require.Equal(t, "s-ETH", res.Header.Get("X-Session"))
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Equal(t, "id: 1\nevent: open\nretry: 10\ndata: {\"price\":0.5,\"note\":\"line1\\nline2\"}\n\n"+
+			"id: 2\ndata: {\"price\":1}\n\n"+
+			"id: 3\ndata: {\"price\":1.5}\n\n"+
+			"id: 4\ndata: {\"price\":2}\n\n", string(body))
+	})
+}
+
+// breakingWriter aborts the connection when trying to write more than
+// limit events.
+type breakingWriter struct {
+	http.ResponseWriter
+	limit int
+}
+
+func (w *breakingWriter) Write(data []byte) (int, error) {
+	if w.limit == 0 {
+		panic(http.ErrAbortHandler)
+	}
+	w.limit--
+	return w.ResponseWriter.Write(data)
+}
+
+func (w *breakingWriter) Flush() {
+	w.ResponseWriter.(http.Flusher).Flush()
+}
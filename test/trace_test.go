@@ -0,0 +1,166 @@
+package api2
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+type recordedSpan struct {
+	name   string
+	kind   api2.SpanKind
+	parent api2.SpanContext
+	sc     api2.SpanContext
+	status int
+	err    error
+}
+
+type recordingTracer struct {
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+func (t *recordingTracer) StartSpan(ctx context.Context, name string, kind api2.SpanKind, route *api2.Route) (context.Context, api2.Span) {
+	parent, _ := api2.SpanContextFromContext(ctx)
+	s := &recordedSpan{
+		name:   name,
+		kind:   kind,
+		parent: parent,
+		sc:     api2.NewSpanContext(parent),
+	}
+	return api2.ContextWithSpanContext(ctx, s.sc), &recordingSpan{tracer: t, span: s}
+}
+
+func (t *recordingTracer) ended() []*recordedSpan {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	return append([]*recordedSpan(nil), t.spans...)
+}
+
+type recordingSpan struct {
+	tracer *recordingTracer
+	span   *recordedSpan
+}
+
+func (s *recordingSpan) End(status int, err error) {
+	s.span.status, s.span.err = status, err
+	s.tracer.mu.Lock()
+	defer s.tracer.mu.Unlock()
+	s.tracer.spans = append(s.tracer.spans, s.span)
+}
+
+type EchoTraceRequest struct {
+	Text string `json:"text"`
+}
+
+type EchoTraceResponse struct {
+	Text    string `json:"text"`
+	TraceID string `json:"trace_id"`
+}
+
+type BackendService struct{}
+
+func (s *BackendService) Echo(ctx context.Context, req *EchoTraceRequest) (*EchoTraceResponse, error) {
+	sc, has := api2.SpanContextFromContext(ctx)
+	if !has {
+		return nil, fmt.Errorf("no span context")
+	}
+	return &EchoTraceResponse{Text: req.Text, TraceID: fmt.Sprintf("%x", sc.TraceID)}, nil
+}
+
+type FrontendService struct {
+	backend *api2.Client
+}
+
+func (s *FrontendService) Echo(ctx context.Context, req *EchoTraceRequest) (*EchoTraceResponse, error) {
+	res := &EchoTraceResponse{}
+	if err := s.backend.Call(ctx, res, req); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func TestTracePropagation(t *testing.T) {
+	backend := &BackendService{}
+	backendRoutes := []api2.Route{
+		{Method: http.MethodPost, Path: "/backend/echo", Handler: backend.Echo},
+	}
+	backendTracer := &recordingTracer{}
+	backendMux := http.NewServeMux()
+	api2.BindRoutes(backendMux, backendRoutes, api2.Tracing(backendTracer))
+	backendServer := httptest.NewServer(backendMux)
+	t.Cleanup(backendServer.Close)
+
+	frontendTracer := &recordingTracer{}
+	frontend := &FrontendService{
+		backend: api2.NewClient(backendRoutes, backendServer.URL, api2.Tracing(frontendTracer)),
+	}
+	frontendRoutes := []api2.Route{
+		{Method: http.MethodPost, Path: "/echo", Handler: frontend.Echo},
+	}
+	frontendMux := http.NewServeMux()
+	api2.BindRoutes(frontendMux, frontendRoutes, api2.Tracing(frontendTracer))
+	frontendServer := httptest.NewServer(frontendMux)
+	t.Cleanup(frontendServer.Close)
+
+	// The client has no tracer: it propagates the span from ctx as is.
+	client := api2.NewClient(frontendRoutes, frontendServer.URL)
+	root := api2.NewSpanContext(api2.SpanContext{})
+	root.TraceState = "vendor=value"
+	ctx := api2.ContextWithSpanContext(context.Background(), root)
+
+	res := &EchoTraceResponse{}
+	require.NoError(t, client.Call(ctx, res, &EchoTraceRequest{Text: "hello"}))
+	require.Equal(t, "hello", res.Text)
+	require.Equal(t, fmt.Sprintf("%x", root.TraceID), res.TraceID)
+
+	// Servers end spans after sending responses.
+	require.Eventually(t, func() bool {
+		return len(frontendTracer.ended()) == 2 && len(backendTracer.ended()) == 1
+	}, time.Second, time.Millisecond)
+
+	spans := frontendTracer.ended()
+	// The client span ends before the server span.
+	clientSpan, serverSpan := spans[0], spans[1]
+	require.Equal(t, "FrontendService.Echo", serverSpan.name)
+	require.Equal(t, api2.SpanKindServer, serverSpan.kind)
+	require.Equal(t, root, serverSpan.parent)
+	require.Equal(t, http.StatusOK, serverSpan.status)
+	require.Equal(t, "BackendService.Echo", clientSpan.name)
+	require.Equal(t, api2.SpanKindClient, clientSpan.kind)
+	require.Equal(t, serverSpan.sc, clientSpan.parent)
+
+	backendSpan := backendTracer.ended()[0]
+	require.Equal(t, "BackendService.Echo", backendSpan.name)
+	require.Equal(t, clientSpan.sc, backendSpan.parent)
+	require.Equal(t, "vendor=value", backendSpan.parent.TraceState)
+	require.Equal(t, root.TraceID, backendSpan.sc.TraceID)
+}
+
+func TestParseTraceparent(t *testing.T) {
+	sc, err := api2.ParseTraceparent("00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	require.NoError(t, err)
+	require.Equal(t, byte(1), sc.Flags)
+	require.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", sc.Traceparent())
+
+	for _, bad := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473x-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+	} {
+		_, err := api2.ParseTraceparent(bad)
+		require.Error(t, err, bad)
+	}
+}
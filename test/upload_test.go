@@ -0,0 +1,238 @@
+package api2
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/textproto"
+	"testing"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFormFiles(t *testing.T) {
+	type UploadRequest struct {
+		Album   string         `url:"album"`
+		Reverse bool           `query:"reverse"`
+		Title   string         `form:"title" validate:"required"`
+		Image   *api2.FormFile `form_file:"image"`
+		Thumb   *api2.FormFile `form_file:"thumb"`
+	}
+	type File struct {
+		Name        string `json:"name"`
+		ContentType string `json:"content_type"`
+		Size        int64  `json:"size"`
+		Sha256      string `json:"sha256"`
+	}
+	type UploadResponse struct {
+		Title string `json:"title"`
+		Files []File `json:"files"`
+	}
+
+	started := make(chan struct{}, 1)
+	uploadHandler := func(ctx context.Context, req *UploadRequest) (*UploadResponse, error) {
+		started <- struct{}{}
+		files := []*api2.FormFile{req.Image, req.Thumb}
+		if req.Reverse {
+			files = []*api2.FormFile{req.Thumb, req.Image}
+		}
+		res := &UploadResponse{Title: req.Album + "/" + req.Title}
+		for _, file := range files {
+			hash := sha256.New()
+			size, err := io.Copy(hash, file)
+			if err != nil {
+				return nil, err
+			}
+			res.Files = append(res.Files, File{
+				Name:        file.Filename(),
+				ContentType: file.ContentType(),
+				Size:        size,
+				Sha256:      hex.EncodeToString(hash.Sum(nil)),
+			})
+		}
+		return res, nil
+	}
+
+	routes := []api2.Route{
+		{Method: http.MethodPost, Path: "/albums/:album/upload", Handler: uploadHandler, Transport: &api2.JsonTransport{}},
+	}
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL)
+	ctx := context.Background()
+
+	fileInfo := func(name, contentType string, content []byte) File {
+		hash := sha256.Sum256(content)
+		return File{
+			Name:        name,
+			ContentType: contentType,
+			Size:        int64(len(content)),
+			Sha256:      hex.EncodeToString(hash[:]),
+		}
+	}
+
+	t.Run("client", func(t *testing.T) {
+		image := bytes.Repeat([]byte("image"), 1000)
+		thumb := []byte("thumb")
+		res := &UploadResponse{}
+		require.NoError(t, client.Call(ctx, res, &UploadRequest{
+			Album: "trip",
+			Title: "Sunset",
+			Image: api2.NewFormFile("sunset.png", "image/png", bytes.NewReader(image)),
+			Thumb: api2.NewFormFile("thumb.bin", "", bytes.NewReader(thumb)),
+		}))
+		require.Equal(t, &UploadResponse{
+			Title: "trip/Sunset",
+			Files: []File{
+				fileInfo("sunset.png", "image/png", image),
+				fileInfo("thumb.bin", "application/octet-stream", thumb),
+			},
+		}, res)
+		<-started
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		res := &UploadResponse{}
+		require.NoError(t, client.Call(ctx, res, &UploadRequest{
+			Album: "trip",
+			Title: "Sunset",
+			Thumb: api2.NewFormFile("thumb.bin", "", bytes.NewReader([]byte("thumb"))),
+		}))
+		require.Equal(t, fileInfo("", "application/octet-stream", nil), res.Files[0])
+		require.Equal(t, fileInfo("thumb.bin", "application/octet-stream", []byte("thumb")), res.Files[1])
+		<-started
+	})
+
+	t.Run("streaming", func(t *testing.T) {
+		// The handler starts before the client sends the whole file.
+		chunk := bytes.Repeat([]byte{'x'}, 1<<20)
+		pr, pw := io.Pipe()
+		go func() {
+			if _, err := pw.Write(chunk); err != nil {
+				return
+			}
+			<-started
+			for i := 0; i < 3; i++ {
+				if _, err := pw.Write(chunk); err != nil {
+					return
+				}
+			}
+			pw.Close()
+		}()
+		res := &UploadResponse{}
+		require.NoError(t, client.Call(ctx, res, &UploadRequest{
+			Album: "trip",
+			Title: "Video",
+			Image: api2.NewFormFile("video.mp4", "video/mp4", pr),
+		}))
+		require.Equal(t, fileInfo("video.mp4", "video/mp4", bytes.Repeat(chunk, 4)), res.Files[0])
+	})
+
+	postMultipart := func(t *testing.T, query string, parts ...[3]string) (*http.Response, []byte) {
+		var buf bytes.Buffer
+		mw := multipart.NewWriter(&buf)
+		for _, part := range parts {
+			header := make(textproto.MIMEHeader)
+			disposition := `form-data; name="` + part[0] + `"`
+			if part[1] != "" {
+				disposition += `; filename="` + part[1] + `"`
+			}
+			header.Set("Content-Disposition", disposition)
+			w, err := mw.CreatePart(header)
+			require.NoError(t, err)
+			_, err = io.WriteString(w, part[2])
+			require.NoError(t, err)
+		}
+		require.NoError(t, mw.Close())
+		res, err := http.Post(server.URL+"/albums/trip/upload"+query, mw.FormDataContentType(), &buf)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res, body
+	}
+
+	t.Run("raw multipart", func(t *testing.T) {
+		res, body := postMultipart(t, "",
+			[3]string{"title", "", "Sunset"},
+			[3]string{"image", "a.png", "aaa"},
+			[3]string{"image", "b.png", "duplicate"},
+			[3]string{"unknown", "", "ignored"},
+			[3]string{"thumb", "t.png", "ttt"},
+		)
+		require.Equal(t, http.StatusOK, res.StatusCode, string(body))
+		<-started
+		var response UploadResponse
+		require.NoError(t, json.Unmarshal(body, &response))
+		require.Equal(t, []File{
+			fileInfo("a.png", "application/octet-stream", []byte("aaa")),
+			fileInfo("t.png", "application/octet-stream", []byte("ttt")),
+		}, response.Files)
+	})
+
+	t.Run("skipped file", func(t *testing.T) {
+		res, body := postMultipart(t, "?reverse=true",
+			[3]string{"title", "", "Sunset"},
+			[3]string{"image", "a.png", "aaa"},
+			[3]string{"thumb", "t.png", "ttt"},
+		)
+		require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+		require.Contains(t, string(body), "form file image was skipped")
+		<-started
+	})
+
+	t.Run("form field after files", func(t *testing.T) {
+		res, body := postMultipart(t, "",
+			[3]string{"title", "", "Sunset"},
+			[3]string{"image", "a.png", "aaa"},
+			[3]string{"title", "", "Sunrise"},
+		)
+		require.Equal(t, http.StatusInternalServerError, res.StatusCode)
+		require.Contains(t, string(body), "form field title follows files")
+		<-started
+
+		// Form fields are parsed before the handler is called.
+		res, body = postMultipart(t, "",
+			[3]string{"image", "a.png", "aaa"},
+			[3]string{"title", "", "Sunset"},
+		)
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+		require.Contains(t, string(body), "Title")
+	})
+}
+
+func TestFormFilesValidation(t *testing.T) {
+	type WrongTypeRequest struct {
+		Image []byte `form_file:"image"`
+	}
+	type MixedRequest struct {
+		Image *api2.FormFile `form_file:"image"`
+		Note  string         `json:"note"`
+	}
+	type Response struct{}
+	wrongTypeHandler := func(ctx context.Context, req *WrongTypeRequest) (*Response, error) {
+		return &Response{}, nil
+	}
+	mixedHandler := func(ctx context.Context, req *MixedRequest) (*Response, error) {
+		return &Response{}, nil
+	}
+	require.PanicsWithValue(t, "field Image of struct WrongTypeRequest: hasFormFile=true, but type is []uint8, not *api2.FormFile", func() {
+		api2.BindRoutes(http.NewServeMux(), []api2.Route{
+			{Method: http.MethodPost, Path: "/upload", Handler: wrongTypeHandler},
+		})
+	})
+	require.PanicsWithValue(t, "struct MixedRequest has both form ([Image]) and body ([Note]) fields", func() {
+		api2.BindRoutes(http.NewServeMux(), []api2.Route{
+			{Method: http.MethodPost, Path: "/upload", Handler: mixedHandler},
+		})
+	})
+}
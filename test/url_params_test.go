@@ -2,9 +2,11 @@ package api2
 
 import (
 	"context"
+	"encoding/json"
 	"net/http"
 	"net/http/httptest"
 	"sort"
+	"strconv"
 	"testing"
 
 	"github.com/starius/api2"
@@ -433,3 +435,101 @@ func TestUrlParams(t *testing.T) {
 		require.Equal(t, []string{"Welcome"}, res.CommentResponses)
 	})
 }
+
+func TestUrlParamsSyntax(t *testing.T) {
+	type FileRequest struct {
+		Path string `url:"path"`
+	}
+	type ItemByIdRequest struct {
+		Id int `url:"id"`
+	}
+	type ItemBySlugRequest struct {
+		Slug string `url:"slug"`
+	}
+	type TagRequest struct {
+		Tag string `url:"tag"`
+	}
+	type Response struct {
+		Route string `json:"route"`
+		Value string `json:"value"`
+	}
+
+	handleFile := func(ctx context.Context, req *FileRequest) (*Response, error) {
+		return &Response{Route: "file", Value: req.Path}, nil
+	}
+	handleItemById := func(ctx context.Context, req *ItemByIdRequest) (*Response, error) {
+		return &Response{Route: "id", Value: strconv.Itoa(req.Id)}, nil
+	}
+	handleItemBySlug := func(ctx context.Context, req *ItemBySlugRequest) (*Response, error) {
+		return &Response{Route: "slug", Value: req.Slug}, nil
+	}
+	handleTag := func(ctx context.Context, req *TagRequest) (*Response, error) {
+		return &Response{Route: "tag", Value: req.Tag}, nil
+	}
+
+	routes := []api2.Route{
+		{Method: http.MethodGet, Path: "/files/*path", Handler: handleFile},
+		{Method: http.MethodGet, Path: "/items/:slug", Handler: handleItemBySlug},
+		{Method: http.MethodGet, Path: "/items/:id{int}", Handler: handleItemById},
+		{Method: http.MethodGet, Path: "/tags/:tag{[a-z]+}", Handler: handleTag},
+	}
+	mux := http.NewServeMux()
+	// "/items/:id{int}" is preferred over "/items/:slug".
+	api2.BindRoutes(mux, routes, api2.AllowAmbiguousRoutes(true))
+	server := httptest.NewServer(mux)
+	defer server.Close()
+	client := api2.NewClient(routes, server.URL)
+	ctx := context.Background()
+
+	t.Run("client", func(t *testing.T) {
+		var res Response
+		require.NoError(t, client.Call(ctx, &res, &FileRequest{Path: "docs/a/b.txt"}))
+		require.Equal(t, Response{Route: "file", Value: "docs/a/b.txt"}, res)
+		require.NoError(t, client.Call(ctx, &res, &ItemByIdRequest{Id: -42}))
+		require.Equal(t, Response{Route: "id", Value: "-42"}, res)
+		require.NoError(t, client.Call(ctx, &res, &ItemBySlugRequest{Slug: "hello"}))
+		require.Equal(t, Response{Route: "slug", Value: "hello"}, res)
+		require.NoError(t, client.Call(ctx, &res, &TagRequest{Tag: "go"}))
+		require.Equal(t, Response{Route: "tag", Value: "go"}, res)
+	})
+
+	t.Run("client checks constraints", func(t *testing.T) {
+		var res Response
+		err := client.Call(ctx, &res, &TagRequest{Tag: "Go"})
+		require.ErrorContains(t, err, `value "Go" of parameter tag does not match "[a-z]+"`)
+	})
+
+	get := func(t *testing.T, path string) (int, Response) {
+		httpRes, err := http.Get(server.URL + path)
+		require.NoError(t, err)
+		defer httpRes.Body.Close()
+		var res Response
+		if httpRes.StatusCode == http.StatusOK {
+			require.NoError(t, json.NewDecoder(httpRes.Body).Decode(&res))
+		}
+		return httpRes.StatusCode, res
+	}
+
+	t.Run("server", func(t *testing.T) {
+		cases := []struct {
+			path       string
+			wantStatus int
+			want       Response
+		}{
+			{path: "/files/a.txt", wantStatus: http.StatusOK, want: Response{Route: "file", Value: "a.txt"}},
+			{path: "/files/a/b/c", wantStatus: http.StatusOK, want: Response{Route: "file", Value: "a/b/c"}},
+			{path: "/files/", wantStatus: http.StatusOK, want: Response{Route: "file", Value: ""}},
+			// The constrained parameter is preferred regardless of order.
+			{path: "/items/123", wantStatus: http.StatusOK, want: Response{Route: "id", Value: "123"}},
+			{path: "/items/12a", wantStatus: http.StatusOK, want: Response{Route: "slug", Value: "12a"}},
+			{path: "/items/1/2", wantStatus: http.StatusNotFound},
+			{path: "/tags/go", wantStatus: http.StatusOK, want: Response{Route: "tag", Value: "go"}},
+			{path: "/tags/Go", wantStatus: http.StatusNotFound},
+		}
+		for _, tc := range cases {
+			status, res := get(t, tc.path)
+			require.Equal(t, tc.wantStatus, status, tc.path)
+			require.Equal(t, tc.want, res, tc.path)
+		}
+	})
+}
@@ -0,0 +1,155 @@
+package api2
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+type BadNode struct {
+	Child *BadChild `json:"child"`
+	Flag  bool      `json:"flag" validate:"min=1"`
+}
+
+type BadChild struct {
+	Parent *BadNode `json:"parent"`
+	Name   string   `json:"name" validate:"required"`
+}
+
+func TestValidate(t *testing.T) {
+	type Item struct {
+		Name string `json:"name" validate:"required"`
+	}
+	type CreateRequest struct {
+		Name   string   `json:"name" validate:"required,min=2,max=10"`
+		Age    int      `json:"age" validate:"min=18,max=150"`
+		Color  string   `json:"color" validate:"oneof=red green blue"`
+		Code   string   `json:"code" validate:"regexp=^[a-z]{2,3}$"`
+		Tags   []string `json:"tags" validate:"max=2"`
+		Limit  *int     `json:"limit" validate:"min=1"`
+		Items  []Item   `json:"items"`
+		Region string   `query:"region" validate:"len=2"`
+	}
+	type CreateResponse struct {
+	}
+
+	var calls int64
+	createHandler := func(ctx context.Context, req *CreateRequest) (res *CreateResponse, err error) {
+		atomic.AddInt64(&calls, 1)
+		return &CreateResponse{}, nil
+	}
+
+	routes := []api2.Route{
+		{Method: http.MethodPost, Path: "/create", Handler: createHandler},
+	}
+
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	valid := func() *CreateRequest {
+		return &CreateRequest{
+			Name:   "alice",
+			Age:    30,
+			Color:  "red",
+			Code:   "abc",
+			Tags:   []string{"x"},
+			Items:  []Item{{Name: "item"}},
+			Region: "us",
+		}
+	}
+
+	zero := 0
+	invalid := &CreateRequest{
+		Name:   "a",
+		Age:    10,
+		Color:  "pink",
+		Code:   "ABC",
+		Tags:   []string{"x", "y", "z"},
+		Limit:  &zero,
+		Items:  []Item{{Name: "item"}, {}},
+		Region: "usa",
+	}
+	wantViolations := []api2.FieldViolation{
+		{Field: "name", Rule: "min=2", Message: "length must be at least 2"},
+		{Field: "age", Rule: "min=18", Message: "value must be at least 18"},
+		{Field: "color", Rule: "oneof=red green blue", Message: "must be one of [red green blue]"},
+		{Field: "code", Rule: "regexp=^[a-z]{2,3}$", Message: "must match regexp ^[a-z]{2,3}$"},
+		{Field: "tags", Rule: "max=2", Message: "length must be at most 2"},
+		{Field: "limit", Rule: "min=1", Message: "value must be at least 1"},
+		{Field: "items[1].name", Rule: "required", Message: "is required"},
+		{Field: "region", Rule: "len=2", Message: "length must be exactly 2"},
+	}
+
+	ctx := context.Background()
+
+	t.Run("valid", func(t *testing.T) {
+		client := api2.NewClient(routes, server.URL)
+		atomic.StoreInt64(&calls, 0)
+		err := client.Call(ctx, &CreateResponse{}, valid())
+		require.NoError(t, err)
+		require.Equal(t, int64(1), atomic.LoadInt64(&calls))
+	})
+
+	t.Run("server validation", func(t *testing.T) {
+		client := api2.NewClient(routes, server.URL)
+		atomic.StoreInt64(&calls, 0)
+		err := client.Call(ctx, &CreateResponse{}, invalid)
+		var validationErr *api2.ValidationError
+		require.True(t, errors.As(err, &validationErr), "error %v is not ValidationError", err)
+		require.Equal(t, wantViolations, validationErr.Violations)
+		require.Equal(t, int64(0), atomic.LoadInt64(&calls))
+	})
+
+	t.Run("client validation", func(t *testing.T) {
+		client := api2.NewClient(routes, "http://127.0.0.1:1", api2.ClientValidation(true))
+		err := client.Call(ctx, &CreateResponse{}, invalid)
+		var validationErr *api2.ValidationError
+		require.True(t, errors.As(err, &validationErr), "error %v is not ValidationError", err)
+		require.Equal(t, wantViolations, validationErr.Violations)
+	})
+
+	t.Run("Validate", func(t *testing.T) {
+		require.NoError(t, api2.Validate(valid()))
+		require.Error(t, api2.Validate(&CreateRequest{}))
+	})
+
+	t.Run("bad tag", func(t *testing.T) {
+		type BadRequest struct {
+			Flag bool `json:"flag" validate:"min=1"`
+		}
+		type BadResponse struct {
+		}
+		badHandler := func(ctx context.Context, req *BadRequest) (res *BadResponse, err error) {
+			return &BadResponse{}, nil
+		}
+		// The second attempt must panic as well.
+		for i := 0; i < 2; i++ {
+			require.Panics(t, func() {
+				api2.BindRoutes(http.NewServeMux(), []api2.Route{
+					{Method: http.MethodPost, Path: "/bad", Handler: badHandler},
+				})
+			})
+		}
+		require.Panics(t, func() {
+			_ = api2.Validate(&BadRequest{})
+		})
+	})
+
+	t.Run("bad tag in recursive type", func(t *testing.T) {
+		require.Panics(t, func() {
+			_ = api2.Validate(&BadNode{})
+		})
+		// BadChild refers to BadNode, so it must not be cached either.
+		require.Panics(t, func() {
+			_ = api2.Validate(&BadChild{})
+		})
+	})
+}
@@ -0,0 +1,183 @@
+package api2
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+type GetUserV1Request struct {
+	ID string `url:"id"`
+}
+
+type GetUserV1Response struct {
+	Name string `json:"name"`
+}
+
+type GetUserV2Request struct {
+	ID     string `url:"id"`
+	Fields string `query:"fields"`
+}
+
+type GetUserV2Response struct {
+	FirstName string `json:"first_name"`
+	LastName  string `json:"last_name"`
+}
+
+type HealthRequest struct {
+}
+
+type HealthResponse struct {
+	Version string `json:"version"`
+}
+
+func TestVersioning(t *testing.T) {
+	getUserV1 := func(ctx context.Context, req *GetUserV1Request) (*GetUserV1Response, error) {
+		return &GetUserV1Response{Name: "John Smith"}, nil
+	}
+	getUserV2 := func(ctx context.Context, req *GetUserV2Request) (*GetUserV2Response, error) {
+		return &GetUserV2Response{FirstName: "John", LastName: "Smith"}, nil
+	}
+	health := func(ctx context.Context, req *HealthRequest) (*HealthResponse, error) {
+		route, _ := api2.RouteFromContext(ctx)
+		return &HealthResponse{Version: route.Version}, nil
+	}
+
+	routes := []api2.Route{
+		{Method: http.MethodGet, Path: "/users/:id", Handler: getUserV1, Version: "v1"},
+		{Method: http.MethodGet, Path: "/users/:id", Handler: getUserV2, Version: "v2"},
+		{Method: http.MethodGet, Path: "/health", Handler: health},
+	}
+	require.NoError(t, api2.CheckRoutes(routes))
+
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	ctx := context.Background()
+
+	t.Run("pinned clients", func(t *testing.T) {
+		clientV1 := api2.NewClient(routes, server.URL, api2.PinVersion("v1"))
+		resV1 := &GetUserV1Response{}
+		require.NoError(t, clientV1.Call(ctx, resV1, &GetUserV1Request{ID: "1"}))
+		require.Equal(t, "John Smith", resV1.Name)
+
+		clientV2 := api2.NewClient(routes, server.URL, api2.PinVersion("v2"))
+		resV2 := &GetUserV2Response{}
+		require.NoError(t, clientV2.Call(ctx, resV2, &GetUserV2Request{ID: "1"}))
+		require.Equal(t, &GetUserV2Response{FirstName: "John", LastName: "Smith"}, resV2)
+
+		// Routes of other versions are not known to the client.
+		require.Panics(t, func() {
+			_ = clientV2.Call(ctx, &GetUserV1Response{}, &GetUserV1Request{ID: "1"})
+		})
+
+		// Unversioned routes are available in all versions.
+		health := &HealthResponse{}
+		require.NoError(t, clientV2.Call(ctx, health, &HealthRequest{}))
+		require.Equal(t, "", health.Version)
+	})
+
+	get := func(t *testing.T, header, value string) (int, string) {
+		req, err := http.NewRequest(http.MethodGet, server.URL+"/users/1", nil)
+		require.NoError(t, err)
+		if header != "" {
+			req.Header.Set(header, value)
+		}
+		res, err := http.DefaultClient.Do(req)
+		require.NoError(t, err)
+		defer res.Body.Close()
+		body, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		return res.StatusCode, string(body)
+	}
+
+	t.Run("header", func(t *testing.T) {
+		status, body := get(t, api2.VersionHeader, "v2")
+		require.Equal(t, http.StatusOK, status)
+		require.JSONEq(t, `{"first_name":"John","last_name":"Smith"}`, body)
+	})
+
+	t.Run("media type", func(t *testing.T) {
+		status, body := get(t, "Accept", "application/json; version=v2")
+		require.Equal(t, http.StatusOK, status)
+		require.JSONEq(t, `{"first_name":"John","last_name":"Smith"}`, body)
+	})
+
+	t.Run("no version", func(t *testing.T) {
+		// The first version in the table.
+		status, body := get(t, "", "")
+		require.Equal(t, http.StatusOK, status)
+		require.JSONEq(t, `{"name":"John Smith"}`, body)
+
+		client := api2.NewClient(routes, server.URL)
+		res := &GetUserV2Response{}
+		require.NoError(t, client.Call(ctx, res, &GetUserV2Request{ID: "1"}))
+		require.Equal(t, "John", res.FirstName)
+	})
+
+	t.Run("unsupported version", func(t *testing.T) {
+		status, body := get(t, api2.VersionHeader, "v3")
+		require.Equal(t, http.StatusBadRequest, status)
+		require.Contains(t, body, "unsupported API version: v3")
+	})
+
+	t.Run("matcher", func(t *testing.T) {
+		matcher := api2.GetMatcher(routes)
+		r := httptest.NewRequest(http.MethodGet, "/users/1", nil)
+		r.Header.Set(api2.VersionHeader, "v2")
+		route, has := matcher(r)
+		require.True(t, has)
+		require.Equal(t, "v2", route.Version)
+	})
+}
+
+func TestVersioningByPath(t *testing.T) {
+	getUserV1 := func(ctx context.Context, req *GetUserV1Request) (*GetUserV1Response, error) {
+		return &GetUserV1Response{Name: "John Smith"}, nil
+	}
+	getUserV2 := func(ctx context.Context, req *GetUserV2Request) (*GetUserV2Response, error) {
+		return &GetUserV2Response{FirstName: "John", LastName: "Smith"}, nil
+	}
+	health := func(ctx context.Context, req *HealthRequest) (*HealthResponse, error) {
+		route, _ := api2.RouteFromContext(ctx)
+		return &HealthResponse{Version: route.Version}, nil
+	}
+	common := []api2.Route{
+		{Method: http.MethodGet, Path: "/health", Handler: health},
+	}
+
+	routes := append(
+		api2.Group{Prefix: "/v1", Version: "v1"}.Routes(common, []api2.Route{
+			{Method: http.MethodGet, Path: "/users/:id", Handler: getUserV1},
+		}),
+		api2.Group{Prefix: "/v2", Version: "v2"}.Routes(common, []api2.Route{
+			{Method: http.MethodGet, Path: "/users/:id", Handler: getUserV2},
+		})...,
+	)
+
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	ctx := context.Background()
+
+	for _, version := range []string{"v1", "v2"} {
+		client := api2.NewClient(routes, server.URL, api2.PinVersion(version))
+		res := &HealthResponse{}
+		require.NoError(t, client.Call(ctx, res, &HealthRequest{}))
+		require.Equal(t, version, res.Version)
+	}
+
+	res, err := http.Get(server.URL + "/v2/users/1")
+	require.NoError(t, err)
+	defer res.Body.Close()
+	body, err := io.ReadAll(res.Body)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"first_name":"John","last_name":"Smith"}`, string(body))
+}
@@ -0,0 +1,170 @@
+package api2
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/starius/api2"
+	"github.com/starius/api2/errors"
+	"github.com/stretchr/testify/require"
+)
+
+type ChatMessage struct {
+	Text string `json:"text"`
+}
+
+type ChatRequest struct {
+	Room string              `url:"room"`
+	Name string              `query:"name"`
+	In   <-chan *ChatMessage `ws:"in"`
+	Out  chan<- *ChatMessage `ws:"out"`
+}
+
+type ChatResponse struct{}
+
+func TestWebSocket(t *testing.T) {
+	chatHandler := func(ctx context.Context, req *ChatRequest) (*ChatResponse, error) {
+		if req.Room == "closed" {
+			return nil, errors.NotFound("room %s is closed", req.Room)
+		}
+		select {
+		case req.Out <- &ChatMessage{Text: "welcome " + req.Name + " to " + req.Room}:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+		for message := range req.In {
+			if message.Text == "fail" {
+				return nil, errors.InvalidArgument("bad message")
+			}
+			select {
+			case req.Out <- &ChatMessage{Text: strings.ToUpper(message.Text)}:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+		// The client closed the connection.
+		return &ChatResponse{}, nil
+	}
+
+	routes := []api2.Route{
+		{Method: http.MethodGet, Path: "/chat/:room", Handler: chatHandler, Transport: &api2.WebSocketTransport{}},
+	}
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL)
+	ctx := context.Background()
+
+	require.PanicsWithValue(t, "route POST /chat/:room: the transport upgrades the connection, so the method must be GET", func() {
+		api2.BindRoutes(http.NewServeMux(), []api2.Route{
+			{Method: http.MethodPost, Path: "/chat/:room", Handler: chatHandler, Transport: &api2.WebSocketTransport{}},
+		})
+	})
+
+	// call starts the call and returns the channels and the result.
+	call := func(ctx context.Context, room string) (chan *ChatMessage, chan *ChatMessage, chan error) {
+		in := make(chan *ChatMessage)
+		out := make(chan *ChatMessage)
+		result := make(chan error, 1)
+		go func() {
+			result <- client.Call(ctx, &ChatResponse{}, &ChatRequest{
+				Room: room,
+				Name: "alice",
+				In:   in,
+				Out:  out,
+			})
+		}()
+		return in, out, result
+	}
+
+	t.Run("chat", func(t *testing.T) {
+		in, out, result := call(ctx, "general")
+		require.Equal(t, &ChatMessage{Text: "welcome alice to general"}, <-out)
+		for _, text := range []string{"hello", "bye"} {
+			in <- &ChatMessage{Text: text}
+			require.Equal(t, &ChatMessage{Text: strings.ToUpper(text)}, <-out)
+		}
+		close(in)
+		require.NoError(t, <-result)
+		_, ok := <-out
+		require.False(t, ok)
+	})
+
+	t.Run("large message", func(t *testing.T) {
+		in, out, result := call(ctx, "general")
+		<-out
+		text := strings.Repeat("x", 100000)
+		in <- &ChatMessage{Text: text}
+		require.Equal(t, &ChatMessage{Text: strings.ToUpper(text)}, <-out)
+		close(in)
+		require.NoError(t, <-result)
+	})
+
+	t.Run("handler error", func(t *testing.T) {
+		in, out, result := call(ctx, "general")
+		<-out
+		in <- &ChatMessage{Text: "fail"}
+		err := <-result
+		var httpErr api2.HttpError
+		require.ErrorAs(t, err, &httpErr)
+		require.Equal(t, http.StatusBadRequest, httpErr.HttpCode())
+		require.Contains(t, err.Error(), "bad message")
+		_, ok := <-out
+		require.False(t, ok)
+	})
+
+	t.Run("error before messages", func(t *testing.T) {
+		_, _, result := call(ctx, "closed")
+		err := <-result
+		var httpErr api2.HttpError
+		require.ErrorAs(t, err, &httpErr)
+		require.Equal(t, http.StatusNotFound, httpErr.HttpCode())
+		require.Contains(t, err.Error(), "room closed is closed")
+	})
+
+	t.Run("cancel", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(ctx)
+		_, out, result := call(ctx, "general")
+		<-out
+		cancel()
+		require.ErrorIs(t, <-result, context.Canceled)
+	})
+
+	t.Run("not websocket", func(t *testing.T) {
+		res, err := http.Get(server.URL + "/chat/general")
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusUpgradeRequired, res.StatusCode)
+	})
+}
+
+func TestWebSocketValidation(t *testing.T) {
+	type WrongTypeRequest struct {
+		In []*ChatMessage `ws:"in"`
+	}
+	type MixedRequest struct {
+		In   <-chan *ChatMessage `ws:"in"`
+		Note string              `json:"note"`
+	}
+	type Response struct{}
+	wrongTypeHandler := func(ctx context.Context, req *WrongTypeRequest) (*Response, error) {
+		return &Response{}, nil
+	}
+	mixedHandler := func(ctx context.Context, req *MixedRequest) (*Response, error) {
+		return &Response{}, nil
+	}
+	require.PanicsWithValue(t, "field In of struct WrongTypeRequest: hasWs=true, but type is []*api2.ChatMessage, not a channel", func() {
+		api2.BindRoutes(http.NewServeMux(), []api2.Route{
+			{Method: http.MethodGet, Path: "/chat", Handler: wrongTypeHandler, Transport: &api2.WebSocketTransport{}},
+		})
+	})
+	require.PanicsWithValue(t, "struct MixedRequest has both ws ([In]) and body ([Note]) fields", func() {
+		api2.BindRoutes(http.NewServeMux(), []api2.Route{
+			{Method: http.MethodGet, Path: "/chat", Handler: mixedHandler, Transport: &api2.WebSocketTransport{}},
+		})
+	})
+}
@@ -0,0 +1,116 @@
+package api2
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/starius/api2"
+	"github.com/stretchr/testify/require"
+)
+
+func TestXmlTransport(t *testing.T) {
+	type Line struct {
+		SKU      string `xml:"sku,attr"`
+		Quantity int    `xml:"qty"`
+	}
+	type OrderRequest struct {
+		Customer string `url:"customer"`
+		DryRun   bool   `query:"dry_run"`
+		Partner  string `header:"X-Partner"`
+		Lines    []Line `xml:"lines>line" validate:"required"`
+		Comment  string `xml:"comment,omitempty"`
+	}
+	type OrderResponse struct {
+		XMLName xml.Name `xml:"order"`
+		ID      string   `xml:"id,attr"`
+		Total   int      `xml:"total"`
+		Partner string   `header:"X-Partner"`
+	}
+
+	orderHandler := func(ctx context.Context, req *OrderRequest) (*OrderResponse, error) {
+		if req.Customer == "unknown" {
+			return nil, UserNotFound{ID: req.Customer}
+		}
+		total := 0
+		for _, line := range req.Lines {
+			total += line.Quantity
+		}
+		id := "o-" + req.Customer
+		if req.DryRun {
+			id = ""
+		}
+		return &OrderResponse{ID: id, Total: total, Partner: req.Partner}, nil
+	}
+
+	transport := &api2.XmlTransport{
+		Errors: map[string]error{
+			"UserNotFound": UserNotFound{},
+		},
+	}
+	routes := []api2.Route{
+		{Method: http.MethodPost, Path: "/customers/:customer/orders", Handler: orderHandler, Transport: transport},
+	}
+
+	mux := http.NewServeMux()
+	api2.BindRoutes(mux, routes)
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+	client := api2.NewClient(routes, server.URL)
+	ctx := context.Background()
+
+	req := &OrderRequest{
+		Customer: "c1",
+		Partner:  "acme",
+		Lines:    []Line{{SKU: "a", Quantity: 2}, {SKU: "b", Quantity: 3}},
+	}
+	res := &OrderResponse{}
+	require.NoError(t, client.Call(ctx, res, req))
+	require.Equal(t, "o-c1", res.ID)
+	require.Equal(t, 5, res.Total)
+	require.Equal(t, "acme", res.Partner)
+
+	// Registered errors keep their structure.
+	err := client.Call(ctx, res, &OrderRequest{Customer: "unknown", Lines: req.Lines})
+	require.Equal(t, UserNotFound{ID: "unknown"}, err)
+
+	// Builtin errors are registered too.
+	err = client.Call(ctx, res, &OrderRequest{Customer: "c1"})
+	var validationErr *api2.ValidationError
+	require.ErrorAs(t, err, &validationErr)
+
+	t.Run("wire format", func(t *testing.T) {
+		body := `<?xml version="1.0"?>
+<OrderRequest><lines><line sku="x"><qty>7</qty></line></lines></OrderRequest>`
+		res, err := http.Post(server.URL+"/customers/c2/orders?dry_run=true&human=true", "application/xml", strings.NewReader(body))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusOK, res.StatusCode)
+		require.Equal(t, "application/xml; charset=UTF-8", res.Header.Get("Content-Type"))
+		got, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Equal(t, xml.Header+"<order id=\"\">\n  <total>7</total>\n</order>\n", string(got))
+	})
+
+	t.Run("error format", func(t *testing.T) {
+		body := `<OrderRequest><lines><line sku="x"><qty>1</qty></line></lines></OrderRequest>`
+		res, err := http.Post(server.URL+"/customers/unknown/orders", "application/xml", strings.NewReader(body))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusNotFound, res.StatusCode)
+		got, err := io.ReadAll(res.Body)
+		require.NoError(t, err)
+		require.Equal(t, xml.Header+"<error><message>user not found: unknown</message><code>UserNotFound</code><detail><UserNotFound><ID>unknown</ID></UserNotFound></detail></error>\n", string(got))
+	})
+
+	t.Run("malformed body", func(t *testing.T) {
+		res, err := http.Post(server.URL+"/customers/c1/orders", "application/xml", strings.NewReader("<OrderRequest>"))
+		require.NoError(t, err)
+		defer res.Body.Close()
+		require.Equal(t, http.StatusBadRequest, res.StatusCode)
+	})
+}
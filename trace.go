@@ -0,0 +1,172 @@
+package api2
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const (
+	traceparentHeader = "Traceparent"
+	tracestateHeader  = "Tracestate"
+)
+
+// SpanContext identifies a span in W3C Trace Context format
+// (https://www.w3.org/TR/trace-context/).
+type SpanContext struct {
+	TraceID [16]byte
+	SpanID  [8]byte
+
+	// Flags are trace-flags; bit 0x01 means "sampled".
+	Flags byte
+
+	// TraceState is the value of tracestate header, passed as is.
+	TraceState string
+}
+
+// IsValid returns true if both TraceID and SpanID are not zero.
+func (sc SpanContext) IsValid() bool {
+	return sc.TraceID != [16]byte{} && sc.SpanID != [8]byte{}
+}
+
+// Traceparent formats the value of traceparent header.
+func (sc SpanContext) Traceparent() string {
+	return fmt.Sprintf("00-%s-%s-%02x", hex.EncodeToString(sc.TraceID[:]), hex.EncodeToString(sc.SpanID[:]), sc.Flags)
+}
+
+// ParseTraceparent parses the value of traceparent header.
+func ParseTraceparent(traceparent string) (SpanContext, error) {
+	var sc SpanContext
+	parts := strings.Split(traceparent, "-")
+	if len(parts) < 4 {
+		return sc, fmt.Errorf("traceparent %q has %d parts, want 4", traceparent, len(parts))
+	}
+	version, traceID, spanID, flags := parts[0], parts[1], parts[2], parts[3]
+	if len(version) != 2 || version == "ff" {
+		return sc, fmt.Errorf("traceparent %q has bad version", traceparent)
+	}
+	if version == "00" && len(parts) != 4 {
+		return sc, fmt.Errorf("traceparent %q of version 00 has %d parts, want 4", traceparent, len(parts))
+	}
+	if len(traceID) != 32 || len(spanID) != 16 || len(flags) != 2 {
+		return sc, fmt.Errorf("traceparent %q has fields of bad length", traceparent)
+	}
+	if strings.ToLower(traceparent) != traceparent {
+		return sc, fmt.Errorf("traceparent %q must be in lower case", traceparent)
+	}
+	var flagsBytes [1]byte
+	for _, field := range []struct {
+		dst []byte
+		src string
+	}{
+		{sc.TraceID[:], traceID},
+		{sc.SpanID[:], spanID},
+		{flagsBytes[:], flags},
+	} {
+		if _, err := hex.Decode(field.dst, []byte(field.src)); err != nil {
+			return sc, fmt.Errorf("traceparent %q: %w", traceparent, err)
+		}
+	}
+	sc.Flags = flagsBytes[0]
+	if !sc.IsValid() {
+		return sc, fmt.Errorf("traceparent %q has zero trace-id or parent-id", traceparent)
+	}
+	return sc, nil
+}
+
+// NewSpanContext returns a context of new span, child of parent. If parent
+// is not valid, a new trace is started. It is intended to be used by
+// implementations of Tracer.
+func NewSpanContext(parent SpanContext) SpanContext {
+	sc := parent
+	if !parent.IsValid() {
+		sc = SpanContext{Flags: 0x01}
+		if _, err := rand.Read(sc.TraceID[:]); err != nil {
+			panic(err)
+		}
+	}
+	if _, err := rand.Read(sc.SpanID[:]); err != nil {
+		panic(err)
+	}
+	return sc
+}
+
+type spanContextType struct{}
+
+// ContextWithSpanContext returns a copy of ctx with span context attached.
+// Client.Call sends the span context attached to its ctx to the server.
+func ContextWithSpanContext(ctx context.Context, sc SpanContext) context.Context {
+	return context.WithValue(ctx, spanContextType{}, sc)
+}
+
+// SpanContextFromContext returns span context attached to ctx.
+// In a handler it returns the context received from the client (or
+// the context of the server span, if Tracer is used).
+func SpanContextFromContext(ctx context.Context) (SpanContext, bool) {
+	sc, ok := ctx.Value(spanContextType{}).(SpanContext)
+	return sc, ok
+}
+
+func injectSpanContext(ctx context.Context, header http.Header) {
+	sc, ok := SpanContextFromContext(ctx)
+	if !ok || !sc.IsValid() {
+		return
+	}
+	header.Set(traceparentHeader, sc.Traceparent())
+	if sc.TraceState != "" {
+		header.Set(tracestateHeader, sc.TraceState)
+	}
+}
+
+func extractSpanContext(ctx context.Context, header http.Header) context.Context {
+	traceparent := header.Get(traceparentHeader)
+	if traceparent == "" {
+		return ctx
+	}
+	sc, err := ParseTraceparent(traceparent)
+	if err != nil {
+		// Invalid traceparent must be ignored according to the standard.
+		return ctx
+	}
+	sc.TraceState = header.Get(tracestateHeader)
+	return ContextWithSpanContext(ctx, sc)
+}
+
+// SpanKind tells if the span is started by server or by client.
+type SpanKind int
+
+const (
+	SpanKindServer SpanKind = iota
+	SpanKindClient
+)
+
+// Span is a span started by Tracer.
+type Span interface {
+	// End is called when the request is handled or the call is finished.
+	// status is HTTP status (0 if the client got no response).
+	End(status int, err error)
+}
+
+// Tracer connects api2 to a tracing system.
+type Tracer interface {
+	// StartSpan is called when the server starts handling a request or
+	// the client starts a call. name is Service.Method of the handler
+	// (see GetFnInfo). The parent span context, if any, is attached to ctx
+	// (see SpanContextFromContext). The returned context must have the
+	// context of the new span attached with ContextWithSpanContext to be
+	// propagated further.
+	StartSpan(ctx context.Context, name string, kind SpanKind, route *Route) (context.Context, Span)
+}
+
+// Tracing sets the tracer of server or client. Trace context headers are
+// propagated regardless of this option: the client sends the span context
+// attached to ctx and the server attaches the received one to ctx of
+// the handler.
+func Tracing(tracer Tracer) Option {
+	return func(config *Config) {
+		config.tracer = tracer
+	}
+}
@@ -2,10 +2,13 @@ package api2
 
 import (
 	"encoding/json"
+	"fmt"
 	"io"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strconv"
+	"strings"
 	"text/template"
 
 	"github.com/starius/api2/typegen"
@@ -19,18 +22,22 @@ const tsClient = `/* eslint-disable */
 // prettier-disable
 // prettier-ignore
 // Code generated by api2. DO NOT EDIT.
-import {route} from "./utils"
+import {route, sse} from "./utils"
 
 export const api = {
 {{- range $key, $services := .}}
 {{$key}}: {
 	{{- range $service, $methods := $services }}
 	{{$service}}: {
-		{{- range $info := $methods}}
+		{{- range $info := $methods}}{{if .EventType}}
+			{{$info.FnInfo.Method}}: sse<{{.ReqType}}, {{.EventType}}>(
+				"{{.Path}}",
+				{{.TypeInfoReq}}),{{else}}
 			{{$info.FnInfo.Method}}: route<{{.ReqType}}, {{.ResType}}>(
 				"{{.Method}}", "{{.Path}}",
 				{{.TypeInfoReq}},
-				{{.TypeInfoRes}}),{{end}}
+				{{.TypeInfoRes}}{{if .Version}},
+				"{{.Version}}"{{end}}),{{end}}{{end}}
 	},{{end}}
 },{{- end}}
 }
@@ -51,16 +58,47 @@ export function cancelable<T>(p: T, source): T & { cancel: () => void } {
 type RequestMapping = Record<string, string[]>
 type ResponseMapping = Record<string, string[]>
 
-export function route<Req, Res>(method:string, url:string, requestMapping:RequestMapping, responseMapping:ResponseMapping) {
+// fillUrl substitutes parameters ":name" and "*name" of url with fields of
+// data and removes the fields from data.
+function fillUrl(url:string, data:any, urlReqSet:Set<string>) {
+	if (!data || !urlReqSet.size) {
+		return url
+	}
+	return url.split("/").map(part => {
+		let match = /^([:*])([^{]+)/.exec(part)
+		if (!match || !urlReqSet.has(match[2])) {
+			return part
+		}
+		let value = String(data[match[2]])
+		delete data[match[2]]
+		if (match[1] === "*") {
+			return value.split("/").map(encodeURIComponent).join("/")
+		}
+		return encodeURIComponent(value)
+	}).join("/")
+}
+
+export function route<Req, Res>(method:string, url:string, requestMapping:RequestMapping, responseMapping:ResponseMapping, version?:string) {
 	let headersReqSet = new Set(requestMapping.headers)
 	let queryReqSet = new Set(requestMapping.query)
-	let shouldProcess = headersReqSet.size || queryReqSet.size;
+	let formReqSet = new Set(requestMapping.form)
+	let fileReqSet = new Set(requestMapping.file)
+	let urlReqSet = new Set(requestMapping.url)
+	let shouldProcess = headersReqSet.size || queryReqSet.size || formReqSet.size || fileReqSet.size;
 	return Object.assign((data: Req)=>{
 		const c = axios.CancelToken.source()
 		data = {...data};
+		let path = fillUrl(url, data, urlReqSet)
 		let headers = {} as any
+		if (version) {
+			headers["X-Api2-Version"] = version
+		}
 		let query = {} as any
+		let form = null as URLSearchParams | FormData | null
 		if (data && shouldProcess) {
+			if (fileReqSet.size) {
+				form = new FormData()
+			}
 			for(let k in data) {
 					if(headersReqSet.has(k)) {
 						headers[k] = data[k]
@@ -68,11 +106,20 @@ export function route<Req, Res>(method:string, url:string, requestMapping:Reques
 					} else if(queryReqSet.has(k)) {
 						query[k] = data[k]
 						delete data[k];
+					} else if(formReqSet.has(k)) {
+						form = form || new URLSearchParams()
+						form.append(k, String(data[k]))
+						delete data[k];
+					} else if(fileReqSet.has(k)) {
+						if (data[k]) {
+							(form as FormData).append(k, data[k] as any)
+						}
+						delete data[k];
 					}
 				}
 		}
 		let queryAsString = new URLSearchParams(Object.values(query)).toString()
-		return cancelable(axios.request<Res>({ method, url: url + (queryAsString? '?' + queryAsString : '') , data, cancelToken: c.token, headers  }).then(el=>{
+		return cancelable(axios.request<Res>({ method, url: path + (queryAsString? '?' + queryAsString : '') , data: form || data, cancelToken: c.token, headers  }).then(el=>{
 			let res = el.data;
 			for(let k of responseMapping.header) {
 				if(el.headers[k]) {
@@ -81,7 +128,29 @@ export function route<Req, Res>(method:string, url:string, requestMapping:Reques
 			}
 			return res;
 		}), c)
-	}, {method, url})
+	}, {method, url, version})
+}
+
+export function sse<Req, Ev>(url:string, requestMapping:RequestMapping) {
+	let queryReqSet = new Set(requestMapping.query)
+	let urlReqSet = new Set(requestMapping.url)
+	return Object.assign((data: Req, onEvent: (event: Ev, message: MessageEvent) => void, eventNames: string[] = [])=>{
+		data = {...data};
+		let path = fillUrl(url, data, urlReqSet)
+		let query = new URLSearchParams()
+		for(let k in data) {
+			if(queryReqSet.has(k) && data[k] !== undefined) {
+				query.append(k, String(data[k]))
+			}
+		}
+		let queryAsString = query.toString()
+		let source = new EventSource(path + (queryAsString? '?' + queryAsString : ''))
+		let listener = (message: MessageEvent) => onEvent(JSON.parse(message.data), message)
+		for(let name of ["message", ...eventNames]) {
+			source.addEventListener(name, listener as EventListener)
+		}
+		return source
+	}, {url})
 }
 `
 
@@ -116,20 +185,20 @@ func SerializeCustom(t reflect.Type) string {
 	if t == jsonRawMessageType {
 		return "any"
 	}
+	if t == formFileType || t == formFileType.Elem() {
+		return "Blob"
+	}
 	return ""
 }
 
+// GenerateTSClient writes gen.ts and utils.ts to options.OutDir. If routes
+// have versions (see Route.Version), a client is written for each version
+// to subdirectory named after the version, e.g. OutDir/v2/gen.ts. Requests
+// of versioned routes send VersionHeader.
 func GenerateTSClient(options *TypesGenConfig) {
 	if options.ClientTemplate == nil {
 		options.ClientTemplate = tsClientTemplate
 	}
-	_ = os.RemoveAll(filepath.Join(options.OutDir, "gen.ts"))
-	err := os.MkdirAll(options.OutDir, os.ModePerm)
-	panicIf(err)
-	typesFile, err := os.OpenFile(filepath.Join(options.OutDir, "gen.ts"), os.O_WRONLY|os.O_CREATE, 0755)
-	panicIf(err)
-	parser := typegen.NewParser()
-	parser.CustomParse = CustomParse
 	allRoutes := []Route{}
 	for _, getRoutes := range options.Routes {
 		genValue := reflect.ValueOf(getRoutes)
@@ -138,9 +207,28 @@ func GenerateTSClient(options *TypesGenConfig) {
 		routes := routesValues[0].Interface().([]Route)
 		allRoutes = append(allRoutes, routes...)
 	}
+
+	versions := routeVersions(allRoutes)
+	if len(versions) == 0 {
+		generateTSClient(options.OutDir, allRoutes, options)
+		return
+	}
+	for _, version := range versions {
+		generateTSClient(versionDir(options.OutDir, version), versionRoutes(allRoutes, version), options)
+	}
+}
+
+func generateTSClient(outDir string, allRoutes []Route, options *TypesGenConfig) {
+	_ = os.RemoveAll(filepath.Join(outDir, "gen.ts"))
+	err := os.MkdirAll(outDir, os.ModePerm)
+	panicIf(err)
+	typesFile, err := os.OpenFile(filepath.Join(outDir, "gen.ts"), os.O_WRONLY|os.O_CREATE, 0755)
+	panicIf(err)
+	parser := typegen.NewParser()
+	parser.CustomParse = CustomParse
 	genRoutes(typesFile, allRoutes, parser, options)
-	if _, err := os.Stat(filepath.Join(options.OutDir, "utils.ts")); os.IsNotExist(err) {
-		utilsFile, err := os.OpenFile(filepath.Join(options.OutDir, "utils.ts"), os.O_WRONLY|os.O_CREATE, 0755)
+	if _, err := os.Stat(filepath.Join(outDir, "utils.ts")); os.IsNotExist(err) {
+		utilsFile, err := os.OpenFile(filepath.Join(outDir, "utils.ts"), os.O_WRONLY|os.O_CREATE, 0755)
 		panicIf(err)
 		err = tsClientUtilsTemplate.Execute(utilsFile, nil)
 		panicIf(err)
@@ -155,6 +243,9 @@ func serializeTypeInfo(t *preparedType) ([]byte, error) {
 	type resStruct struct {
 		Query  []string `json:"query,omitempty"`
 		Header []string `json:"header,omitempty"`
+		Form   []string `json:"form,omitempty"`
+		File   []string `json:"file,omitempty"`
+		Url    []string `json:"url,omitempty"`
 		Json   []string `json:"json,omitempty"`
 	}
 	res := resStruct{}
@@ -164,6 +255,15 @@ func serializeTypeInfo(t *preparedType) ([]byte, error) {
 	for _, v := range t.QueryMapping {
 		res.Query = append(res.Query, v.Key)
 	}
+	for _, v := range t.FormMapping {
+		res.Form = append(res.Form, v.Key)
+	}
+	for _, v := range t.FileMapping {
+		res.File = append(res.File, v.Key)
+	}
+	for _, v := range t.UrlMapping {
+		res.Url = append(res.Url, v.Key)
+	}
 	if t.TypeForJson != nil {
 		for i := 0; i < t.TypeForJson.NumField(); i++ {
 			ft := t.TypeForJson.Field(i)
@@ -208,12 +308,14 @@ func genRoutes(w io.Writer, routes []Route, p *typegen.Parser, options *TypesGen
 	type routeDef struct {
 		Method      string
 		Path        string
+		Version     string
 		ReqType     string
 		ResType     string
 		Handler     interface{}
 		FnInfo      FnInfo
 		TypeInfoReq string
 		TypeInfoRes string
+		EventType   string
 	}
 	m := map[string]map[string][]routeDef{}
 OUTER:
@@ -234,6 +336,34 @@ OUTER:
 			}
 		}
 		p.Parse(req, response)
+		eventType := ""
+		if t := sseEventTypeOf(route.Transport, response); t != nil {
+			// Server-Sent Events (SseTransport).
+			eventType = "any"
+			e := prepareSseEvent(t)
+			if t.Kind() == reflect.Ptr {
+				t = t.Elem()
+			}
+			if t.Kind() == reflect.Struct {
+				p.Parse(t)
+				eventType = t.String()
+				// Fields passed in SSE fields are not in JSON data.
+				var sseFields []string
+				for _, i := range []int{e.IdField, e.EventField, e.RetryField} {
+					if i == noField {
+						continue
+					}
+					tag, err := typegen.ParseStructTag(t.Field(i).Tag)
+					panicIf(err)
+					if tag.State != typegen.Ignored && tag.State != typegen.NoInfo {
+						sseFields = append(sseFields, strconv.Quote(tag.FieldName))
+					}
+				}
+				if len(sseFields) != 0 {
+					eventType = fmt.Sprintf("Omit<%s, %s>", eventType, strings.Join(sseFields, " | "))
+				}
+			}
+		}
 		TypeInfoReq, err := serializeTypeInfo(prepare(req))
 		panicIf(err)
 		TypeInfoRes, err := serializeTypeInfo(prepare(response))
@@ -243,10 +373,12 @@ OUTER:
 			ResType:     response.String(),
 			Method:      route.Method,
 			Path:        route.Path,
+			Version:     route.Version,
 			Handler:     route.Handler,
 			FnInfo:      fnInfo,
 			TypeInfoReq: string(TypeInfoReq),
 			TypeInfoRes: string(TypeInfoRes),
+			EventType:   eventType,
 		}
 
 		if _, ok := m[fnInfo.PkgName]; !ok {
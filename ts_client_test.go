@@ -0,0 +1,52 @@
+package api2
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/starius/api2/typegen"
+	"github.com/stretchr/testify/require"
+)
+
+type tickRequest struct {
+	Symbol string `url:"symbol"`
+}
+
+type tickEvent struct {
+	ID    string        `sse:"id" json:"id"`
+	Retry time.Duration `sse:"retry"`
+	Price float64       `json:"price"`
+}
+
+type tickResponse struct {
+	Events chan *tickEvent `use_as_body:"true"`
+}
+
+type tickService struct{}
+
+func (s *tickService) Ticks(ctx context.Context, req *tickRequest) (*tickResponse, error) {
+	return nil, nil
+}
+
+func (s *tickService) Records(ctx context.Context, req *tickRequest) (*tickResponse, error) {
+	return nil, nil
+}
+
+func TestGenRoutesSse(t *testing.T) {
+	s := &tickService{}
+	routes := []Route{
+		{Method: http.MethodGet, Path: "/ticks/:symbol", Handler: s.Ticks, Transport: SseTransport},
+		{Method: http.MethodGet, Path: "/records/:symbol", Handler: s.Records, Transport: NdjsonTransport},
+	}
+	var buf strings.Builder
+	genRoutes(&buf, routes, typegen.NewParser(), &TypesGenConfig{})
+	gen := buf.String()
+
+	require.Contains(t, gen, `Ticks: sse<api2.tickRequest, Omit<api2.tickEvent, "id">>(
+				"/ticks/:symbol",
+				{"url":["symbol"]}),`)
+	require.Contains(t, gen, `Records: route<api2.tickRequest, api2.tickResponse>(`)
+}
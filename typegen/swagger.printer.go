@@ -112,6 +112,12 @@ func GenerateOpenApi(p *Parser, s IType) spec.Schema {
 			})
 			if propertiesTypes.Properties[keyName].Value != nil {
 				propertiesTypes.Properties[keyName].Value.Description = field.Doc
+				validateToSwagger(field.Type, propertiesTypes.Properties[keyName].Value, field.Tag.Validate)
+			}
+			for _, rule := range field.Tag.Validate {
+				if rule.Name == "required" {
+					propertiesTypes.Required = append(propertiesTypes.Required, keyName)
+				}
 			}
 		}
 	}
@@ -1,12 +1,15 @@
 package typegen
 
 import (
+	"bytes"
 	"os"
 	"reflect"
 	"testing"
 
+	spec "github.com/getkin/kin-openapi/openapi3"
 	gots "github.com/starius/api2/typegen"
 	"github.com/starius/api2/typegen/tests/types"
+	"github.com/stretchr/testify/require"
 )
 
 func TestV2(t *testing.T) {
@@ -48,3 +51,24 @@ func TestV2(t *testing.T) {
 // 		t.Fatalf("wrong output\ngot:\n'%s'\nwant:\n'%s'", outString, expected)
 // 	}
 // }
+
+func TestValidateRules(t *testing.T) {
+	p := gots.NewFromTypes(&types.Validated{})
+
+	swag := spec.T{Components: &spec.Components{}}
+	gots.PrintSwagger(p, &swag)
+	schema := swag.Components.Schemas["types.Validated"].Value
+	require.Equal(t, []string{"name"}, schema.Required)
+	name := schema.Properties["name"].Value
+	require.Equal(t, uint64(2), name.MinLength)
+	require.Equal(t, uint64(10), *name.MaxLength)
+	require.Equal(t, 18.0, *schema.Properties["age"].Value.Min)
+	require.Equal(t, []interface{}{"red", "green"}, schema.Properties["color"].Value.Enum)
+	tags := schema.Properties["tags"].Value
+	require.Equal(t, uint64(3), tags.MinItems)
+	require.Equal(t, uint64(3), *tags.MaxItems)
+
+	var buf bytes.Buffer
+	gots.PrintTsTypes(p, &buf, nil)
+	require.Contains(t, buf.String(), "name: string // @validate required,min=2,max=10")
+}
@@ -71,3 +71,10 @@ type User struct {
 	SecondName  string       `json:"secondName"` // hello
 	Tags        []UserTag    `json:"tags"`       // dima
 }
+
+type Validated struct {
+	Name  string   `json:"name" validate:"required,min=2,max=10"`
+	Age   int      `json:"age" validate:"min=18"`
+	Color string   `json:"color" validate:"oneof=red green"`
+	Tags  []string `json:"tags" validate:"len=3"`
+}
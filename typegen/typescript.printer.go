@@ -23,10 +23,10 @@ export declare namespace {{$namespace}} {
 const RecordTemplate = `{{ range $field := .Embedded}} {{$field | RefName}} & {{end}}{
 {{- range $field := .Fields}}
 	{{- if hasPrefix $field.Doc "@deprecated" }}
-	/** {{ $field.Doc }} */
+	/** {{ $field | Doc }} */
 	{{$field | Row}}
 	{{- else }}
-	{{$field | Row}}{{if $field.Doc| ne ""}} // {{$field.Doc}}{{end}}
+	{{$field | Row}}{{if $field | Doc | ne ""}} // {{$field | Doc}}{{end}}
 	{{- end }}
 {{- end}}
 }
@@ -150,6 +150,20 @@ func PrintTsTypes(parser *Parser, w io.Writer, stringify Stringifier, opts ...Ts
 
 				return fmt.Sprintf("%s%s: %s%s", keyName, optionalText, fieldType, nullText)
 			},
+			"Doc": func(t RecordField) string {
+				if len(t.Tag.Validate) == 0 {
+					return t.Doc
+				}
+				rules := make([]string, 0, len(t.Tag.Validate))
+				for _, rule := range t.Tag.Validate {
+					rules = append(rules, rule.String())
+				}
+				validate := fmt.Sprintf("@validate %s", strings.Join(rules, ","))
+				if t.Doc == "" {
+					return validate
+				}
+				return t.Doc + " " + validate
+			},
 			"hasPrefix": strings.HasPrefix,
 		}).Parse(RecordTemplate)
 		panicIf(err)
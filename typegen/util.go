@@ -54,6 +54,7 @@ type ParseResult struct {
 	FieldName string
 	FieldType string
 	State     PropertyState
+	Validate  []ValidateRule
 }
 
 func saveGet(arr []string, i int) string {
@@ -69,10 +70,18 @@ func parseJsonLikeTag(str string) (string, string) {
 }
 func ParseStructTag(structTag reflect.StructTag) (*ParseResult, error) {
 	result := &ParseResult{}
+	validate, err := ParseValidateTag(structTag.Get("validate"))
+	if err != nil {
+		return nil, err
+	}
+	result.Validate = validate
 	var (
 		jsonTagVal, jsonTagOption = parseJsonLikeTag(structTag.Get("json"))
 		queryTagVal, _            = parseJsonLikeTag(structTag.Get("query"))
 		headerTagVal, _           = parseJsonLikeTag(structTag.Get("header"))
+		formTagVal, _             = parseJsonLikeTag(structTag.Get("form"))
+		fileTagVal, _             = parseJsonLikeTag(structTag.Get("form_file"))
+		urlTagVal, _              = parseJsonLikeTag(structTag.Get("url"))
 		tsTagVal, tsTagOptions    = parseJsonLikeTag(structTag.Get("ts"))
 	)
 
@@ -91,6 +100,15 @@ func ParseStructTag(structTag reflect.StructTag) (*ParseResult, error) {
 		if result.FieldName == "" {
 			result.FieldName = queryTagVal
 		}
+		if result.FieldName == "" {
+			result.FieldName = formTagVal
+		}
+		if result.FieldName == "" {
+			result.FieldName = fileTagVal
+		}
+		if result.FieldName == "" {
+			result.FieldName = urlTagVal
+		}
 		switch tsTagOptions {
 		case "no-null":
 			result.State = NotNull
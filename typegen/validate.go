@@ -0,0 +1,111 @@
+package typegen
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	spec "github.com/getkin/kin-openapi/openapi3"
+)
+
+// ValidateRule is one rule from `validate:"..."` struct tag.
+type ValidateRule struct {
+	Name  string
+	Param string
+}
+
+func (r ValidateRule) String() string {
+	if r.Param == "" {
+		return r.Name
+	}
+	return r.Name + "=" + r.Param
+}
+
+var validateRulesWithParam = map[string]bool{
+	"required": false,
+	"min":      true,
+	"max":      true,
+	"len":      true,
+	"oneof":    true,
+	"regexp":   true,
+}
+
+// ParseValidateTag parses the value of `validate:"..."` struct tag.
+// Rules are separated by commas: "required,min=1,max=10". Rule "regexp"
+// consumes the rest of the tag, so the regular expression may contain
+// commas, but the rule must be the last one.
+func ParseValidateTag(tag string) ([]ValidateRule, error) {
+	var rules []ValidateRule
+	for tag != "" {
+		var part string
+		if strings.HasPrefix(tag, "regexp=") {
+			part, tag = tag, ""
+		} else {
+			part, tag, _ = strings.Cut(tag, ",")
+		}
+		name, param, hasParam := strings.Cut(part, "=")
+		withParam, known := validateRulesWithParam[name]
+		if !known {
+			return nil, fmt.Errorf("unknown validation rule %q", name)
+		}
+		if withParam != hasParam {
+			return nil, fmt.Errorf("validation rule %q: hasParam=%v, want %v", name, hasParam, withParam)
+		}
+		rules = append(rules, ValidateRule{Name: name, Param: param})
+	}
+	return rules, nil
+}
+
+func validateToSwagger(t reflect.Type, schema *spec.Schema, rules []ValidateRule) {
+	k := t.Kind()
+	for _, rule := range rules {
+		switch rule.Name {
+		case "min", "max", "len":
+			value, err := strconv.ParseFloat(rule.Param, 64)
+			panicIf(err)
+			switch {
+			case isNumber(k):
+				if rule.Name != "max" {
+					schema.Min = &value
+				}
+				if rule.Name != "min" {
+					schema.Max = &value
+				}
+			case k == reflect.String:
+				if rule.Name != "max" {
+					schema.MinLength = uint64(value)
+				}
+				if rule.Name != "min" {
+					schema.MaxLength = spec.Uint64Ptr(uint64(value))
+				}
+			case k == reflect.Slice || k == reflect.Array:
+				if rule.Name != "max" {
+					schema.MinItems = uint64(value)
+				}
+				if rule.Name != "min" {
+					schema.MaxItems = spec.Uint64Ptr(uint64(value))
+				}
+			case k == reflect.Map:
+				if rule.Name != "max" {
+					schema.MinProps = uint64(value)
+				}
+				if rule.Name != "min" {
+					schema.MaxProps = spec.Uint64Ptr(uint64(value))
+				}
+			}
+		case "oneof":
+			for _, option := range strings.Fields(rule.Param) {
+				if isNumber(k) {
+					value, err := strconv.ParseFloat(option, 64)
+					panicIf(err)
+					schema.Enum = append(schema.Enum, value)
+				} else {
+					schema.Enum = append(schema.Enum, option)
+				}
+			}
+		case "regexp":
+			schema.Pattern = rule.Param
+		}
+	}
+}
@@ -2,15 +2,175 @@ package api2
 
 import (
 	"fmt"
+	"regexp"
+	"sort"
 	"strings"
+	"sync"
 )
 
 type paramMapType struct{}
 
+// Syntax of path masks. Each segment of a mask is one of:
+//   - static text, e.g. "users";
+//   - parameter ":name" matching one segment;
+//   - constrained parameter ":name{regexp}" matching one segment if the
+//     whole segment matches the regexp, e.g. ":id{[0-9]+}"; instead of
+//     regexp one of the names from namedConstraints can be used, e.g.
+//     ":id{int}"; the regexp can not contain '/', '?', '#' and '%';
+//   - catch-all "*name" matching the rest of the path (possibly empty),
+//     allowed only as the last segment, e.g. "/files/*path".
+//
+// When several masks match a path, static segments are preferred over
+// constrained parameters, which are preferred over parameters, which are
+// preferred over catch-all, segment by segment from left to right.
+
+// namedConstraints are shortcuts for common regexps of parameters.
+var namedConstraints = map[string]string{
+	"int":  `-?[0-9]+`,
+	"uint": `[0-9]+`,
+	"uuid": `[0-9a-fA-F]{8}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{4}-[0-9a-fA-F]{12}`,
+}
+
+type segmentKind int
+
+const (
+	staticSegment segmentKind = iota
+	paramSegment
+	catchAllSegment
+)
+
+type segment struct {
+	kind segmentKind
+
+	// Text of static segment or name of parameter.
+	name string
+
+	// Regexp of constrained parameter, "" if not constrained.
+	pattern string
+	re      *regexp.Regexp
+}
+
+// regexps caches compiled constraints, both for server and client.
+var regexps sync.Map
+
+func compileConstraint(constraint string) (string, *regexp.Regexp, error) {
+	if strings.ContainsAny(constraint, "?#%") {
+		// They would break the URL built by Client.
+		return "", nil, fmt.Errorf("constraint %q must not contain '?', '#' and '%%'", constraint)
+	}
+	pattern := constraint
+	if named, has := namedConstraints[constraint]; has {
+		pattern = named
+	}
+	if re, has := regexps.Load(pattern); has {
+		return pattern, re.(*regexp.Regexp), nil
+	}
+	re, err := regexp.Compile("^(?:" + pattern + ")$")
+	if err != nil {
+		return "", nil, fmt.Errorf("bad constraint %q: %w", constraint, err)
+	}
+	regexps.Store(pattern, re)
+	return pattern, re, nil
+}
+
+func parseSegment(part string) (segment, error) {
+	switch {
+	case strings.HasPrefix(part, "*"):
+		name := part[1:]
+		if name == "" {
+			return segment{}, fmt.Errorf("catch-all segment %q has no name", part)
+		}
+		return segment{kind: catchAllSegment, name: name}, nil
+	case strings.HasPrefix(part, ":"):
+		name, constraint, hasConstraint := strings.Cut(part[1:], "{")
+		if name == "" {
+			return segment{}, fmt.Errorf("parameter %q has no name", part)
+		}
+		s := segment{kind: paramSegment, name: name}
+		if !hasConstraint {
+			return s, nil
+		}
+		if !strings.HasSuffix(constraint, "}") {
+			return segment{}, fmt.Errorf("constraint of parameter %q is not closed with '}'", part)
+		}
+		var err error
+		s.pattern, s.re, err = compileConstraint(strings.TrimSuffix(constraint, "}"))
+		if err != nil {
+			return segment{}, fmt.Errorf("parameter %q: %w", part, err)
+		}
+		return s, nil
+	default:
+		return segment{kind: staticSegment, name: part}, nil
+	}
+}
+
+// checkConstraints returns an error if a constraint of a parameter contains
+// '/': the mask is split by '/' before the constraints are parsed.
+func checkConstraints(mask string) error {
+	inParam := false
+	depth := 0
+	for i, c := range mask {
+		switch {
+		case depth == 0 && c == '/':
+			inParam = false
+		case depth == 0 && c == ':' && (i == 0 || mask[i-1] == '/'):
+			inParam = true
+		case inParam && c == '{':
+			depth++
+		case depth > 0 && c == '}':
+			depth--
+		case depth > 0 && c == '/':
+			return fmt.Errorf("constraint of parameter in %q must not contain '/'", mask)
+		}
+	}
+	return nil
+}
+
+// parseMask parses segments of the mask, see the syntax above.
+func parseMask(mask string) ([]segment, error) {
+	if err := checkConstraints(mask); err != nil {
+		return nil, err
+	}
+	parts := splitUrl(mask)
+	segments := make([]segment, 0, len(parts))
+	for i, part := range parts {
+		s, err := parseSegment(part)
+		if err != nil {
+			return nil, err
+		}
+		if s.kind == catchAllSegment && i != len(parts)-1 {
+			return nil, fmt.Errorf("catch-all segment %q must be the last one in %q", part, mask)
+		}
+		segments = append(segments, s)
+	}
+	return segments, nil
+}
+
+// node is a node of the trie of masks. Each edge is a segment.
+type node struct {
+	static   map[string]*node
+	params   []*paramEdge
+	catchAll int
+
+	// index of the mask ending at this node or -1.
+	index int
+}
+
+type paramEdge struct {
+	pattern string
+	re      *regexp.Regexp
+	child   *node
+}
+
+func newNode() *node {
+	return &node{catchAll: -1, index: -1}
+}
+
 type classifier struct {
-	maskPartsArray [][]string
-	paramsArray    [][]bool
-	paramsNum      []int
+	root *node
+
+	// Names of parameters of each mask in the order of segments.
+	names [][]string
 }
 
 func splitUrl(url string) []string {
@@ -25,102 +185,165 @@ func splitUrl(url string) []string {
 }
 
 func newPathClassifier(masks []string) *classifier {
-	maskPartsArray := make([][]string, 0, len(masks))
-	paramsArray := make([][]bool, 0, len(masks))
-	paramsNum := make([]int, 0, len(masks))
-	for _, mask := range masks {
-		parts := splitUrl(mask)
-		params := make([]bool, len(parts))
-		count := 0
-		for i, part := range parts {
-			if strings.HasPrefix(part, ":") {
-				parts[i] = strings.TrimPrefix(part, ":")
-				params[i] = true
-				count++
+	c := &classifier{
+		root:  newNode(),
+		names: make([][]string, 0, len(masks)),
+	}
+	for index, mask := range masks {
+		segments, err := parseMask(mask)
+		if err != nil {
+			panic(fmt.Sprintf("bad path %q: %v", mask, err))
+		}
+		var names []string
+		n := c.root
+		for _, s := range segments {
+			switch s.kind {
+			case staticSegment:
+				if n.static == nil {
+					n.static = make(map[string]*node)
+				}
+				child, has := n.static[s.name]
+				if !has {
+					child = newNode()
+					n.static[s.name] = child
+				}
+				n = child
+			case paramSegment:
+				names = append(names, s.name)
+				n = n.paramChild(s)
+			case catchAllSegment:
+				names = append(names, s.name)
+				if n.catchAll == -1 {
+					n.catchAll = index
+				}
+				n = nil
 			}
 		}
-		maskPartsArray = append(maskPartsArray, parts)
-		paramsArray = append(paramsArray, params)
-		paramsNum = append(paramsNum, count)
+		if n != nil && n.index == -1 {
+			n.index = index
+		}
+		c.names = append(c.names, names)
 	}
-	return &classifier{
-		maskPartsArray: maskPartsArray,
-		paramsArray:    paramsArray,
-		paramsNum:      paramsNum,
+	return c
+}
+
+// paramChild returns the child of the node by the parameter edge, creating
+// it if needed. Constrained parameters are tried before plain ones.
+func (n *node) paramChild(s segment) *node {
+	for _, e := range n.params {
+		if e.pattern == s.pattern {
+			return e.child
+		}
 	}
+	e := &paramEdge{pattern: s.pattern, re: s.re, child: newNode()}
+	n.params = append(n.params, e)
+	sort.SliceStable(n.params, func(i, j int) bool {
+		return n.params[i].re != nil && n.params[j].re == nil
+	})
+	return e.child
 }
 
-func match(pathParts, maskParts []string, params []bool, count int) (bool, map[string]string) {
-	if len(pathParts) != len(maskParts) {
-		return false, nil
+// match finds the mask matching the parts of path and appends the values
+// of parameters to values.
+func (n *node) match(parts, values []string) (int, []string) {
+	if len(parts) == 0 {
+		if n.index != -1 {
+			return n.index, values
+		}
+		if n.catchAll != -1 {
+			return n.catchAll, append(values, "")
+		}
+		return -1, nil
 	}
-	// Check if all static parts match.
-	for i := 0; i < len(pathParts); i++ {
-		if !params[i] && pathParts[i] != maskParts[i] {
-			return false, nil
+	part := parts[0]
+	if child, has := n.static[part]; has {
+		if index, values := child.match(parts[1:], values); index != -1 {
+			return index, values
 		}
 	}
-	// Fill values of the parameters.
-	param2value := make(map[string]string, count)
-	for i := 0; i < len(pathParts); i++ {
-		if !params[i] {
+	for _, e := range n.params {
+		if e.re != nil && !e.re.MatchString(part) {
 			continue
 		}
-		key := maskParts[i]
-		value := pathParts[i]
-		param2value[key] = value
+		if index, values := e.child.match(parts[1:], append(values, part)); index != -1 {
+			return index, values
+		}
+	}
+	if n.catchAll != -1 {
+		return n.catchAll, append(values, strings.Join(parts, "/"))
 	}
-	return true, param2value
+	return -1, nil
 }
 
 // Classify returns index of matching mask (-1 if not found) and parameters map.
 func (c *classifier) Classify(path string) (index int, param2value map[string]string) {
-	pathParts := splitUrl(path)
-	for i, maskParts := range c.maskPartsArray {
-		ok, param2value := match(pathParts, maskParts, c.paramsArray[i], c.paramsNum[i])
-		if ok {
-			return i, param2value
-		}
+	index, values := c.root.match(splitUrl(path), nil)
+	if index == -1 {
+		return -1, nil
 	}
-	return -1, nil
+	names := c.names[index]
+	param2value = make(map[string]string, len(names))
+	for i, name := range names {
+		param2value[name] = values[i]
+	}
+	return index, param2value
+}
+
+// isParamPart returns if the segment of mask is a parameter or catch-all.
+func isParamPart(part string) bool {
+	return strings.HasPrefix(part, ":") || strings.HasPrefix(part, "*")
+}
+
+// paramName returns the name of parameter or catch-all segment.
+func paramName(part string) string {
+	name, _, _ := strings.Cut(part[1:], "{")
+	return name
 }
 
 func findUrlKeys(mask string) []string {
 	parts := strings.Split(mask, "/")
 	result := make([]string, 0, len(parts))
 	for _, part := range parts {
-		if strings.HasPrefix(part, ":") {
-			result = append(result, strings.TrimPrefix(part, ":"))
+		if isParamPart(part) {
+			result = append(result, paramName(part))
 		}
 	}
 	return result
 }
 
 func cutUrlParams(mask string) string {
-	before, _, _ := strings.Cut(mask, "/:")
-	if before == mask {
-		return mask
-	}
-	if !strings.HasSuffix(before, "/") {
-		before += "/"
+	parts := strings.Split(mask, "/")
+	for i, part := range parts {
+		if isParamPart(part) {
+			return strings.Join(parts[:i], "/") + "/"
+		}
 	}
-	return before
+	return mask
 }
 
 func buildUrl(mask string, param2value map[string]string) (string, error) {
 	urlParts := strings.Split(mask, "/")
 	replaced := make(map[string]struct{}, len(param2value))
 	for i, part := range urlParts {
-		if !strings.HasPrefix(part, ":") {
+		if !isParamPart(part) {
 			continue
 		}
-		part = strings.TrimPrefix(part, ":")
-		value, has := param2value[part]
+		s, err := parseSegment(part)
+		if err != nil {
+			return "", err
+		}
+		value, has := param2value[s.name]
 		if !has {
-			return "", fmt.Errorf("unknown parameter: %s", part)
+			return "", fmt.Errorf("unknown parameter: %s", s.name)
+		}
+		if s.re != nil && !s.re.MatchString(value) {
+			return "", fmt.Errorf("value %q of parameter %s does not match %q", value, s.name, s.pattern)
+		}
+		if s.kind == catchAllSegment {
+			value = strings.TrimPrefix(value, "/")
 		}
 		urlParts[i] = value
-		replaced[part] = struct{}{}
+		replaced[s.name] = struct{}{}
 	}
 	if len(replaced) != len(param2value) {
 		return "", fmt.Errorf("not all parameters were built into URL: want %d, got %d", len(param2value), len(replaced))
@@ -202,6 +202,10 @@ func TestFindUrlKeys(t *testing.T) {
 			mask: "/bar/:foo/zoo/:baz",
 			want: []string{"foo", "baz"},
 		},
+		{
+			mask: "/bar/:foo{[0-9]{2,3}}/*rest",
+			want: []string{"foo", "rest"},
+		},
 	}
 	for _, tc := range cases {
 		tc := tc
@@ -245,6 +249,14 @@ func TestCutUrlParams(t *testing.T) {
 			mask: "/bar/:foo/zoo/:baz",
 			want: "/bar/",
 		},
+		{
+			mask: "/bar/:foo{int}",
+			want: "/bar/",
+		},
+		{
+			mask: "/files/*path",
+			want: "/files/",
+		},
 	}
 	for _, tc := range cases {
 		tc := tc
@@ -304,6 +316,30 @@ func TestBuildUrl(t *testing.T) {
 			},
 			wantError: true,
 		},
+		{
+			name: "constrained parameter",
+			mask: "/path/:id{[0-9]+}",
+			param2value: map[string]string{
+				"id": "123",
+			},
+			want: "/path/123",
+		},
+		{
+			name: "constraint mismatch",
+			mask: "/path/:id{[0-9]+}",
+			param2value: map[string]string{
+				"id": "abc",
+			},
+			wantError: true,
+		},
+		{
+			name: "catch-all",
+			mask: "/files/*path",
+			param2value: map[string]string{
+				"path": "/a/b.txt",
+			},
+			want: "/files/a/b.txt",
+		},
 	}
 	for _, tc := range cases {
 		tc := tc
@@ -318,3 +354,105 @@ func TestBuildUrl(t *testing.T) {
 		})
 	}
 }
+
+func TestClassifierPriority(t *testing.T) {
+	cl := newPathClassifier([]string{
+		"/files/*path",
+		"/files/:name",
+		"/files/:id{uint}",
+		"/files/readme",
+		"/files/:name/raw",
+		"/files/:id{uint}/meta",
+		"/uuid/:id{uuid}",
+	})
+
+	cases := []struct {
+		url             string
+		wantIndex       int
+		wantParam2value map[string]string
+	}{
+		{
+			url:             "/files/readme",
+			wantIndex:       3,
+			wantParam2value: map[string]string{},
+		},
+		{
+			url:             "/files/123",
+			wantIndex:       2,
+			wantParam2value: map[string]string{"id": "123"},
+		},
+		{
+			url:             "/files/abc",
+			wantIndex:       1,
+			wantParam2value: map[string]string{"name": "abc"},
+		},
+		{
+			url:             "/files/123/meta",
+			wantIndex:       5,
+			wantParam2value: map[string]string{"id": "123"},
+		},
+		{
+			// Backtracking from the constrained parameter.
+			url:             "/files/123/raw",
+			wantIndex:       4,
+			wantParam2value: map[string]string{"name": "123"},
+		},
+		{
+			url:             "/files/abc/meta",
+			wantIndex:       0,
+			wantParam2value: map[string]string{"path": "abc/meta"},
+		},
+		{
+			url:             "/files/a/b/c/",
+			wantIndex:       0,
+			wantParam2value: map[string]string{"path": "a/b/c"},
+		},
+		{
+			url:             "/files",
+			wantIndex:       0,
+			wantParam2value: map[string]string{"path": ""},
+		},
+		{
+			url:             "/uuid/0b5c4b2e-8c5e-4f0a-9b3a-2f1d7c6e5a40",
+			wantIndex:       6,
+			wantParam2value: map[string]string{"id": "0b5c4b2e-8c5e-4f0a-9b3a-2f1d7c6e5a40"},
+		},
+		{
+			url:       "/uuid/123",
+			wantIndex: -1,
+		},
+	}
+	for _, tc := range cases {
+		tc := tc
+		t.Run(tc.url, func(t *testing.T) {
+			gotIndex, gotParam2value := cl.Classify(tc.url)
+			require.Equal(t, tc.wantIndex, gotIndex)
+			require.Equal(t, tc.wantParam2value, gotParam2value)
+		})
+	}
+}
+
+func TestParseMask(t *testing.T) {
+	segments, err := parseMask("/users/:id{[a-z]{2}}/*rest")
+	require.NoError(t, err)
+	require.Len(t, segments, 3)
+	require.Equal(t, "users", segments[0].name)
+	require.Equal(t, "id", segments[1].name)
+	require.Equal(t, "[a-z]{2}", segments[1].pattern)
+	require.Equal(t, "rest", segments[2].name)
+
+	for _, mask := range []string{
+		"/files/*path/raw",
+		"/files/*",
+		"/users/:",
+		"/users/:id{[0-9]+",
+		"/users/:id{[0-9}",
+		"/users/:id{[0-9]?}",
+	} {
+		_, err := parseMask(mask)
+		require.Error(t, err, mask)
+	}
+
+	_, err = parseMask("/users/:id{[a-z/]+}/posts")
+	require.EqualError(t, err, `constraint of parameter in "/users/:id{[a-z/]+}/posts" must not contain '/'`)
+}
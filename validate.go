@@ -0,0 +1,350 @@
+package api2
+
+import (
+	"fmt"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"unicode/utf8"
+
+	"github.com/starius/api2/typegen"
+)
+
+// FieldViolation describes a field of a request which does not satisfy
+// a rule from its `validate:"..."` tag.
+type FieldViolation struct {
+	// Field is the name of the field on the wire (JSON key, query key,
+	// header name, etc). Fields of nested structs are joined with ".".
+	Field string `json:"field"`
+
+	// Rule is the failed rule as written in the tag, e.g. "min=1".
+	Rule string `json:"rule"`
+
+	Message string `json:"message"`
+}
+
+// ValidationError is returned if a request does not satisfy the rules
+// from `validate:"..."` tags. JsonTransport sends it to the client with
+// HTTP status 400 and the list of violations in "detail" field.
+type ValidationError struct {
+	Violations []FieldViolation `json:"violations"`
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, 0, len(e.Violations))
+	for _, v := range e.Violations {
+		parts = append(parts, fmt.Sprintf("%s: %s", v.Field, v.Message))
+	}
+	return "validation failed: " + strings.Join(parts, "; ")
+}
+
+func (e *ValidationError) HttpCode() int {
+	return http.StatusBadRequest
+}
+
+// Validate checks that the struct pointed to by objPtr satisfies
+// the rules in `validate:"..."` tags of its fields. It returns
+// *ValidationError listing all the violations or nil.
+//
+// Supported rules:
+//   - required: the value must not be zero (nil for pointers, empty for
+//     strings, slices and maps);
+//   - min=N, max=N: bounds of a number or of the length of a string,
+//     a slice or a map;
+//   - len=N: exact length of a string, a slice or a map (or exact value
+//     of a number);
+//   - oneof=a b c: the value must be one of space separated values;
+//   - regexp=RE: a string must match the regular expression. The rule
+//     must be the last in the tag, since RE may contain commas.
+//
+// Rules are separated by commas: `validate:"required,min=1,max=10"`.
+// Nil pointers are not checked by rules other than "required".
+// Nested structs and slices of structs are validated recursively.
+func Validate(objPtr interface{}) error {
+	v := getValidator(reflect.TypeOf(objPtr).Elem())
+	return v.validate(objPtr)
+}
+
+type ruleChecker func(value reflect.Value) (message string)
+
+type fieldValidator struct {
+	index  int
+	name   string
+	rules  []typegen.ValidateRule
+	checks []ruleChecker
+
+	// Set if the field is a struct, a pointer to a struct or a slice of
+	// them containing rules.
+	nested *structValidator
+}
+
+type structValidator struct {
+	fields []fieldValidator
+}
+
+var (
+	validatorsMu sync.Mutex
+	validators   = make(map[reflect.Type]*structValidator)
+)
+
+// getValidator returns validator of struct type. It returns nil if the type
+// has no rules. It panics if rules are not applicable to field types.
+func getValidator(structType reflect.Type) *structValidator {
+	validatorsMu.Lock()
+	defer validatorsMu.Unlock()
+
+	if v, has := validators[structType]; has {
+		return v
+	}
+	// Validators are cached only if all of them are built: bad tags must
+	// panic every time.
+	built := make(map[reflect.Type]*structValidator)
+	v := buildValidator(structType, built)
+	for t, tv := range built {
+		validators[t] = tv
+	}
+	return v
+}
+
+// buildValidator builds validator of struct type and of nested types
+// which are not in cache, adding them to built.
+func buildValidator(structType reflect.Type, built map[reflect.Type]*structValidator) *structValidator {
+	if v, has := validators[structType]; has {
+		return v
+	}
+	if v, has := built[structType]; has {
+		return v
+	}
+	// Put a placeholder to handle recursive types.
+	v := &structValidator{}
+	built[structType] = v
+
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+		if field.PkgPath != "" {
+			// The field is unexported.
+			continue
+		}
+		rules, err := typegen.ParseValidateTag(field.Tag.Get("validate"))
+		if err != nil {
+			panic(fmt.Sprintf("field %s of struct %s: bad validate tag: %v", field.Name, structType.Name(), err))
+		}
+		fv := fieldValidator{
+			index: i,
+			name:  wireName(field),
+			rules: rules,
+		}
+		for _, rule := range rules {
+			check, err := compileRule(rule, field.Type)
+			if err != nil {
+				panic(fmt.Sprintf("field %s of struct %s: %v", field.Name, structType.Name(), err))
+			}
+			fv.checks = append(fv.checks, check)
+		}
+		if elemType := nestedStructType(field.Type); elemType != nil {
+			fv.nested = buildValidator(elemType, built)
+		}
+		if len(fv.checks) != 0 || fv.nested != nil {
+			v.fields = append(v.fields, fv)
+		}
+	}
+
+	if len(v.fields) == 0 {
+		// Nested validators referring to the type have already got
+		// the placeholder, which is a no-op validator.
+		built[structType] = nil
+		return nil
+	}
+	return v
+}
+
+func wireName(field reflect.StructField) string {
+	for _, tag := range []string{"json", "query", "header", "cookie", "url"} {
+		name, _, _ := strings.Cut(field.Tag.Get(tag), ",")
+		if name != "" && name != "-" {
+			return name
+		}
+	}
+	return field.Name
+}
+
+func nestedStructType(t reflect.Type) reflect.Type {
+	for t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice || t.Kind() == reflect.Array {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct {
+		return nil
+	}
+	return t
+}
+
+func isNumberKind(k reflect.Kind) bool {
+	switch k {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	default:
+		return false
+	}
+}
+
+func numberValue(v reflect.Value) float64 {
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return float64(v.Uint())
+	default:
+		return v.Float()
+	}
+}
+
+func lengthValue(v reflect.Value) int {
+	if v.Kind() == reflect.String {
+		return utf8.RuneCountInString(v.String())
+	}
+	return v.Len()
+}
+
+func compileRule(rule typegen.ValidateRule, fieldType reflect.Type) (ruleChecker, error) {
+	if rule.Name == "required" {
+		return func(value reflect.Value) string {
+			if value.IsZero() || (value.Kind() == reflect.Slice || value.Kind() == reflect.Map) && value.Len() == 0 {
+				return "is required"
+			}
+			return ""
+		}, nil
+	}
+
+	t := fieldType
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	k := t.Kind()
+	hasLength := k == reflect.String || k == reflect.Slice || k == reflect.Array || k == reflect.Map
+
+	var check ruleChecker
+	switch rule.Name {
+	case "min", "max", "len":
+		bound, err := strconv.ParseFloat(rule.Param, 64)
+		if err != nil {
+			return nil, fmt.Errorf("bad parameter of rule %s: %w", rule, err)
+		}
+		if !isNumberKind(k) && !hasLength {
+			return nil, fmt.Errorf("rule %s is not applicable to type %s", rule, fieldType)
+		}
+		check = func(value reflect.Value) string {
+			x, what := 0.0, "value"
+			if hasLength {
+				x, what = float64(lengthValue(value)), "length"
+			} else {
+				x = numberValue(value)
+			}
+			switch {
+			case rule.Name == "min" && x < bound:
+				return fmt.Sprintf("%s must be at least %s", what, rule.Param)
+			case rule.Name == "max" && x > bound:
+				return fmt.Sprintf("%s must be at most %s", what, rule.Param)
+			case rule.Name == "len" && x != bound:
+				return fmt.Sprintf("%s must be exactly %s", what, rule.Param)
+			}
+			return ""
+		}
+	case "oneof":
+		if !isNumberKind(k) && k != reflect.String {
+			return nil, fmt.Errorf("rule %s is not applicable to type %s", rule, fieldType)
+		}
+		options := strings.Fields(rule.Param)
+		check = func(value reflect.Value) string {
+			str := fmt.Sprintf("%v", value.Interface())
+			if value.Kind() == reflect.String {
+				str = value.String()
+			}
+			for _, option := range options {
+				if str == option {
+					return ""
+				}
+			}
+			return fmt.Sprintf("must be one of [%s]", rule.Param)
+		}
+	case "regexp":
+		if k != reflect.String {
+			return nil, fmt.Errorf("rule %s is not applicable to type %s", rule, fieldType)
+		}
+		re, err := regexp.Compile(rule.Param)
+		if err != nil {
+			return nil, fmt.Errorf("bad regexp in rule %s: %w", rule, err)
+		}
+		check = func(value reflect.Value) string {
+			if !re.MatchString(value.String()) {
+				return fmt.Sprintf("must match regexp %s", rule.Param)
+			}
+			return ""
+		}
+	default:
+		return nil, fmt.Errorf("unknown rule %s", rule)
+	}
+
+	return func(value reflect.Value) string {
+		for value.Kind() == reflect.Ptr {
+			if value.IsNil() {
+				return ""
+			}
+			value = value.Elem()
+		}
+		return check(value)
+	}, nil
+}
+
+func (v *structValidator) validate(objPtr interface{}) error {
+	if v == nil {
+		return nil
+	}
+	var violations []FieldViolation
+	v.collect(reflect.ValueOf(objPtr).Elem(), "", &violations)
+	if len(violations) == 0 {
+		return nil
+	}
+	return &ValidationError{Violations: violations}
+}
+
+func (v *structValidator) collect(structValue reflect.Value, prefix string, violations *[]FieldViolation) {
+	if v == nil {
+		return
+	}
+	for _, f := range v.fields {
+		value := structValue.Field(f.index)
+		name := prefix + f.name
+		for i, check := range f.checks {
+			if message := check(value); message != "" {
+				*violations = append(*violations, FieldViolation{
+					Field:   name,
+					Rule:    f.rules[i].String(),
+					Message: message,
+				})
+			}
+		}
+		if f.nested != nil {
+			f.nested.collectNested(value, name, violations)
+		}
+	}
+}
+
+func (v *structValidator) collectNested(value reflect.Value, name string, violations *[]FieldViolation) {
+	switch value.Kind() {
+	case reflect.Ptr:
+		if !value.IsNil() {
+			v.collectNested(value.Elem(), name, violations)
+		}
+	case reflect.Slice, reflect.Array:
+		for i := 0; i < value.Len(); i++ {
+			v.collectNested(value.Index(i), fmt.Sprintf("%s[%d]", name, i), violations)
+		}
+	case reflect.Struct:
+		v.collect(value, name+".", violations)
+	}
+}
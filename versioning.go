@@ -0,0 +1,97 @@
+package api2
+
+import (
+	"fmt"
+	"mime"
+	"net/http"
+	"path/filepath"
+	"strings"
+)
+
+// VersionHeader is the HTTP header in which the client sends the version
+// of the API it uses (see Route.Version), e.g. "v2". The server also
+// accepts parameter "version" of the media type in Accept header, e.g.
+// "application/json; version=v2".
+const VersionHeader = "X-Api2-Version"
+
+// PinVersion makes the client use routes of the version: routes of other
+// versions are ignored and the version is sent in VersionHeader.
+// Affects only clients.
+func PinVersion(version string) Option {
+	return func(config *Config) {
+		config.version = version
+	}
+}
+
+// requestVersion returns the version of the API requested by the client
+// or "" if not specified.
+func requestVersion(r *http.Request) string {
+	if version := r.Header.Get(VersionHeader); version != "" {
+		return version
+	}
+	for _, accept := range r.Header.Values("Accept") {
+		for _, part := range strings.Split(accept, ",") {
+			_, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+			if err != nil {
+				continue
+			}
+			if version := params["version"]; version != "" {
+				return version
+			}
+		}
+	}
+	return ""
+}
+
+// routeVersions returns distinct versions of the routes in the order of
+// first appearance. Unversioned routes are not counted.
+func routeVersions(routes []Route) []string {
+	var versions []string
+	seen := make(map[string]bool)
+	for _, route := range routes {
+		if route.Version != "" && !seen[route.Version] {
+			seen[route.Version] = true
+			versions = append(versions, route.Version)
+		}
+	}
+	return versions
+}
+
+// versionRoutes returns the routes available in the version: routes of the
+// version and unversioned routes not replaced by routes of the version.
+func versionRoutes(routes []Route, version string) []Route {
+	type routeKey struct {
+		method string
+		shape  string
+	}
+	replaced := make(map[routeKey]bool)
+	for _, route := range routes {
+		if route.Version != version {
+			continue
+		}
+		if shape, err := pathShape(route.Path); err == nil {
+			replaced[routeKey{method: route.Method, shape: shape}] = true
+		}
+	}
+	var result []Route
+	for _, route := range routes {
+		if route.Version == "" {
+			shape, err := pathShape(route.Path)
+			if err == nil && replaced[routeKey{method: route.Method, shape: shape}] {
+				continue
+			}
+		} else if route.Version != version {
+			continue
+		}
+		result = append(result, route)
+	}
+	return result
+}
+
+// versionDir returns the directory of generated files of the version.
+func versionDir(outDir, version string) string {
+	if version == "." || version == ".." || strings.ContainsAny(version, `/\`) {
+		panic(fmt.Sprintf("version %q can not be used as a directory name", version))
+	}
+	return filepath.Join(outDir, version)
+}
@@ -0,0 +1,70 @@
+package api2
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestRequestVersion(t *testing.T) {
+	cases := []struct {
+		header, accept string
+		want           string
+	}{
+		{"", "", ""},
+		{"v2", "", "v2"},
+		{"v2", "application/json; version=v3", "v2"},
+		{"", "application/json; version=v3", "v3"},
+		{"", "text/csv;q=0.5, application/json; version=v3", "v3"},
+		{"", "application/json", ""},
+		{"", "garbage;;", ""},
+	}
+	for _, tc := range cases {
+		r := httptest.NewRequest(http.MethodGet, "/", nil)
+		if tc.header != "" {
+			r.Header.Set(VersionHeader, tc.header)
+		}
+		if tc.accept != "" {
+			r.Header.Set("Accept", tc.accept)
+		}
+		require.Equal(t, tc.want, requestVersion(r), tc)
+	}
+}
+
+func TestVersionRoutes(t *testing.T) {
+	routes := []Route{
+		{Method: http.MethodGet, Path: "/users/:id"},
+		{Method: http.MethodPost, Path: "/users"},
+		{Method: http.MethodGet, Path: "/users/:id", Version: "v1"},
+		{Method: http.MethodGet, Path: "/users/:uid/", Version: "v2"},
+		{Method: http.MethodPost, Path: "/v2/users", Version: "v2"},
+	}
+	require.Equal(t, []string{"v1", "v2"}, routeVersions(routes))
+
+	paths := func(routes []Route) []string {
+		var result []string
+		for _, route := range routes {
+			result = append(result, route.Method+" "+route.Path)
+		}
+		return result
+	}
+	require.Equal(t, []string{
+		"POST /users",
+		"GET /users/:id",
+	}, paths(versionRoutes(routes, "v1")))
+	require.Equal(t, []string{
+		"POST /users",
+		"GET /users/:uid/",
+		"POST /v2/users",
+	}, paths(versionRoutes(routes, "v2")))
+	require.Equal(t, []string{
+		"GET /users/:id",
+		"POST /users",
+	}, paths(versionRoutes(routes, "v3")))
+
+	require.PanicsWithValue(t, `version "../v1" can not be used as a directory name`, func() {
+		versionDir("out", "../v1")
+	})
+}
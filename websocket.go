@@ -0,0 +1,719 @@
+package api2
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+)
+
+// The WebSocket protocol is described in RFC 6455.
+
+const websocketGUID = "258EAFA5-E914-47DA-95CA-C5AB0DC85B11"
+
+// Opcodes of frames.
+const (
+	wsOpContinuation = 0x0
+	wsOpText         = 0x1
+	wsOpBinary       = 0x2
+	wsOpClose        = 0x8
+	wsOpPing         = 0x9
+	wsOpPong         = 0xA
+)
+
+// Close codes.
+const (
+	wsCloseNormal        = 1000
+	wsCloseGoingAway     = 1001
+	wsCloseProtocolError = 1002
+	wsCloseNoStatus      = 1005
+	wsCloseInvalidData   = 1007
+	wsCloseTooBig        = 1009
+	wsCloseInternalError = 1011
+
+	// Errors of handlers are sent with close code wsCloseHttpBase plus
+	// HTTP status of the error, e.g. 4404 for errors.NotFound.
+	wsCloseHttpBase = 4000
+)
+
+// wsCloseTimeout is how long the closing side waits for the close frame
+// of the peer before closing the connection.
+const wsCloseTimeout = 5 * time.Second
+
+// wsWriteTimeout is how long the server waits for a frame to be written
+// before giving up on a stalled client.
+var wsWriteTimeout = 10 * time.Second
+
+// Control frames (close, ping, pong) have payload of at most 125 bytes.
+const wsMaxControlPayload = 125
+
+// wsCloseError is received in close frame.
+type wsCloseError struct {
+	Code   int
+	Reason string
+}
+
+func (e *wsCloseError) Error() string {
+	return fmt.Sprintf("websocket closed with code %d: %s", e.Code, e.Reason)
+}
+
+var errWsClosed = errors.New("websocket: close frame was already sent")
+
+// wsConn reads and writes WebSocket messages.
+type wsConn struct {
+	r      *bufio.Reader
+	w      io.Writer
+	closer io.Closer
+
+	// setWriteDeadline (optional) is called before writing each frame.
+	setWriteDeadline func(t time.Time) error
+
+	// Client masks frames it sends, server requires masked frames.
+	client     bool
+	maxMessage int64
+
+	writeMu   sync.Mutex
+	closeSent bool
+}
+
+func (c *wsConn) writeFrame(op byte, payload []byte) error {
+	c.writeMu.Lock()
+	defer c.writeMu.Unlock()
+	if c.closeSent {
+		return errWsClosed
+	}
+	if op == wsOpClose {
+		c.closeSent = true
+	}
+
+	frame := make([]byte, 0, 14+len(payload))
+	frame = append(frame, 0x80|op)
+	var maskBit byte
+	if c.client {
+		maskBit = 0x80
+	}
+	switch n := len(payload); {
+	case n < 126:
+		frame = append(frame, maskBit|byte(n))
+	case n <= 0xFFFF:
+		frame = append(frame, maskBit|126)
+		frame = binary.BigEndian.AppendUint16(frame, uint16(n))
+	default:
+		frame = append(frame, maskBit|127)
+		frame = binary.BigEndian.AppendUint64(frame, uint64(n))
+	}
+	if c.client {
+		var key [4]byte
+		if _, err := rand.Read(key[:]); err != nil {
+			return err
+		}
+		frame = append(frame, key[:]...)
+		start := len(frame)
+		frame = append(frame, payload...)
+		for i := range frame[start:] {
+			frame[start+i] ^= key[i%4]
+		}
+	} else {
+		frame = append(frame, payload...)
+	}
+	if c.setWriteDeadline != nil {
+		timeout := wsWriteTimeout
+		if op == wsOpClose {
+			timeout = wsCloseTimeout
+		}
+		if err := c.setWriteDeadline(time.Now().Add(timeout)); err != nil {
+			return err
+		}
+	}
+	_, err := c.w.Write(frame)
+	return err
+}
+
+func (c *wsConn) readFrame() (fin bool, op byte, payload []byte, err error) {
+	var header [2]byte
+	if _, err := io.ReadFull(c.r, header[:]); err != nil {
+		return false, 0, nil, err
+	}
+	fin = header[0]&0x80 != 0
+	op = header[0] & 0x0F
+	if header[0]&0x70 != 0 {
+		return false, 0, nil, &wsCloseError{Code: wsCloseProtocolError, Reason: "reserved bits are set"}
+	}
+	masked := header[1]&0x80 != 0
+	if masked == c.client {
+		return false, 0, nil, &wsCloseError{Code: wsCloseProtocolError, Reason: "wrong masking of frame"}
+	}
+	n := uint64(header[1] & 0x7F)
+	switch n {
+	case 126:
+		var ext [2]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = uint64(binary.BigEndian.Uint16(ext[:]))
+	case 127:
+		var ext [8]byte
+		if _, err := io.ReadFull(c.r, ext[:]); err != nil {
+			return false, 0, nil, err
+		}
+		n = binary.BigEndian.Uint64(ext[:])
+	}
+	if op >= wsOpClose && (n > wsMaxControlPayload || !fin) {
+		return false, 0, nil, &wsCloseError{Code: wsCloseProtocolError, Reason: "invalid control frame"}
+	}
+	if n > uint64(c.maxMessage) {
+		return false, 0, nil, &wsCloseError{Code: wsCloseTooBig, Reason: "message is too big"}
+	}
+	var key [4]byte
+	if masked {
+		if _, err := io.ReadFull(c.r, key[:]); err != nil {
+			return false, 0, nil, err
+		}
+	}
+	payload = make([]byte, n)
+	if _, err := io.ReadFull(c.r, payload); err != nil {
+		return false, 0, nil, err
+	}
+	if masked {
+		for i := range payload {
+			payload[i] ^= key[i%4]
+		}
+	}
+	return fin, op, payload, nil
+}
+
+// readMessage reads the next data message answering pings and close
+// frames. If the peer closes the connection, it returns *wsCloseError.
+func (c *wsConn) readMessage() ([]byte, error) {
+	var message []byte
+	inMessage := false
+	for {
+		fin, op, payload, err := c.readFrame()
+		if err != nil {
+			var closeErr *wsCloseError
+			if errors.As(err, &closeErr) {
+				// Protocol violation by the peer.
+				_ = c.writeClose(closeErr.Code, closeErr.Reason)
+			}
+			return nil, err
+		}
+		switch op {
+		case wsOpPing:
+			if err := c.writeFrame(wsOpPong, payload); err != nil && err != errWsClosed {
+				return nil, err
+			}
+		case wsOpPong:
+		case wsOpClose:
+			closeErr := &wsCloseError{Code: wsCloseNoStatus}
+			if len(payload) >= 2 {
+				closeErr.Code = int(binary.BigEndian.Uint16(payload))
+				closeErr.Reason = string(payload[2:])
+			}
+			// Answer the close frame unless we closed first.
+			replyCode := closeErr.Code
+			if replyCode == wsCloseNoStatus {
+				replyCode = wsCloseNormal
+			}
+			_ = c.writeClose(replyCode, "")
+			return nil, closeErr
+		case wsOpText, wsOpBinary:
+			if inMessage {
+				return nil, c.protocolError("new message inside fragmented message")
+			}
+			message, inMessage = payload, true
+		case wsOpContinuation:
+			if !inMessage {
+				return nil, c.protocolError("unexpected continuation frame")
+			}
+			if int64(len(message)+len(payload)) > c.maxMessage {
+				_ = c.writeClose(wsCloseTooBig, "message is too big")
+				return nil, &wsCloseError{Code: wsCloseTooBig, Reason: "message is too big"}
+			}
+			message = append(message, payload...)
+		default:
+			return nil, c.protocolError(fmt.Sprintf("unknown opcode %d", op))
+		}
+		if inMessage && fin {
+			return message, nil
+		}
+	}
+}
+
+func (c *wsConn) protocolError(reason string) error {
+	_ = c.writeClose(wsCloseProtocolError, reason)
+	return &wsCloseError{Code: wsCloseProtocolError, Reason: reason}
+}
+
+func (c *wsConn) writeClose(code int, reason string) error {
+	if len(reason) > wsMaxControlPayload-2 {
+		// Cut on a rune boundary: the reason must be valid UTF-8.
+		cut := wsMaxControlPayload - 2
+		for cut > 0 && !utf8.RuneStart(reason[cut]) {
+			cut--
+		}
+		reason = reason[:cut]
+	}
+	payload := binary.BigEndian.AppendUint16(nil, uint16(code))
+	payload = append(payload, reason...)
+	return c.writeFrame(wsOpClose, payload)
+}
+
+func (c *wsConn) writeMessage(v interface{}) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("failed to marshal websocket message: %w", err)
+	}
+	return c.writeFrame(wsOpText, data)
+}
+
+// wsAccept returns the value of header Sec-WebSocket-Accept.
+func wsAccept(key string) string {
+	h := sha1.New()
+	h.Write([]byte(key + websocketGUID))
+	return base64.StdEncoding.EncodeToString(h.Sum(nil))
+}
+
+func headerContainsToken(header http.Header, name, token string) bool {
+	for _, value := range header.Values(name) {
+		for _, t := range strings.Split(value, ",") {
+			if strings.EqualFold(strings.TrimSpace(t), token) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// wsChannels returns fields with tags ws:"in" and ws:"out" of the request.
+func wsChannels(req interface{}) (in, out reflect.Value) {
+	objType := reflect.TypeOf(req).Elem()
+	p0, has := prepared.Load(objType)
+	if !has {
+		p0 = prepare(objType)
+		prepared.Store(objType, p0)
+	}
+	p := p0.(*preparedType)
+	objValue := reflect.ValueOf(req).Elem()
+	if p.WsInField != noField {
+		in = objValue.Field(p.WsInField)
+	}
+	if p.WsOutField != noField {
+		out = objValue.Field(p.WsOutField)
+	}
+	return in, out
+}
+
+// readMessages reads messages from conn and sends them to channel ch
+// (if it is valid) until the connection is closed or ctx is canceled.
+func readMessages(ctx context.Context, conn *wsConn, ch reflect.Value, elemType reflect.Type) error {
+	for {
+		data, err := conn.readMessage()
+		if err != nil {
+			return err
+		}
+		if !ch.IsValid() || ch.IsNil() {
+			continue
+		}
+		message := reflect.New(elemType)
+		if err := json.Unmarshal(data, message.Interface()); err != nil {
+			err = fmt.Errorf("failed to unmarshal websocket message: %w", err)
+			_ = conn.writeClose(wsCloseInvalidData, err.Error())
+			return err
+		}
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+			{Dir: reflect.SelectSend, Chan: ch, Send: message.Elem()},
+		}
+		if chosen, _, _ := reflect.Select(cases); chosen == 0 {
+			return ctx.Err()
+		}
+	}
+}
+
+type wsSessionType struct{}
+
+// wsSession is the server side of WebSocket connection.
+type wsSession struct {
+	conn   *wsConn
+	cancel context.CancelFunc
+
+	stop       chan struct{}
+	writerDone chan struct{}
+	readerDone chan struct{}
+
+	finished bool
+}
+
+// finish stops goroutines of the session and closes the connection.
+func (s *wsSession) finish(code int, reason string) error {
+	if s.finished {
+		// E.g. EncodeResponse panicked.
+		return nil
+	}
+	s.finished = true
+	s.cancel()
+	close(s.stop)
+	select {
+	case <-s.writerDone:
+	case <-time.After(wsCloseTimeout):
+		// The writer is stuck, unblock it.
+		_ = s.conn.closer.Close()
+		<-s.writerDone
+	}
+	err := s.conn.writeClose(code, reason)
+	if err == errWsClosed {
+		// The client closed the connection first.
+		err = nil
+	}
+	select {
+	case <-s.readerDone:
+	case <-time.After(wsCloseTimeout):
+	}
+	if err2 := s.conn.closer.Close(); err == nil {
+		err = err2
+	}
+	<-s.readerDone
+	return err
+}
+
+// WebSocketTransport serves full-duplex routes over WebSocket (RFC 6455).
+// The route must use method GET (BindRoutes panics otherwise). The request
+// has channel fields with tags ws:"in" (messages from the client) and
+// ws:"out" (messages to the client), other fields can be passed in URL,
+// query, headers and cookies:
+//
+//	type ChatRequest struct {
+//		Room string              `query:"room"`
+//		In   <-chan *ChatMessage `ws:"in"`
+//		Out  chan<- *ChatMessage `ws:"out"`
+//	}
+//
+// Messages are sent as JSON text messages.
+//
+// On the server side the connection is upgraded after the request is
+// decoded and validated. The handler reads messages from In until it is
+// closed (the client closed the connection) and sends messages to Out
+// while ctx is alive. When the handler returns, the server closes the
+// connection; the Response is not sent. If the handler returns an error,
+// it is sent in the close frame with close code 4000 plus the HTTP status
+// of the error (e.g. 4404 for errors.NotFound).
+//
+// On the client side put channels into the request: the transport sends
+// messages from In until it is closed and writes received messages to Out,
+// which is closed when the connection is closed. Client.Call returns
+// after the server closes the connection, the error returned by the
+// handler is returned by Call.
+type WebSocketTransport struct {
+	// Errors returned before the upgrade are sent as by JsonTransport.
+	// See JsonTransport.Errors.
+	Errors map[string]error
+}
+
+func (h *WebSocketTransport) jsonTransport() *JsonTransport {
+	return &JsonTransport{Errors: h.Errors}
+}
+
+func (h *WebSocketTransport) DecodeRequest(ctx context.Context, r *http.Request, req interface{}) (context.Context, error) {
+	if !headerContainsToken(r.Header, "Connection", "upgrade") || !headerContainsToken(r.Header, "Upgrade", "websocket") {
+		return ctx, httpError{
+			Code:    http.StatusUpgradeRequired,
+			Message: "websocket: the client is not using the websocket protocol",
+		}
+	}
+	if r.Header.Get("Sec-WebSocket-Version") != "13" {
+		return ctx, httpError{
+			Code:    http.StatusUpgradeRequired,
+			Message: "websocket: unsupported version, want 13",
+		}
+	}
+	if r.Header.Get("Sec-WebSocket-Key") == "" {
+		return ctx, fmt.Errorf("websocket: missing Sec-WebSocket-Key")
+	}
+
+	if err := readQueryHeaderCookie(jsonCodec, req, r.Body, r.URL.Query(), r, r.Header, 0); err != nil {
+		return ctx, err
+	}
+
+	return ctx, nil
+}
+
+// Upgrade takes over the connection after the request was decoded and
+// validated. It starts goroutines passing messages between the connection
+// and the channels of the request.
+func (h *WebSocketTransport) Upgrade(ctx context.Context, w http.ResponseWriter, r *http.Request, req interface{}) (context.Context, error) {
+	hijacker, ok := w.(http.Hijacker)
+	if !ok {
+		return ctx, fmt.Errorf("websocket: http.ResponseWriter does not implement http.Hijacker")
+	}
+	netConn, brw, err := hijacker.Hijack()
+	if err != nil {
+		return ctx, fmt.Errorf("websocket: failed to hijack the connection: %w", err)
+	}
+	response := "HTTP/1.1 101 Switching Protocols\r\n" +
+		"Upgrade: websocket\r\n" +
+		"Connection: Upgrade\r\n" +
+		"Sec-WebSocket-Accept: " + wsAccept(r.Header.Get("Sec-WebSocket-Key")) + "\r\n\r\n"
+	_ = netConn.SetWriteDeadline(time.Now().Add(wsWriteTimeout))
+	if _, err := brw.WriteString(response); err != nil {
+		netConn.Close()
+		return ctx, fmt.Errorf("websocket: failed to send handshake: %w", err)
+	}
+	if err := brw.Flush(); err != nil {
+		netConn.Close()
+		return ctx, fmt.Errorf("websocket: failed to send handshake: %w", err)
+	}
+
+	maxMessage := int64(defaultMaxBody)
+	if maxBody, ok := ctx.Value(maxBodyType{}).(int64); ok {
+		maxMessage = maxBody
+	}
+	conn := &wsConn{
+		r:                brw.Reader,
+		w:                netConn,
+		closer:           netConn,
+		setWriteDeadline: netConn.SetWriteDeadline,
+		maxMessage:       maxMessage,
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	s := &wsSession{
+		conn:       conn,
+		cancel:     cancel,
+		stop:       make(chan struct{}),
+		writerDone: make(chan struct{}),
+		readerDone: make(chan struct{}),
+	}
+
+	// The handler receives from In and sends to Out, the transport uses
+	// the bidirectional channels.
+	inField, outField := wsChannels(req)
+	var in, out reflect.Value
+	if inField.IsValid() {
+		in = reflect.MakeChan(reflect.ChanOf(reflect.BothDir, inField.Type().Elem()), 0)
+		inField.Set(in)
+	}
+	if outField.IsValid() {
+		out = reflect.MakeChan(reflect.ChanOf(reflect.BothDir, outField.Type().Elem()), 0)
+		outField.Set(out)
+	}
+
+	go func() {
+		defer close(s.readerDone)
+		var elemType reflect.Type
+		if in.IsValid() {
+			defer in.Close()
+			elemType = in.Type().Elem()
+		}
+		_ = readMessages(ctx, conn, in, elemType)
+		// The client closed the connection.
+		cancel()
+	}()
+
+	go func() {
+		defer close(s.writerDone)
+		if !out.IsValid() {
+			return
+		}
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(s.stop)},
+			{Dir: reflect.SelectRecv, Chan: out},
+		}
+		failed := false
+		for {
+			chosen, message, ok := reflect.Select(cases)
+			if chosen == 0 {
+				return
+			}
+			if !ok {
+				// The handler closed Out.
+				cases = cases[:1]
+				continue
+			}
+			if failed {
+				// Discard messages, so the handler is not blocked.
+				continue
+			}
+			if err := conn.writeMessage(message.Interface()); err != nil {
+				failed = true
+				cancel()
+			}
+		}
+	}()
+
+	return context.WithValue(ctx, wsSessionType{}, s), nil
+}
+
+func (h *WebSocketTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, res interface{}) error {
+	s, ok := ctx.Value(wsSessionType{}).(*wsSession)
+	if !ok {
+		return fmt.Errorf("websocket: the connection was not upgraded")
+	}
+	return s.finish(wsCloseNormal, "")
+}
+
+func (h *WebSocketTransport) EncodeError(ctx context.Context, w http.ResponseWriter, err error) error {
+	s, ok := ctx.Value(wsSessionType{}).(*wsSession)
+	if !ok {
+		// The error happened before the upgrade.
+		return h.jsonTransport().RawEncodeError(ctx, w, err)
+	}
+	return s.finish(wsCloseHttpBase+errorToCode(err), err.Error())
+}
+
+func (h *WebSocketTransport) errorCode(err error) string {
+	_, code := detectErrorType(err, h.Errors)
+	return code
+}
+
+type wsRequestType struct{}
+
+func (h *WebSocketTransport) EncodeRequest(ctx context.Context, method, urlStr string, req interface{}) (*http.Request, error) {
+	// Pass the request with its channels to DecodeResponse.
+	ctx = context.WithValue(ctx, wsRequestType{}, req)
+	request, err := http.NewRequestWithContext(ctx, method, urlStr, nil)
+	if err != nil {
+		return nil, err
+	}
+	query, err := url.ParseQuery(request.URL.RawQuery)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse query part of URL: %w", err)
+	}
+	if _, err := writeQueryHeaderCookie(jsonCodec, io.Discard, req, query, request, request.Header, false); err != nil {
+		return nil, err
+	}
+	request.URL.RawQuery = query.Encode()
+	request.Header.Del("Content-Type")
+	request.Header.Del("Accept")
+
+	var key [16]byte
+	if _, err := rand.Read(key[:]); err != nil {
+		return nil, err
+	}
+	request.Header.Set("Connection", "Upgrade")
+	request.Header.Set("Upgrade", "websocket")
+	request.Header.Set("Sec-WebSocket-Version", "13")
+	request.Header.Set("Sec-WebSocket-Key", base64.StdEncoding.EncodeToString(key[:]))
+
+	return request, nil
+}
+
+func (h *WebSocketTransport) DecodeResponse(ctx context.Context, res *http.Response, response interface{}) error {
+	if res.StatusCode != http.StatusSwitchingProtocols {
+		return fmt.Errorf("websocket: unexpected HTTP status %s", res.Status)
+	}
+	if res.Header.Get("Sec-WebSocket-Accept") != wsAccept(res.Request.Header.Get("Sec-WebSocket-Key")) {
+		return fmt.Errorf("websocket: wrong Sec-WebSocket-Accept")
+	}
+	rwc, ok := res.Body.(io.ReadWriteCloser)
+	if !ok {
+		return fmt.Errorf("websocket: the body of the response is not writable")
+	}
+	req := ctx.Value(wsRequestType{})
+	if req == nil {
+		return fmt.Errorf("websocket: the request is not attached to ctx")
+	}
+
+	maxMessage := int64(defaultMaxBody)
+	if maxBody, ok := ctx.Value(maxBodyType{}).(int64); ok {
+		maxMessage = maxBody
+	}
+	conn := &wsConn{
+		r:          bufio.NewReader(rwc),
+		w:          rwc,
+		closer:     rwc,
+		client:     true,
+		maxMessage: maxMessage,
+	}
+
+	in, out := wsChannels(req)
+	var elemType reflect.Type
+	if out.IsValid() {
+		elemType = out.Type().Elem()
+		if !out.IsNil() {
+			defer out.Close()
+		}
+	}
+
+	readerDone := make(chan struct{})
+	writerDone := make(chan struct{})
+	go func() {
+		defer close(writerDone)
+		cases := []reflect.SelectCase{
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(readerDone)},
+			{Dir: reflect.SelectRecv, Chan: reflect.ValueOf(ctx.Done())},
+		}
+		if in.IsValid() && !in.IsNil() {
+			cases = append(cases, reflect.SelectCase{Dir: reflect.SelectRecv, Chan: in})
+		}
+		for {
+			chosen, message, ok := reflect.Select(cases)
+			switch {
+			case chosen == 0:
+				return
+			case chosen == 1:
+				_ = conn.writeClose(wsCloseGoingAway, "")
+				select {
+				case <-readerDone:
+				case <-time.After(wsCloseTimeout):
+					// The server does not answer, unblock the reader.
+					_ = rwc.Close()
+				}
+				return
+			case !ok:
+				// The client has nothing more to send.
+				_ = conn.writeClose(wsCloseNormal, "")
+				return
+			}
+			if err := conn.writeMessage(message.Interface()); err != nil {
+				return
+			}
+		}
+	}()
+
+	err := readMessages(ctx, conn, out, elemType)
+	close(readerDone)
+	<-writerDone
+
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+	var closeErr *wsCloseError
+	if !errors.As(err, &closeErr) {
+		return fmt.Errorf("websocket: %w", err)
+	}
+	switch {
+	case closeErr.Code == wsCloseNormal || closeErr.Code == wsCloseNoStatus:
+		return nil
+	case closeErr.Code > wsCloseHttpBase && closeErr.Code < wsCloseHttpBase+600:
+		return httpError{
+			Code:    closeErr.Code - wsCloseHttpBase,
+			Message: closeErr.Reason,
+		}
+	default:
+		return closeErr
+	}
+}
+
+func (h *WebSocketTransport) DecodeError(ctx context.Context, res *http.Response) error {
+	return h.jsonTransport().DecodeError(ctx, res)
+}
+
+func (h *WebSocketTransport) DecodeResponseAndError(ctx context.Context, res *http.Response, response interface{}) error {
+	if res.StatusCode == http.StatusSwitchingProtocols {
+		return h.DecodeResponse(ctx, res, response)
+	}
+	return h.DecodeError(ctx, res)
+}
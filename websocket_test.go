@@ -0,0 +1,59 @@
+package api2
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"net"
+	"os"
+	"strings"
+	"testing"
+	"time"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestWsConnStalledPeer(t *testing.T) {
+	defer func(timeout time.Duration) {
+		wsWriteTimeout = timeout
+	}(wsWriteTimeout)
+	wsWriteTimeout = 50 * time.Millisecond
+
+	server, client := net.Pipe()
+	defer client.Close()
+	defer server.Close()
+	conn := &wsConn{
+		r:                bufio.NewReader(server),
+		w:                server,
+		closer:           server,
+		setWriteDeadline: server.SetWriteDeadline,
+		maxMessage:       defaultMaxBody,
+	}
+
+	// The client never reads, the write must not block forever.
+	errs := make(chan error, 1)
+	go func() {
+		errs <- conn.writeMessage("hello")
+	}()
+	select {
+	case err := <-errs:
+		require.True(t, errors.Is(err, os.ErrDeadlineExceeded), "got %v", err)
+	case <-time.After(5 * time.Second):
+		t.Fatal("writeMessage is blocked by a stalled peer")
+	}
+}
+
+func TestWsCloseReasonIsTrimmedToRunes(t *testing.T) {
+	var buf bytes.Buffer
+	conn := &wsConn{w: &buf}
+	// 2-byte runes: byte limit 123 falls inside a rune.
+	require.NoError(t, conn.writeClose(wsCloseInternalError, strings.Repeat("я", 100)))
+	frame := buf.Bytes()
+	payload := frame[2:]
+	require.Equal(t, int(frame[1]), len(payload))
+	require.LessOrEqual(t, len(payload), wsMaxControlPayload)
+	reason := payload[2:]
+	require.True(t, utf8.Valid(reason))
+	require.Equal(t, strings.Repeat("я", 61), string(reason))
+}
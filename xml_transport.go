@@ -0,0 +1,156 @@
+package api2
+
+import (
+	"context"
+	"encoding/xml"
+	"io"
+	"net/http"
+	"reflect"
+)
+
+const xmlMediaType = "application/xml"
+
+var xmlCodec = &bodyCodec{
+	mediaType:   xmlMediaType,
+	contentType: "application/xml; charset=UTF-8",
+	encode: func(w io.Writer, v interface{}, human bool) error {
+		if _, err := io.WriteString(w, xml.Header); err != nil {
+			return err
+		}
+		encoder := xml.NewEncoder(w)
+		if human {
+			encoder.Indent("", "  ")
+		}
+		if err := encoder.Encode(v); err != nil {
+			return err
+		}
+		_, err := io.WriteString(w, "\n")
+		return err
+	},
+	decode: func(r io.Reader, v interface{}) error {
+		return xml.NewDecoder(r).Decode(v)
+	},
+	named: func(v interface{}, name string) interface{} {
+		if _, has := reflect.TypeOf(v).Elem().FieldByName("XMLName"); has {
+			return v
+		}
+		return &xmlRoot{name: name, value: v}
+	},
+}
+
+// xmlRoot names the root element of a body copied to an anonymous struct
+// after the original type.
+type xmlRoot struct {
+	name  string
+	value interface{}
+}
+
+func (r *xmlRoot) MarshalXML(e *xml.Encoder, start xml.StartElement) error {
+	return e.EncodeElement(r.value, xml.StartElement{Name: xml.Name{Local: r.name}})
+}
+
+// XmlTransport implements interface Transport for XML encoding of
+// requests and responses.
+//
+// Fields of the body are encoded according to their xml tags (see
+// encoding/xml), other struct tags have the same meaning as in
+// JsonTransport: fields with tags query, header, cookie and url are passed
+// outside of the body, use_as_body and use_as_status work the same way.
+// The root element is named after the type of the request or response
+// unless the type has field XMLName.
+//
+// Errors are sent as XML document:
+//
+//	<error>
+//	  <message>user not found</message>
+//	  <code>UserNotFound</code>
+//	  <detail><UserNotFound><ID>123</ID></UserNotFound></detail>
+//	</error>
+//
+// Elements code and detail are present if the type of the error is
+// registered in field Errors.
+type XmlTransport struct {
+	// Errors whose structure is preserved and parsed back by api2 Client.
+	// See JsonTransport.Errors.
+	Errors map[string]error
+
+	// Compression enables compression of responses (if the client accepts
+	// it) and of request bodies sent by Client. See Compression.
+	Compression *Compression
+}
+
+type xmlInner struct {
+	Data []byte `xml:",innerxml"`
+}
+
+type xmlErrorMessage struct {
+	XMLName xml.Name  `xml:"error"`
+	Error   string    `xml:"message"`
+	Code    string    `xml:"code,omitempty"`
+	Detail  *xmlInner `xml:"detail"`
+}
+
+var xmlErrorCodec = &errorCodec{
+	contentType:     xmlCodec.contentType,
+	marshalDetail:   xml.Marshal,
+	unmarshalDetail: xml.Unmarshal,
+	encode: func(w io.Writer, message, code string, detail []byte) error {
+		msg := xmlErrorMessage{Error: message, Code: code}
+		if detail != nil {
+			msg.Detail = &xmlInner{Data: detail}
+		}
+		return xmlCodec.encode(w, &msg, false)
+	},
+	decode: func(data []byte) (string, string, []byte, error) {
+		var msg xmlErrorMessage
+		if err := xml.Unmarshal(data, &msg); err != nil {
+			return "", "", nil, err
+		}
+		var detail []byte
+		if msg.Detail != nil {
+			detail = msg.Detail.Data
+		}
+		return msg.Error, msg.Code, detail, nil
+	},
+}
+
+func (h *XmlTransport) ContentTypes() []string {
+	return []string{xmlMediaType}
+}
+
+func (h *XmlTransport) DecodeRequest(ctx context.Context, r *http.Request, req interface{}) (context.Context, error) {
+	return decodeCodecRequest(ctx, xmlCodec, h.Compression, r, req)
+}
+
+func (h *XmlTransport) EncodeResponse(ctx context.Context, w http.ResponseWriter, res interface{}) error {
+	return encodeCodecResponse(ctx, xmlCodec, h.Compression, w, res)
+}
+
+func (h *XmlTransport) EncodeError(ctx context.Context, w http.ResponseWriter, err error) error {
+	return encodeCodecError(xmlErrorCodec, h.Errors, w, err)
+}
+
+func (h *XmlTransport) errorCode(err error) string {
+	_, code := detectErrorType(err, h.Errors)
+	return code
+}
+
+func (h *XmlTransport) EncodeRequest(ctx context.Context, method, urlStr string, req interface{}) (*http.Request, error) {
+	return encodeRequest(ctx, xmlCodec, h.Compression, method, urlStr, req)
+}
+
+func (h *XmlTransport) DecodeResponse(ctx context.Context, res *http.Response, response interface{}) error {
+	return decodeCodecResponse(ctx, xmlCodec, res, response)
+}
+
+func (h *XmlTransport) DecodeError(ctx context.Context, res *http.Response) error {
+	return decodeCodecError(ctx, xmlErrorCodec, h.Errors, res)
+}
+
+func (h *XmlTransport) DecodeResponseAndError(ctx context.Context, res *http.Response, response interface{}) error {
+	return decodeResponseOrError(ctx, h, res, response)
+}
+
+func (h *XmlTransport) BodyCloseNeeded(ctx context.Context, response, request interface{}) bool {
+	return streamBodyCloseNeeded(response)
+}